@@ -75,6 +75,59 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// AssignStatement rebinds an existing name, e.g. x = x + 1;
+type AssignStatement struct {
+	Token token.Token // the token.IDENT token
+	Name  *Identifier
+	Value Expression
+}
+
+func (as *AssignStatement) statementNode()       {}
+func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AssignStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(as.Name.String())
+	out.WriteString(" = ")
+	if as.Value != nil {
+		out.WriteString(as.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// DestructuringLetStatement binds each element of a tuple to a name, e.g. let (x, y) = f();
+type DestructuringLetStatement struct {
+	Token token.Token // the token.LET token
+	Names []*Identifier
+	Value Expression
+}
+
+func (ds *DestructuringLetStatement) statementNode()       {}
+func (ds *DestructuringLetStatement) TokenLiteral() string { return ds.Token.Literal }
+
+func (ds *DestructuringLetStatement) String() string {
+	var out bytes.Buffer
+
+	names := []string{}
+	for _, n := range ds.Names {
+		names = append(names, n.String())
+	}
+
+	out.WriteString(ds.TokenLiteral() + " ")
+	out.WriteString("(" + strings.Join(names, ", ") + ")")
+	out.WriteString(" = ")
+	if ds.Value != nil {
+		out.WriteString(ds.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
 // Identifier is both a Node and an Expression
 type Identifier struct {
 	Token token.Token // the token.IDENT token
@@ -135,6 +188,16 @@ func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+// FloatLiteral is a number with a fractional part, like 1.5
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 // PrefixExpression is both a Node and an Expression
 type PrefixExpression struct {
 	Token    token.Token
@@ -215,6 +278,128 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// ThrowStatement raises Value as an exception, e.g. throw "empty list";
+type ThrowStatement struct {
+	Token token.Token // the `throw` token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// TryExpression evaluates Block, or Handler with Param bound to the exception
+// if Block throws one or fails at runtime, e.g. try { xs[0] } catch (e) { 0 }.
+// A runtime error is caught as its message
+type TryExpression struct {
+	Token   token.Token // The 'try' token
+	Block   *BlockStatement
+	Param   *Identifier
+	Handler *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	out.WriteString(" catch (")
+	out.WriteString(te.Param.String())
+	out.WriteString(") ")
+	out.WriteString(te.Handler.String())
+
+	return out.String()
+}
+
+// SwitchExpression evaluates the body of the first case with a value equal to
+// Value, or Default when none has one, e.g.
+// switch (x) { case 1, 2 { "small" } default { "large" } }
+type SwitchExpression struct {
+	Token   token.Token // The 'switch' token
+	Value   Expression
+	Cases   []*SwitchCase
+	Default *BlockStatement // nil without a default case
+}
+
+func (se *SwitchExpression) expressionNode()      {}
+func (se *SwitchExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SwitchExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("switch")
+	out.WriteString(se.Value.String())
+	out.WriteString(" {")
+
+	for _, c := range se.Cases {
+		out.WriteString(" ")
+		out.WriteString(c.String())
+	}
+
+	if se.Default != nil {
+		out.WriteString(" default ")
+		out.WriteString(se.Default.String())
+	}
+
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// SwitchCase is a case of a SwitchExpression, taken when the switch value
+// equals any of Values
+type SwitchCase struct {
+	Token  token.Token // The 'case' token
+	Values []Expression
+	Body   *BlockStatement
+}
+
+func (sc *SwitchCase) TokenLiteral() string { return sc.Token.Literal }
+func (sc *SwitchCase) String() string {
+	values := []string{}
+	for _, v := range sc.Values {
+		values = append(values, v.String())
+	}
+
+	return "case " + strings.Join(values, ", ") + " " + sc.Body.String()
+}
+
+// SpawnExpression runs Function, which takes no arguments, as a concurrent
+// task and evaluates to a channel that receives its result, e.g. spawn fn() { 1 }
+type SpawnExpression struct {
+	Token    token.Token // The 'spawn' token
+	Function Expression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) String() string {
+	return se.TokenLiteral() + " " + se.Function.String()
+}
+
+// WhileStatement runs Body for as long as Condition is truthy
+type WhileStatement struct {
+	Token     token.Token // The 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
 // BlockStatement is a Node and a slice of Statements
 type BlockStatement struct {
 	Token      token.Token // the { token
@@ -233,11 +418,30 @@ func (bs *BlockStatement) String() string {
 	return out.String()
 }
 
+// BlockExpression is a block in expression position that yields the value of its last expression
+type BlockExpression struct {
+	Token token.Token // the { token
+	Block *BlockStatement
+}
+
+func (be *BlockExpression) expressionNode()      {}
+func (be *BlockExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BlockExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("{ ")
+	out.WriteString(be.Block.String())
+	out.WriteString(" }")
+
+	return out.String()
+}
+
 // FunctionLiteral is a Node and an Expression
 type FunctionLiteral struct {
 	Token      token.Token // the 'fn' token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Name       string // name the function is bound to by a let statement, if any
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -251,6 +455,9 @@ func (fl *FunctionLiteral) String() string {
 	}
 
 	out.WriteString(fl.TokenLiteral())
+	if fl.Name != "" {
+		out.WriteString("<" + fl.Name + ">")
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
@@ -259,6 +466,32 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// MacroLiteral is a Node that represents a macro definition, e.g. macro(a, b) { quote(unquote(a) + unquote(b)) }
+type MacroLiteral struct {
+	Token      token.Token // the 'macro' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
 // CallExpression is a Node and an Expression
 type CallExpression struct {
 	Token     token.Token // The '(' token
@@ -294,6 +527,44 @@ func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
+// ImportExpression is a Node that loads the module at Path, e.g. import("math.monkey")
+type ImportExpression struct {
+	Token token.Token // the 'import' token
+	Path  string
+}
+
+func (ie *ImportExpression) expressionNode()      {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) String() string       { return "import(\"" + ie.Path + "\")" }
+
+// InterpolatedString is a Node that represents a backtick string with embedded expressions.
+// Literal text is held as StringLiterals whose token is TEMPLATE_TEXT
+type InterpolatedString struct {
+	Token token.Token // the '`' token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("`")
+	for _, part := range is.Parts {
+		if text, ok := part.(*StringLiteral); ok && text.Token.Type == token.TEMPLATE_TEXT {
+			out.WriteString(text.Value)
+			continue
+		}
+
+		out.WriteString("${")
+		out.WriteString(part.String())
+		out.WriteString("}")
+	}
+	out.WriteString("`")
+
+	return out.String()
+}
+
 // ArrayLiteral is a Node that represents a slice of Expressions
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
@@ -317,6 +588,29 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// TupleLiteral is a parenthesized group of Expressions, e.g. (a, b)
+type TupleLiteral struct {
+	Token    token.Token // the '(' token
+	Elements []Expression
+}
+
+func (tl *TupleLiteral) expressionNode()      {}
+func (tl *TupleLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TupleLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range tl.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("(")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // IndexExpression is an Expression Node for indexing into Arrays
 type IndexExpression struct {
 	Token token.Token // the `[` token
@@ -0,0 +1,173 @@
+package ast
+
+// Copy returns a deep copy of node, so the copy can be modified without
+// changing node. Tokens and names are shared, as nothing modifies them
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		return &Program{Statements: copyStatements(node.Statements)}
+
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: node.Token, Expression: copyExpression(node.Expression)}
+
+	case *LetStatement:
+		return &LetStatement{Token: node.Token, Name: node.Name, Value: copyExpression(node.Value)}
+
+	case *DestructuringLetStatement:
+		return &DestructuringLetStatement{Token: node.Token, Names: node.Names, Value: copyExpression(node.Value)}
+
+	case *AssignStatement:
+		return &AssignStatement{Token: node.Token, Name: node.Name, Value: copyExpression(node.Value)}
+
+	case *ReturnStatement:
+		return &ReturnStatement{Token: node.Token, ReturnValue: copyExpression(node.ReturnValue)}
+
+	case *ThrowStatement:
+		return &ThrowStatement{Token: node.Token, Value: copyExpression(node.Value)}
+
+	case *WhileStatement:
+		return &WhileStatement{Token: node.Token, Condition: copyExpression(node.Condition), Body: copyBlock(node.Body)}
+
+	case *BlockStatement:
+		return copyBlock(node)
+
+	case *BlockExpression:
+		return &BlockExpression{Token: node.Token, Block: copyBlock(node.Block)}
+
+	case *PrefixExpression:
+		return &PrefixExpression{Token: node.Token, Operator: node.Operator, Right: copyExpression(node.Right)}
+
+	case *InfixExpression:
+		return &InfixExpression{Token: node.Token, Left: copyExpression(node.Left),
+			Operator: node.Operator, Right: copyExpression(node.Right)}
+
+	case *IfExpression:
+		return &IfExpression{Token: node.Token, Condition: copyExpression(node.Condition),
+			Consequence: copyBlock(node.Consequence), Alternative: copyBlock(node.Alternative)}
+
+	case *TryExpression:
+		return &TryExpression{Token: node.Token, Block: copyBlock(node.Block),
+			Param: Copy(node.Param).(*Identifier), Handler: copyBlock(node.Handler)}
+
+	case *SwitchExpression:
+		cases := make([]*SwitchCase, len(node.Cases))
+		for i, c := range node.Cases {
+			cases[i] = Copy(c).(*SwitchCase)
+		}
+		return &SwitchExpression{Token: node.Token, Value: copyExpression(node.Value),
+			Cases: cases, Default: copyBlock(node.Default)}
+
+	case *SwitchCase:
+		return &SwitchCase{Token: node.Token, Values: copyExpressions(node.Values), Body: copyBlock(node.Body)}
+
+	case *SpawnExpression:
+		return &SpawnExpression{Token: node.Token, Function: copyExpression(node.Function)}
+
+	case *FunctionLiteral:
+		return &FunctionLiteral{Token: node.Token, Parameters: copyIdentifiers(node.Parameters),
+			Body: copyBlock(node.Body), Name: node.Name}
+
+	case *MacroLiteral:
+		return &MacroLiteral{Token: node.Token, Parameters: copyIdentifiers(node.Parameters), Body: copyBlock(node.Body)}
+
+	case *CallExpression:
+		return &CallExpression{Token: node.Token, Function: copyExpression(node.Function),
+			Arguments: copyExpressions(node.Arguments)}
+
+	case *IndexExpression:
+		return &IndexExpression{Token: node.Token, Left: copyExpression(node.Left), Index: copyExpression(node.Index)}
+
+	case *InterpolatedString:
+		return &InterpolatedString{Token: node.Token, Parts: copyExpressions(node.Parts)}
+
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: node.Token, Elements: copyExpressions(node.Elements)}
+
+	case *TupleLiteral:
+		return &TupleLiteral{Token: node.Token, Elements: copyExpressions(node.Elements)}
+
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression, len(node.Pairs))
+		for key, value := range node.Pairs {
+			pairs[copyExpression(key)] = copyExpression(value)
+		}
+		return &HashLiteral{Token: node.Token, Pairs: pairs}
+
+	case *Identifier:
+		copied := *node
+		return &copied
+
+	case *IntegerLiteral:
+		copied := *node
+		return &copied
+
+	case *FloatLiteral:
+		copied := *node
+		return &copied
+
+	case *Boolean:
+		copied := *node
+		return &copied
+
+	case *StringLiteral:
+		copied := *node
+		return &copied
+
+	case *ImportExpression:
+		copied := *node
+		return &copied
+	}
+
+	return node
+}
+
+func copyExpression(expression Expression) Expression {
+	if expression == nil {
+		return nil
+	}
+	copied, _ := Copy(expression).(Expression)
+	return copied
+}
+
+func copyExpressions(expressions []Expression) []Expression {
+	if expressions == nil {
+		return nil
+	}
+
+	copied := make([]Expression, len(expressions))
+	for i, expression := range expressions {
+		copied[i] = copyExpression(expression)
+	}
+	return copied
+}
+
+func copyStatements(statements []Statement) []Statement {
+	if statements == nil {
+		return nil
+	}
+
+	copied := make([]Statement, len(statements))
+	for i, statement := range statements {
+		copied[i], _ = Copy(statement).(Statement)
+	}
+	return copied
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return &BlockStatement{Token: block.Token, Statements: copyStatements(block.Statements)}
+}
+
+func copyIdentifiers(identifiers []*Identifier) []*Identifier {
+	if identifiers == nil {
+		return nil
+	}
+
+	copied := make([]*Identifier, len(identifiers))
+	for i, identifier := range identifiers {
+		copied[i] = Copy(identifier).(*Identifier)
+	}
+	return copied
+}
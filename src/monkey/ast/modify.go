@@ -0,0 +1,121 @@
+package ast
+
+// ModifierFunc returns the node to put in place of node
+type ModifierFunc func(Node) Node
+
+// Modify walks node depth first, replacing every child with the result of
+// calling modifier on it once its own children have been modified, and
+// returns modifier's result for node itself. Macro literals are not entered
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		for i, statement := range node.Statements {
+			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+		}
+
+	case *ExpressionStatement:
+		node.Expression, _ = Modify(node.Expression, modifier).(Expression)
+
+	case *LetStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *DestructuringLetStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *AssignStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *ReturnStatement:
+		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+
+	case *ThrowStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *WhileStatement:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *BlockStatement:
+		for i, statement := range node.Statements {
+			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+		}
+
+	case *BlockExpression:
+		node.Block, _ = Modify(node.Block, modifier).(*BlockStatement)
+
+	case *PrefixExpression:
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+
+	case *InfixExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+
+	case *IfExpression:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
+		if node.Alternative != nil {
+			node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+		}
+
+	case *TryExpression:
+		node.Block, _ = Modify(node.Block, modifier).(*BlockStatement)
+		node.Handler, _ = Modify(node.Handler, modifier).(*BlockStatement)
+
+	case *SwitchExpression:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+		for i, c := range node.Cases {
+			node.Cases[i], _ = Modify(c, modifier).(*SwitchCase)
+		}
+		if node.Default != nil {
+			node.Default, _ = Modify(node.Default, modifier).(*BlockStatement)
+		}
+
+	case *SpawnExpression:
+		node.Function, _ = Modify(node.Function, modifier).(Expression)
+
+	case *SwitchCase:
+		modifyExpressions(node.Values, modifier)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *FunctionLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i], _ = Modify(param, modifier).(*Identifier)
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *CallExpression:
+		node.Function, _ = Modify(node.Function, modifier).(Expression)
+		modifyExpressions(node.Arguments, modifier)
+
+	case *IndexExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Index, _ = Modify(node.Index, modifier).(Expression)
+
+	case *InterpolatedString:
+		modifyExpressions(node.Parts, modifier)
+
+	case *ArrayLiteral:
+		modifyExpressions(node.Elements, modifier)
+
+	case *TupleLiteral:
+		modifyExpressions(node.Elements, modifier)
+
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression, len(node.Pairs))
+		for key, value := range node.Pairs {
+			newKey, _ := Modify(key, modifier).(Expression)
+			newValue, _ := Modify(value, modifier).(Expression)
+			pairs[newKey] = newValue
+		}
+		node.Pairs = pairs
+	}
+
+	return modifier(node)
+}
+
+// modifyExpressions modifies every expression of expressions in place
+func modifyExpressions(expressions []Expression, modifier ModifierFunc) {
+	for i, expression := range expressions {
+		expressions[i], _ = Modify(expression, modifier).(Expression)
+	}
+}
@@ -0,0 +1,132 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			&WhileStatement{Condition: one(), Body: &BlockStatement{Statements: []Statement{&ReturnStatement{ReturnValue: one()}}}},
+			&WhileStatement{Condition: two(), Body: &BlockStatement{Statements: []Statement{&ReturnStatement{ReturnValue: two()}}}},
+		},
+		{&LetStatement{Value: one()}, &LetStatement{Value: two()}},
+		{&AssignStatement{Value: one()}, &AssignStatement{Value: two()}},
+		{&DestructuringLetStatement{Value: one()}, &DestructuringLetStatement{Value: two()}},
+		{
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}},
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}}},
+		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), two()}},
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}},
+		},
+		{&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+		{&TupleLiteral{Elements: []Expression{one(), one()}}, &TupleLiteral{Elements: []Expression{two(), two()}}},
+		{&InterpolatedString{Parts: []Expression{one()}}, &InterpolatedString{Parts: []Expression{two()}}},
+		{&BlockExpression{Block: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}},
+			&BlockExpression{Block: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}}}},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+
+	hashLiteral := &HashLiteral{Pairs: map[Expression]Expression{one(): one(), one(): one()}}
+	Modify(hashLiteral, turnOneIntoTwo)
+
+	for key, val := range hashLiteral.Pairs {
+		if key.(*IntegerLiteral).Value != 2 {
+			t.Errorf("key is not %d, got=%d", 2, key.(*IntegerLiteral).Value)
+		}
+		if val.(*IntegerLiteral).Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, val.(*IntegerLiteral).Value)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	original := &Program{Statements: []Statement{
+		&LetStatement{Name: &Identifier{Value: "f"}, Value: &FunctionLiteral{
+			Parameters: []*Identifier{{Value: "x"}},
+			Body: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &CallExpression{
+					Function:  &Identifier{Value: "g"},
+					Arguments: []Expression{&IntegerLiteral{Value: 1}, &HashLiteral{Pairs: map[Expression]Expression{&IntegerLiteral{Value: 1}: &IntegerLiteral{Value: 1}}}},
+				}},
+			}},
+		}},
+		&WhileStatement{Condition: &IntegerLiteral{Value: 1}, Body: &BlockStatement{}},
+	}}
+	before := original.String()
+
+	copied := Copy(original)
+	if copied.String() != before {
+		t.Fatalf("copy differs. got=%q, want=%q", copied.String(), before)
+	}
+
+	Modify(copied, func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok {
+			integer.Value = 2
+		}
+		return node
+	})
+
+	if original.String() != before {
+		t.Errorf("modifying the copy changed the original. got=%q, want=%q", original.String(), before)
+	}
+}
@@ -36,6 +36,24 @@ const (
 	OpCall
 	OpReturnValue
 	OpReturn
+	OpGetBuiltin
+	OpDestructure
+	OpBool
+	OpLoadImmediate
+	OpToString
+	OpGetLocal
+	OpSetLocal
+	OpClosure
+	OpGetFree
+	OpGreaterThanOrEqual
+	OpCurrentClosure
+	OpTailCall
+	OpImport
+	OpTry
+	OpEndTry
+	OpThrow
+	OpJumpTable
+	OpSpawn
 )
 
 // Definition provides a readable name for the Opcode and number of bytes each operand takes up
@@ -66,11 +84,40 @@ var definitions = map[Opcode]*Definition{
 	OpArray:         {"OpArray", []int{2}},
 	OpHash:          {"OpHash", []int{2}},
 	OpIndex:         {"OpIndex", []int{}},
-	OpCall:          {"OpCall", []int{}},
+	OpCall:          {"OpCall", []int{1}},
 	OpReturnValue:   {"OpReturnValue", []int{}},
 	OpReturn:        {"OpReturn", []int{}},
+	OpGetBuiltin:    {"OpGetBuiltin", []int{1}},
+	OpDestructure:   {"OpDestructure", []int{2}},
+	OpBool:          {"OpBool", []int{}},
+	OpLoadImmediate: {"OpLoadImmediate", []int{2}},
+	OpToString:      {"OpToString", []int{}},
+	OpGetLocal:      {"OpGetLocal", []int{1}},
+	OpSetLocal:      {"OpSetLocal", []int{1}},
+	OpClosure:       {"OpClosure", []int{2, 1}},
+	OpGetFree:       {"OpGetFree", []int{1}},
+
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+	OpCurrentClosure:     {"OpCurrentClosure", []int{}},
+	OpTailCall:           {"OpTailCall", []int{1}},
+	OpImport:             {"OpImport", []int{2}},
+	OpTry:                {"OpTry", []int{2}},
+	OpEndTry:             {"OpEndTry", []int{}},
+	OpThrow:              {"OpThrow", []int{}},
+	OpJumpTable:          {"OpJumpTable", []int{2, 2}},
+	OpSpawn:              {"OpSpawn", []int{}},
 }
 
+// operandWidths holds the OperandWidths of each definition indexed by opcode,
+// so decoding in hot loops avoids the definitions map
+var operandWidths = func() [256][]int {
+	var widths [256][]int
+	for op, def := range definitions {
+		widths[op] = def.OperandWidths
+	}
+	return widths
+}()
+
 // Lookup returns the definition of operation
 func Lookup(op byte) (*Definition, error) {
 	def, ok := definitions[Opcode(op)]
@@ -83,13 +130,13 @@ func Lookup(op byte) (*Definition, error) {
 
 // Make returns the instruction given an opcode and it's operands
 func Make(op Opcode, operands ...int) []byte {
-	def, ok := definitions[op]
-	if !ok {
+	widths := operandWidths[op]
+	if widths == nil {
 		return []byte{}
 	}
 
 	instructionLen := 1
-	for _, w := range def.OperandWidths {
+	for _, w := range widths {
 		instructionLen += w
 	}
 
@@ -98,10 +145,12 @@ func Make(op Opcode, operands ...int) []byte {
 
 	offset := 1
 	for i, o := range operands {
-		width := def.OperandWidths[i]
+		width := widths[i]
 		switch width {
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
 		}
 		offset += width
 	}
@@ -109,7 +158,8 @@ func Make(op Opcode, operands ...int) []byte {
 	return instruction
 }
 
-// Disassembler for Instructions
+// Disassembler for Instructions, printing the offset, name and operands of each
+// instruction. Decoding stops at the first undefined or truncated instruction
 func (ins Instructions) String() string {
 	var out bytes.Buffer
 
@@ -118,7 +168,12 @@ func (ins Instructions) String() string {
 		def, err := Lookup(ins[i])
 		if err != nil {
 			fmt.Fprintf(&out, "ERROR: %s\n", err)
-			continue
+			return out.String()
+		}
+
+		if !hasOperands(def, ins[i+1:]) {
+			fmt.Fprintf(&out, "ERROR: truncated operands for %s at %04d\n", def.Name, i)
+			return out.String()
 		}
 
 		operands, read := ReadOperands(def, ins[i+1:])
@@ -131,6 +186,81 @@ func (ins Instructions) String() string {
 	return out.String()
 }
 
+// InstructionString disassembles the single instruction at offset, formatted
+// like its line of String
+func (ins Instructions) InstructionString(offset int) string {
+	def, err := Lookup(ins[offset])
+	if err != nil {
+		return fmt.Sprintf("ERROR: %s", err)
+	}
+
+	if !hasOperands(def, ins[offset+1:]) {
+		return fmt.Sprintf("ERROR: truncated operands for %s at %04d", def.Name, offset)
+	}
+
+	operands, _ := ReadOperands(def, ins[offset+1:])
+	return fmt.Sprintf("%04d %s", offset, ins.fmtInstruction(def, operands))
+}
+
+// InstructionStart returns the offset of the instruction whose opcode or
+// operands hold the byte at offset, such as a frame's ip after it has read
+// the operands of the instruction being executed
+func (ins Instructions) InstructionStart(offset int) int {
+	start := 0
+	for start < len(ins) {
+		next := start + 1
+		for _, width := range operandWidths[ins[start]] {
+			next += width
+		}
+		if next > offset {
+			return start
+		}
+		start = next
+	}
+	return start
+}
+
+// CoverageString annotates the disassembly with a * on every covered instruction
+func (ins Instructions) CoverageString(covered []bool) string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			return out.String()
+		}
+
+		if !hasOperands(def, ins[i+1:]) {
+			fmt.Fprintf(&out, "ERROR: truncated operands for %s at %04d\n", def.Name, i)
+			return out.String()
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		marker := " "
+		if i < len(covered) && covered[i] {
+			marker = "*"
+		}
+
+		fmt.Fprintf(&out, "%s %04d %s\n", marker, i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+// hasOperands reports whether ins is long enough to hold the operands of def
+func hasOperands(def *Definition, ins Instructions) bool {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return len(ins) >= width
+}
+
 func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 	operandCount := len(def.OperandWidths)
 
@@ -143,19 +273,35 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		return def.Name
 	case 1:
 		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
 	}
 
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
 }
 
+// ReadOperands decodes the operands described by def from ins, returning them
+// along with the number of bytes read
 func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
-	operands := make([]int, len(def.OperandWidths))
+	return readOperands(def.OperandWidths, ins)
+}
+
+// ReadOperandsOf decodes the operands of op from ins like ReadOperands,
+// without looking up its definition
+func ReadOperandsOf(op Opcode, ins Instructions) ([]int, int) {
+	return readOperands(operandWidths[op], ins)
+}
+
+func readOperands(widths []int, ins Instructions) ([]int, int) {
+	operands := make([]int, len(widths))
 	offset := 0
 
-	for i, width := range def.OperandWidths {
+	for i, width := range widths {
 		switch width {
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
 		}
 
 		offset += width
@@ -168,3 +314,13 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
+
+// ReadInt16 reads the next 2 bytes from the given instructions slice and interprets them as an int16
+func ReadInt16(ins Instructions) int16 {
+	return int16(binary.BigEndian.Uint16(ins))
+}
+
+// ReadUint8 reads the next byte from the given instructions slice
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
@@ -10,6 +10,9 @@ func TestMake(t *testing.T) {
 	}{
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetBuiltin, []int{255}, []byte{byte(OpGetBuiltin), 255}},
+		{OpLoadImmediate, []int{-2}, []byte{byte(OpLoadImmediate), 255, 254}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
 	}
 
 	for _, tt := range tests {
@@ -31,13 +34,17 @@ func TestMake(t *testing.T) {
 func TestInstructionString(t *testing.T) {
 	instructions := []Instructions{
 		Make(OpAdd),
+		Make(OpGetBuiltin, 1),
 		Make(OpConstant, 2),
 		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
 	}
 
 	expected := `0000 OpAdd
-0001 OpConstant 2
-0004 OpConstant 65535
+0001 OpGetBuiltin 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
 `
 
 	concatted := Instructions{}
@@ -52,6 +59,111 @@ func TestInstructionString(t *testing.T) {
 
 }
 
+func TestInstructionStringMalformed(t *testing.T) {
+	tests := []struct {
+		ins      Instructions
+		expected string
+	}{
+		{
+			append(Make(OpAdd), 255, byte(OpPop)),
+			"0000 OpAdd\nERROR: opcode 255 undefined\n",
+		},
+		{
+			append(Make(OpPop), Make(OpConstant, 1)[:2]...),
+			"0000 OpPop\nERROR: truncated operands for OpConstant at 0001\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.ins.String() != tt.expected {
+			t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+				tt.expected, tt.ins.String())
+		}
+	}
+}
+
+func TestInstructionCoverageString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpTrue),
+		Make(OpJumpNotTruthy, 7),
+		Make(OpConstant, 0),
+		Make(OpPop),
+	}
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	covered := make([]bool, len(concatted))
+	covered[0] = true
+	covered[1] = true
+	covered[7] = true
+
+	expected := `* 0000 OpTrue
+* 0001 OpJumpNotTruthy 7
+  0004 OpConstant 0
+* 0007 OpPop
+`
+
+	if concatted.CoverageString(covered) != expected {
+		t.Errorf("coverage wrongly formatted.\nwant=%q\ngot=%q",
+			expected, concatted.CoverageString(covered))
+	}
+}
+
+func TestSingleInstructionString(t *testing.T) {
+	concatted := Instructions{}
+	for _, ins := range []Instructions{Make(OpAdd), Make(OpClosure, 65535, 255), Make(OpConstant, 2)} {
+		concatted = append(concatted, ins...)
+	}
+
+	tests := []struct {
+		offset   int
+		expected string
+	}{
+		{0, "0000 OpAdd"},
+		{1, "0001 OpClosure 65535 255"},
+		{5, "0005 OpConstant 2"},
+	}
+
+	for _, tt := range tests {
+		if got := concatted.InstructionString(tt.offset); got != tt.expected {
+			t.Errorf("wrong instruction at %d. want=%q, got=%q", tt.offset, tt.expected, got)
+		}
+	}
+
+	truncated := Instructions{byte(OpConstant), 0}
+	if got := truncated.InstructionString(0); got != "ERROR: truncated operands for OpConstant at 0000" {
+		t.Errorf("truncated instruction wrongly formatted. got=%q", got)
+	}
+}
+
+func TestInstructionStart(t *testing.T) {
+	concatted := Instructions{}
+	for _, ins := range []Instructions{Make(OpAdd), Make(OpClosure, 65535, 255), Make(OpConstant, 2)} {
+		concatted = append(concatted, ins...)
+	}
+
+	tests := []struct {
+		offset   int
+		expected int
+	}{
+		{0, 0},
+		{1, 1},
+		{3, 1},
+		{4, 1},
+		{5, 5},
+		{7, 5},
+	}
+
+	for _, tt := range tests {
+		if got := concatted.InstructionStart(tt.offset); got != tt.expected {
+			t.Errorf("wrong start for %d. want=%d, got=%d", tt.offset, tt.expected, got)
+		}
+	}
+}
+
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
 		op        Opcode
@@ -59,6 +171,8 @@ func TestReadOperands(t *testing.T) {
 		bytesRead int
 	}{
 		{OpConstant, []int{65535}, 2},
+		{OpGetBuiltin, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
 	}
 
 	for _, tt := range tests {
@@ -79,5 +193,103 @@ func TestReadOperands(t *testing.T) {
 				t.Errorf("operand wrong. wnat%d, got=%d", want, operandsRead[i])
 			}
 		}
+
+		operandsRead, n = ReadOperandsOf(tt.op, instructions[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("ReadOperandsOf n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("ReadOperandsOf operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestOperandWidthsMatchDefinitions(t *testing.T) {
+	for op := 0; op < len(operandWidths); op++ {
+		def, ok := definitions[Opcode(op)]
+		if !ok {
+			if operandWidths[op] != nil {
+				t.Errorf("undefined opcode %d has operand widths %v", op, operandWidths[op])
+			}
+			continue
+		}
+
+		if len(operandWidths[op]) != len(def.OperandWidths) {
+			t.Fatalf("%s: wrong number of widths. want=%v, got=%v",
+				def.Name, def.OperandWidths, operandWidths[op])
+		}
+
+		for i, width := range def.OperandWidths {
+			if operandWidths[op][i] != width {
+				t.Errorf("%s: width %d wrong. want=%d, got=%d", def.Name, i, width, operandWidths[op][i])
+			}
+		}
+	}
+}
+
+// benchmarkInstructions is a mix of opcodes with 0, 1 and 2 byte operands
+var benchmarkInstructions = []Instructions{
+	Make(OpConstant, 1),
+	Make(OpGetBuiltin, 2),
+	Make(OpCall, 1),
+	Make(OpAdd),
+	Make(OpJump, 0),
+}
+
+func BenchmarkReadOperands(b *testing.B) {
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		for _, ins := range benchmarkInstructions {
+			def, _ := Lookup(ins[0])
+			ReadOperands(def, ins[1:])
+		}
+	}
+}
+
+func BenchmarkReadOperandsOf(b *testing.B) {
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		for _, ins := range benchmarkInstructions {
+			ReadOperandsOf(Opcode(ins[0]), ins[1:])
+		}
+	}
+}
+
+func TestLineTableLookup(t *testing.T) {
+	table := LineTable{
+		{Offset: 0, Position: Position{Line: 1, Column: 1}},
+		{Offset: 3, Position: Position{Line: 1, Column: 7}},
+		{Offset: 7, Position: Position{Line: 2, Column: 3}},
+	}
+
+	tests := []struct {
+		offset   int
+		expected Position
+	}{
+		{0, Position{Line: 1, Column: 1}},
+		{2, Position{Line: 1, Column: 1}},
+		{3, Position{Line: 1, Column: 7}},
+		{6, Position{Line: 1, Column: 7}},
+		{100, Position{Line: 2, Column: 3}},
+	}
+
+	for _, tt := range tests {
+		pos, ok := table.Lookup(tt.offset)
+		if !ok || pos != tt.expected {
+			t.Errorf("wrong position at %d. want=%s, got=%s (%t)", tt.offset, tt.expected, pos, ok)
+		}
+	}
+
+	if _, ok := (LineTable{}).Lookup(0); ok {
+		t.Errorf("empty table reported a position")
+	}
+
+	if got := (Position{Line: 12, Column: 5}).String(); got != "line 12, col 5" {
+		t.Errorf("wrong Position.String(). got=%q", got)
 	}
 }
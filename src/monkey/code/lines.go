@@ -0,0 +1,36 @@
+package code
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Position is a line and column in the source, starting at 1
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("line %d, col %d", p.Line, p.Column)
+}
+
+// LineEntry marks the instructions from Offset up to the next entry as compiled
+// from the source at Position
+type LineEntry struct {
+	Offset   int
+	Position Position
+}
+
+// LineTable maps instruction offsets back to the source, ordered by Offset
+type LineTable []LineEntry
+
+// Lookup returns the source position of the instruction at offset, reporting
+// false when no entry covers it
+func (t LineTable) Lookup(offset int) (Position, bool) {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 {
+		return Position{}, false
+	}
+	return t[i-1].Position, true
+}
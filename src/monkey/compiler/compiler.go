@@ -1,16 +1,38 @@
 package compiler
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"go-compiler/src/monkey/ast"
 	"go-compiler/src/monkey/code"
 	"go-compiler/src/monkey/object"
+	"go-compiler/src/monkey/token"
+	"math"
 	"sort"
+	"strings"
 )
 
 type Bytecode struct {
 	Instructions code.Instructions
+	Lines        code.LineTable
 	Constants    []object.Object
+	SymbolTable  *SymbolTable
+	Builtins     []*object.Builtin
+}
+
+// Error is a compilation error located at the node that caused it
+type Error struct {
+	Position code.Position
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Position, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
 }
 
 type EmittedInstruction struct {
@@ -18,22 +40,109 @@ type EmittedInstruction struct {
 	Position int
 }
 
-type Compiler struct {
+// Options toggles optional compiler behaviour
+type Options struct {
+	// Optimize folds constant integer and boolean expressions, drops
+	// branches and instructions that can never be executed, like those after
+	// a return, and runs a peephole pass over the emitted instructions
+	Optimize bool
+
+	// ImmediateIntegers loads integer literals that fit in 16 bits with
+	// OpLoadImmediate instead of going through the constant pool
+	ImmediateIntegers bool
+
+	// Importer returns the source of the module at path for import
+	// expressions. Relative paths are resolved against the directory of the
+	// importing module before it is called. Defaults to reading the file
+	Importer func(path string) (string, error)
+
+	// Dir is the directory of the main program, which its relative imports
+	// are resolved against. Defaults to the working directory
+	Dir string
+}
+
+// CompilationScope holds the instructions being emitted for the program or a function body
+type CompilationScope struct {
 	instructions        code.Instructions
-	constants           []object.Object
+	lines               code.LineTable
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
-	symbolTable         *SymbolTable
+
+	// module is set for the top level of an imported module
+	module bool
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+	builtins    []*object.Builtin
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	options  Options
+	warnings []string
+
+	// position of the node being compiled, recorded in the line table on emit
+	position code.Position
+
+	// interned maps integer and string values to their constant pool index
+	interned map[constantKey]int
+
+	// modules maps the path of every module compiled so far to its constant
+	// index, importing holds the modules being compiled and moduleDir is the
+	// directory of the innermost one
+	modules   map[string]int
+	importing map[string]bool
+	moduleDir string
+}
+
+// constantKey identifies a constant pool value that can be shared
+type constantKey struct {
+	kind  object.ObjectType
+	value interface{}
+}
+
+// keyOf returns the key of constants that are deduplicated in the pool.
+// Compiled functions are never shared
+func keyOf(obj object.Object) (constantKey, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return constantKey{kind: object.INTEGER_OBJ, value: obj.Value}, true
+	case *object.Float:
+		// Compare bits, as == would merge 0.0 with -0.0
+		return constantKey{kind: object.FLOAT_OBJ, value: math.Float64bits(obj.Value)}, true
+	case *object.String:
+		return constantKey{kind: object.STRING_OBJ, value: obj.Value}, true
+	}
+	return constantKey{}, false
 }
 
 // New creates new Compiler with empty instructions and constant pool
 func New() *Compiler {
-	return &Compiler{
+	symbolTable := NewSymbolTable()
+	builtins := []*object.Builtin{}
+
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+		builtins = append(builtins, v.Builtin)
+	}
+
+	mainScope := CompilationScope{
 		instructions:        code.Instructions{},
-		constants:           []object.Object{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
-		symbolTable:         NewSymbolTable(),
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		builtins:    builtins,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+		interned:    make(map[constantKey]int),
+		modules:     make(map[string]int),
+		importing:   make(map[string]bool),
 	}
 }
 
@@ -42,11 +151,46 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	compiler := New()
 	compiler.symbolTable = s
 	compiler.constants = constants
+
+	// Keep sharing the constants already in the pool
+	for i, c := range constants {
+		if key, ok := keyOf(c); ok {
+			if _, ok := compiler.interned[key]; !ok {
+				compiler.interned[key] = i
+			}
+		}
+	}
+
 	return compiler
 }
 
-// Compile generates instructions given an AST Node
-func (c *Compiler) Compile(node ast.Node) error {
+// NewWithOptions creates a new Compiler configured with the given options
+func NewWithOptions(options Options) *Compiler {
+	compiler := New()
+	compiler.options = options
+	compiler.moduleDir = options.Dir
+	return compiler
+}
+
+// Warnings returns the diagnostics recorded while compiling
+func (c *Compiler) Warnings() []string {
+	return c.warnings
+}
+
+// Compile generates instructions given an AST Node. Errors are returned as an
+// *Error located at the innermost node with a source position
+func (c *Compiler) Compile(node ast.Node) (err error) {
+	outer := c.position
+	if pos, ok := nodePosition(node); ok {
+		c.position = pos
+	}
+	defer func() {
+		var located *Error
+		if err != nil && c.position.Line != 0 && !errors.As(err, &located) {
+			err = &Error{Position: c.position, Err: err}
+		}
+		c.position = outer
+	}()
 
 	switch node := node.(type) {
 
@@ -58,6 +202,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 
+		if c.options.Optimize {
+			c.optimizeScope(false)
+		}
+
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
@@ -66,6 +214,22 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpPop)
 
 	case *ast.PrefixExpression:
+		if value, ok := c.fold(node); ok {
+			c.emitValue(value)
+			return nil
+		}
+
+		// The double-bang idiom !!x coerces x to a boolean in one step
+		if inner, ok := node.Right.(*ast.PrefixExpression); ok && node.Operator == "!" && inner.Operator == "!" {
+			err := c.Compile(inner.Right)
+			if err != nil {
+				return err
+			}
+
+			c.emit(code.OpBool)
+			return nil
+		}
+
 		err := c.Compile(node.Right)
 		if err != nil {
 			return err
@@ -77,13 +241,22 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case "!":
 			c.emit(code.OpBang)
 		default:
-			return fmt.Errorf("unkown operator: %s", node.Operator)
+			return fmt.Errorf("unknown prefix operator: %s", node.Operator)
 		}
 
 	case *ast.InfixExpression:
-		// LesserThan operator handled by switching the operands
+		if value, ok := c.fold(node); ok {
+			c.emitValue(value)
+			return nil
+		}
+
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogical(node)
+		}
+
+		// LesserThan operators handled by switching the operands
 		// and emitting opCode for GreaterThan
-		if node.Operator == "<" {
+		if node.Operator == "<" || node.Operator == "<=" {
 
 			err := c.Compile(node.Right)
 			if err != nil {
@@ -95,7 +268,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 
-			c.emit(code.OpGreaterThan)
+			if node.Operator == "<" {
+				c.emit(code.OpGreaterThan)
+			} else {
+				c.emit(code.OpGreaterThanOrEqual)
+			}
 			return nil
 		}
 
@@ -120,69 +297,69 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpDiv)
 		case ">":
 			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterThanOrEqual)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
 		default:
-			return fmt.Errorf("unkown operator: %s", node.Operator)
+			return fmt.Errorf("unknown infix operator: %s", node.Operator)
 		}
 
 	case *ast.IntegerLiteral:
-		integer := &object.Integer{Value: node.Value}
-		c.emit(code.OpConstant, c.addConstant(integer))
+		c.emitInteger(node.Value)
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
 
 	case *ast.Boolean:
-		if node.Value {
-			c.emit(code.OpTrue)
-		} else {
-			c.emit(code.OpFalse)
-		}
+		c.emitBoolean(node.Value)
 
 	case *ast.IfExpression:
+		// A literal condition always takes the same branch
+		if condition, ok := node.Condition.(*ast.Boolean); ok {
+			c.warnUnreachableBranch(node, condition.Value)
+
+			if c.options.Optimize {
+				return c.compileLiveBranch(node, condition.Value)
+			}
+		}
+
+		// So does a condition made of constants only
+		if value, ok := c.fold(node.Condition); ok {
+			return c.compileLiveBranch(node, value != object.FALSE)
+		}
+
 		// Compile condition expression first
 		err := c.Compile(node.Condition)
 		if err != nil {
 			return err
 		}
 
-		// Emit an OpJumpNotTruthy with a bogus value
-		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+		jumpNotTruthyPos := c.emitJump(code.OpJumpNotTruthy)
 
-		// Compile value of consequence
-		err = c.Compile(node.Consequence)
+		// Compile value of consequence, keeping the evaluated
+		// value on the stack to be potentially assigned
+		// to a variable in let statement
+		err = c.compileBlockValue(node.Consequence)
 		if err != nil {
 			return err
 		}
 
-		// Removing last pop to keep evaluated value
-		// of the consequence block to be potentially
-		// assigned to a variable in let statement
-		if c.lastInstructionIsPop() {
-			c.removeLastPop()
-		}
-
-		// Emit a Jump instruction with bogus value
-		jumpPos := c.emit(code.OpJump, 9999)
-
-		afterConsequencePos := len(c.instructions)
-		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+		jumpPos := c.emitJump(code.OpJump)
+		c.patchJump(jumpNotTruthyPos)
 
 		if node.Alternative == nil {
 			c.emit(code.OpNull)
 		} else {
-			err = c.Compile(node.Alternative)
+			err = c.compileBlockValue(node.Alternative)
 			if err != nil {
 				return err
 			}
-
-			if c.lastInstructionIsPop() {
-				c.removeLastPop()
-			}
 		}
 
-		afterAlternativePos := len(c.instructions)
-		c.changeOperand(jumpPos, afterAlternativePos)
+		c.patchJump(jumpPos)
 
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
@@ -192,13 +369,126 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 
+	case *ast.BlockExpression:
+		// Names defined in the block are not visible after it
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+
+		err := c.compileBlockValue(node.Block)
+
+		c.symbolTable = c.symbolTable.Outer
+		if err != nil {
+			return err
+		}
+
 	case *ast.LetStatement:
+		err := c.checkRedefinition(node.Name.Value)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		symbol, rebound := c.symbolTable.Redefine(node.Name.Value)
+		if rebound {
+			c.symbolTable.assign(symbol, c.position)
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.AssignStatement:
+		symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Name.Value)
+		}
+
+		// Closures hold copies of their free variables, so assigning one
+		// would not be seen by the function that defined it. Assigning a
+		// local that a closure captures is rejected once the function that
+		// defines it has been compiled
+		switch symbol.Scope {
+		case BuiltinScope:
+			return fmt.Errorf("cannot assign to builtin %q", node.Name.Value)
+		case FreeScope, FunctionScope:
+			return fmt.Errorf("cannot assign to captured variable %s", node.Name.Value)
+		}
+
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
-		symbol := c.symbolTable.Define(node.Name.Value)
-		c.emit(code.OpSetGlobal, symbol.Index)
+		c.symbolTable.assign(symbol, c.position)
+		c.storeSymbol(symbol)
+
+	case *ast.WhileStatement:
+		loopStart := len(c.currentInstructions())
+
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		exitPos := c.emitJump(code.OpJumpNotTruthy)
+
+		// Statements in the body pop their own values, so the stack is
+		// the same at the top of every iteration
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpJump, loopStart)
+		c.patchJump(exitPos)
+
+	case *ast.TryExpression:
+		return c.compileTry(node)
+
+	case *ast.SwitchExpression:
+		return c.compileSwitch(node)
+
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpThrow)
+
+	case *ast.SpawnExpression:
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpSpawn)
+
+	case *ast.DestructuringLetStatement:
+		for _, name := range node.Names {
+			err := c.checkRedefinition(name.Value)
+			if err != nil {
+				return err
+			}
+		}
+
+		if tuple, ok := node.Value.(*ast.TupleLiteral); ok && len(tuple.Elements) != len(node.Names) {
+			return fmt.Errorf("cannot destructure %d values into %d names",
+				len(tuple.Elements), len(node.Names))
+		}
+
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		// OpDestructure leaves the first element on top of the stack
+		c.emit(code.OpDestructure, len(node.Names))
+		for _, name := range node.Names {
+			symbol, rebound := c.symbolTable.Redefine(name.Value)
+			if rebound {
+				c.symbolTable.assign(symbol, c.position)
+			}
+			c.storeSymbol(symbol)
+		}
 
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
@@ -206,11 +496,38 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return fmt.Errorf("undefined variable %s", node.Value)
 		}
 
-		c.emit(code.OpGetGlobal, symbol.Index)
+		c.loadSymbol(symbol)
 
 	case *ast.StringLiteral:
-		str := &object.String{Value: node.Value}
-		c.emit(code.OpConstant, c.addConstant(str))
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.ImportExpression:
+		return c.compileImport(node)
+
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macros can only be defined by top level let statements")
+
+	case *ast.InterpolatedString:
+		if len(node.Parts) == 0 {
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: ""}))
+			return nil
+		}
+
+		// Concatenate the parts left to right, stringifying embedded expressions
+		for i, part := range node.Parts {
+			err := c.Compile(part)
+			if err != nil {
+				return err
+			}
+
+			if _, ok := part.(*ast.StringLiteral); !ok {
+				c.emit(code.OpToString)
+			}
+
+			if i > 0 {
+				c.emit(code.OpAdd)
+			}
+		}
 
 	case *ast.ArrayLiteral:
 		for _, elem := range node.Elements {
@@ -222,6 +539,17 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpArray, len(node.Elements))
 
+	case *ast.TupleLiteral:
+		// Tuples are arrays under the hood
+		for _, elem := range node.Elements {
+			err := c.Compile(elem)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+
 	case *ast.HashLiteral:
 		keys := []ast.Expression{}
 		for k := range node.Pairs {
@@ -258,6 +586,93 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		c.emit(code.OpIndex)
+
+	case *ast.FunctionLiteral:
+		c.enterScope()
+
+		if node.Name != "" {
+			c.symbolTable.DefineFunctionName(node.Name)
+		}
+
+		for _, p := range node.Parameters {
+			c.symbolTable.Define(p.Value)
+		}
+
+		err := c.Compile(node.Body)
+		if err != nil {
+			c.leaveScope()
+			return err
+		}
+
+		if a, ok := c.symbolTable.capturedAssignment(); ok {
+			c.leaveScope()
+			return &Error{Position: a.position, Err: fmt.Errorf("cannot assign to captured variable %s", a.name)}
+		}
+
+		// The value of the last expression is returned implicitly
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		if c.options.Optimize {
+			c.optimizeScope(true)
+		}
+		markTailCalls(c.currentInstructions())
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		lines := c.scopes[c.scopeIndex].lines
+		instructions := c.leaveScope()
+
+		// Push the captured values for OpClosure to collect
+		for _, s := range freeSymbols {
+			c.loadSymbol(s)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+			Lines:         lines,
+		}
+		c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	case *ast.ReturnStatement:
+		if c.scopeIndex == 0 || c.scopes[c.scopeIndex].module {
+			return fmt.Errorf("return statement outside of function")
+		}
+
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpReturnValue)
+
+	case *ast.CallExpression:
+		// Quotes only exist while macros expand, before compilation
+		if name := node.Function.TokenLiteral(); name == "quote" || name == "unquote" {
+			if _, ok := c.symbolTable.peek(name); !ok {
+				return fmt.Errorf("%s is only supported inside macros", name)
+			}
+		}
+
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
 	}
 
 	return nil
@@ -265,15 +680,227 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
-		Instructions: c.instructions,
+		Instructions: c.currentInstructions(),
+		Lines:        c.scopes[c.scopeIndex].lines,
 		Constants:    c.constants,
+		SymbolTable:  c.symbolTable,
+		Builtins:     c.builtins,
+	}
+}
+
+// ConstantCount returns the number of objects in the constant pool
+func (b *Bytecode) ConstantCount() int {
+	return len(b.Constants)
+}
+
+// Constant returns the constant at index i, reporting false when i is out of range
+func (b *Bytecode) Constant(i int) (object.Object, bool) {
+	if i < 0 || i >= len(b.Constants) {
+		return nil, false
+	}
+	return b.Constants[i], true
+}
+
+// String disassembles the main instructions followed by the constant pool,
+// with the instructions of compiled functions indented below their entry
+func (b *Bytecode) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("Instructions:\n")
+	out.WriteString(b.Instructions.String())
+
+	out.WriteString("\nConstants:\n")
+	for i, c := range b.Constants {
+		switch c := c.(type) {
+		case *object.CompiledFunction:
+			fmt.Fprintf(&out, "%04d %s locals=%d parameters=%d\n", i, c.Type(), c.NumLocals, c.NumParameters)
+			for _, line := range strings.SplitAfter(c.Instructions.String(), "\n") {
+				if line != "" {
+					out.WriteString("     " + line)
+				}
+			}
+		case *object.String:
+			fmt.Fprintf(&out, "%04d %s %q\n", i, c.Type(), c.Value)
+		default:
+			fmt.Fprintf(&out, "%04d %s %s\n", i, c.Type(), c.Inspect())
+		}
+	}
+
+	return out.String()
+}
+
+// SymbolTable returns the symbol table holding the names defined so far
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+// DefineGlobal binds name in the global scope so a host can seed its value before running
+func (c *Compiler) DefineGlobal(name string) Symbol {
+	return c.symbolTable.Define(name)
+}
+
+// MaxBuiltins is the number of builtins the one-byte operand of OpGetBuiltin can index
+const MaxBuiltins = 1 << 8
+
+// RegisterBuiltin makes a host-provided Go function callable from Monkey as name.
+// The function is appended after the existing builtins so their indexes are unchanged.
+// It fails once MaxBuiltins builtins are registered
+func (c *Compiler) RegisterBuiltin(name string, fn object.BuiltinFunction) (Symbol, error) {
+	if c.symbolTable.numBuiltins >= MaxBuiltins {
+		return Symbol{}, fmt.Errorf("cannot register builtin %q: more than %d builtins", name, MaxBuiltins)
+	}
+
+	symbol := c.symbolTable.DefineBuiltin(c.symbolTable.numBuiltins, name)
+
+	for len(c.builtins) <= symbol.Index {
+		c.builtins = append(c.builtins, nil)
+	}
+	c.builtins[symbol.Index] = &object.Builtin{Fn: fn}
+
+	return symbol, nil
+}
+
+// checkRedefinition rejects binding a name that is a keyword or a builtin
+func (c *Compiler) checkRedefinition(name string) error {
+	if token.LookupIdent(name) != token.IDENT {
+		return fmt.Errorf("cannot redefine builtin or keyword %q", name)
+	}
+
+	if symbol, ok := c.symbolTable.peek(name); ok && symbol.Scope == BuiltinScope {
+		return fmt.Errorf("cannot redefine builtin or keyword %q", name)
+	}
+
+	return nil
+}
+
+// loadSymbol emits the instruction to push the symbol's value based on its scope
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// storeSymbol emits the instruction to pop the top of the stack into the symbol's slot
+func (c *Compiler) storeSymbol(s Symbol) {
+	if s.Scope == LocalScope {
+		c.emit(code.OpSetLocal, s.Index)
+	} else {
+		c.emit(code.OpSetGlobal, s.Index)
+	}
+}
+
+// warnUnreachableBranch records a warning for the branch of an if expression
+// that can never run given its literal condition
+func (c *Compiler) warnUnreachableBranch(node *ast.IfExpression, condition bool) {
+	if condition && node.Alternative != nil {
+		c.warnings = append(c.warnings, fmt.Sprintf("unreachable else branch: condition of %s is always true", node.String()))
+	}
+
+	if !condition {
+		c.warnings = append(c.warnings, fmt.Sprintf("unreachable consequence: condition of %s is always false", node.String()))
 	}
 }
 
-// addConstant to compiler's constant pool
+// compileLiveBranch compiles only the branch of an if expression that
+// its literal condition selects, without any jumps
+func (c *Compiler) compileLiveBranch(node *ast.IfExpression, condition bool) error {
+	live := node.Consequence
+	if !condition {
+		live = node.Alternative
+	}
+
+	if live == nil {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	return c.compileBlockValue(live)
+}
+
+// compileBlockValue compiles a block so that it leaves the value of its
+// last expression on the stack, or null when it doesn't end in one
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if len(block.Statements) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// fold evaluates node at compile time when optimizing and it is made of constants only
+func (c *Compiler) fold(node ast.Expression) (object.Object, bool) {
+	if !c.options.Optimize {
+		return nil, false
+	}
+	return foldConstant(node)
+}
+
+// emitValue loads a folded integer or boolean
+func (c *Compiler) emitValue(value object.Object) {
+	switch value := value.(type) {
+	case *object.Integer:
+		c.emitInteger(value.Value)
+	case *object.Boolean:
+		c.emitBoolean(value.Value)
+	}
+}
+
+// emitInteger loads value as an immediate operand when enabled and it fits,
+// otherwise from the constant pool
+func (c *Compiler) emitInteger(value int64) {
+	if c.options.ImmediateIntegers && value >= math.MinInt16 && value <= math.MaxInt16 {
+		c.emit(code.OpLoadImmediate, int(value))
+		return
+	}
+
+	c.emit(code.OpConstant, c.addConstant(object.NewInteger(value)))
+}
+
+func (c *Compiler) emitBoolean(value bool) {
+	if value {
+		c.emit(code.OpTrue)
+	} else {
+		c.emit(code.OpFalse)
+	}
+}
+
+// addConstant to compiler's constant pool. Integers and strings already in
+// the pool are reused, so identical literals share one constant
 func (c *Compiler) addConstant(obj object.Object) int {
+	key, shared := keyOf(obj)
+	if shared {
+		if index, ok := c.interned[key]; ok {
+			return index
+		}
+	}
+
 	c.constants = append(c.constants, obj)
-	return len(c.constants) - 1
+	index := len(c.constants) - 1
+	if shared {
+		c.interned[key] = index
+	}
+	return index
 }
 
 // emit generates and adds instructions
@@ -286,44 +913,255 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	return pos
 }
 
-// addInstruction to compiler
+// currentInstructions returns the instructions of the scope being compiled
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// addInstruction to compiler, recording the position it was compiled from
+// whenever that differs from the instruction before it
 func (c *Compiler) addInstruction(ins []byte) int {
-	posNewInstruction := len(c.instructions)
-	c.instructions = append(c.instructions, ins...)
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+
+	lines := c.scopes[c.scopeIndex].lines
+	if c.position.Line != 0 && (len(lines) == 0 || lines[len(lines)-1].Position != c.position) {
+		entry := code.LineEntry{Offset: posNewInstruction, Position: c.position}
+		c.scopes[c.scopeIndex].lines = append(lines, entry)
+	}
+
 	return posNewInstruction
 }
 
 // setLastInstruction assigns the last and second last instructions
 func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
-	previous := c.lastInstruction
+	previous := c.scopes[c.scopeIndex].lastInstruction
 	last := EmittedInstruction{Opcode: op, Position: pos}
 
-	c.previousInstruction = previous
-	c.lastInstruction = last
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
 }
 
-// lastInstructionIsPop checks if last instruction is OpPop
-func (c *Compiler) lastInstructionIsPop() bool {
-	return c.lastInstruction.Opcode == code.OpPop
+// lastInstructionIs checks if the last instruction emitted in the current scope is op
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
 }
 
 // removeLastPop cuts off the last instruction
 func (c *Compiler) removeLastPop() {
-	c.instructions = c.instructions[:c.lastInstruction.Position]
-	c.lastInstruction = c.previousInstruction
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	lines := c.scopes[c.scopeIndex].lines
+	for len(lines) > 0 && lines[len(lines)-1].Offset >= last.Position {
+		lines = lines[:len(lines)-1]
+	}
+	c.scopes[c.scopeIndex].lines = lines
+}
+
+// replaceLastPopWithReturn turns the trailing OpPop of a function body into an OpReturnValue
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
 }
 
 // replaceInstruction replaces instruction at pos with newInstruction
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
 	for i := 0; i < len(newInstruction); i++ {
-		c.instructions[pos+i] = newInstruction[i]
+		ins[pos+i] = newInstruction[i]
 	}
 }
 
 // changeOperand modifies instruction operands given pos of opCode
 func (c *Compiler) changeOperand(opPos int, operand int) {
-	op := code.Opcode(c.instructions[opPos])
+	op := code.Opcode(c.currentInstructions()[opPos])
 	newInstruction := code.Make(op, operand)
 
 	c.replaceInstruction(opPos, newInstruction)
 }
+
+// compileLogical compiles && and || to jumps, so the right operand is only
+// evaluated when the left one does not decide the result. Both produce a
+// boolean:
+//
+//	a && b:  a; JumpNotTruthy false; b; Bool; Jump end; false: False; end:
+//	a || b:  a; JumpNotTruthy right; True; Jump end; right: b; Bool; end:
+func (c *Compiler) compileLogical(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emitJump(code.OpJumpNotTruthy)
+
+	if node.Operator == "||" {
+		c.emit(code.OpTrue)
+	} else {
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpBool)
+	}
+
+	jumpPos := c.emitJump(code.OpJump)
+	c.patchJump(jumpNotTruthyPos)
+
+	if node.Operator == "||" {
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpBool)
+	} else {
+		c.emit(code.OpFalse)
+	}
+
+	c.patchJump(jumpPos)
+	return nil
+}
+
+// compileTry compiles a try expression. OpTry installs a handler at the
+// catch block for the try block, which leaves its value and removes the
+// handler with OpEndTry. The handler starts with the exception on the stack
+// and binds it to the catch parameter
+func (c *Compiler) compileTry(node *ast.TryExpression) error {
+	tryPos := c.emitJump(code.OpTry)
+
+	err := c.compileBlockValue(node.Block)
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpEndTry)
+	jumpPos := c.emitJump(code.OpJump)
+	c.patchJump(tryPos)
+
+	// The parameter is only visible in the catch block
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	c.storeSymbol(c.symbolTable.Define(node.Param.Value))
+
+	err = c.compileBlockValue(node.Handler)
+
+	c.symbolTable = c.symbolTable.Outer
+	if err != nil {
+		return err
+	}
+
+	c.patchJump(jumpPos)
+	return nil
+}
+
+// emitJump emits a jump with a placeholder target and returns its position for patchJump
+func (c *Compiler) emitJump(op code.Opcode) int {
+	return c.emit(op, 9999)
+}
+
+// patchJump points the jump at pos to the next instruction to be emitted
+func (c *Compiler) patchJump(pos int) {
+	c.changeOperand(pos, len(c.currentInstructions()))
+}
+
+// enterScope starts a new compilation scope and symbol table for a function body
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// leaveScope returns the instructions of the current scope and restores the enclosing one
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+// nodePosition returns the source position of the token that starts node,
+// or of its operator for prefix and infix expressions
+func nodePosition(node ast.Node) (code.Position, bool) {
+	var tok token.Token
+
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		tok = node.Token
+	case *ast.DestructuringLetStatement:
+		tok = node.Token
+	case *ast.AssignStatement:
+		tok = node.Token
+	case *ast.ReturnStatement:
+		tok = node.Token
+	case *ast.ExpressionStatement:
+		tok = node.Token
+	case *ast.WhileStatement:
+		tok = node.Token
+	case *ast.ThrowStatement:
+		tok = node.Token
+	case *ast.TryExpression:
+		tok = node.Token
+	case *ast.SwitchExpression:
+		tok = node.Token
+	case *ast.SpawnExpression:
+		tok = node.Token
+	case *ast.PrefixExpression:
+		tok = node.Token
+	case *ast.InfixExpression:
+		tok = node.Token
+	case *ast.IfExpression:
+		tok = node.Token
+	case *ast.CallExpression:
+		tok = node.Token
+	case *ast.IndexExpression:
+		tok = node.Token
+	case *ast.Identifier:
+		tok = node.Token
+	case *ast.FunctionLiteral:
+		tok = node.Token
+	case *ast.ArrayLiteral:
+		tok = node.Token
+	case *ast.HashLiteral:
+		tok = node.Token
+	case *ast.TupleLiteral:
+		tok = node.Token
+	case *ast.IntegerLiteral:
+		tok = node.Token
+	case *ast.FloatLiteral:
+		tok = node.Token
+	case *ast.StringLiteral:
+		tok = node.Token
+	case *ast.ImportExpression:
+		tok = node.Token
+	case *ast.MacroLiteral:
+		tok = node.Token
+	case *ast.InterpolatedString:
+		tok = node.Token
+	case *ast.Boolean:
+		tok = node.Token
+	}
+
+	if tok.Line == 0 {
+		return code.Position{}, false
+	}
+	return code.Position{Line: tok.Line, Column: tok.Column}, true
+}
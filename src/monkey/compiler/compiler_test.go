@@ -7,6 +7,9 @@ import (
 	"go-compiler/src/monkey/lexer"
 	"go-compiler/src/monkey/object"
 	"go-compiler/src/monkey/parser"
+	"go-compiler/src/monkey/token"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -174,6 +177,63 @@ func TestBooleanExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestBoolCoercion(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "!!1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBool),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "!!!true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpBool),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestUnknownOperators(t *testing.T) {
+	one := &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}
+	two := &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2}
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{
+			&ast.PrefixExpression{Operator: "~", Right: one},
+			"unknown prefix operator: ~",
+		},
+		{
+			&ast.InfixExpression{Left: one, Operator: "%", Right: two},
+			"unknown infix operator: %",
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(tt.node)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -213,50 +273,1899 @@ func TestConditionals(t *testing.T) {
 		},
 	}
 
-	runCompilerTests(t, tests)
+	runCompilerTests(t, tests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let i = 0; while (i < 3) { i = i + 1; i; }
+			`,
+			expectedConstants: []interface{}{0, 3, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),       // 0000
+				code.Make(code.OpSetGlobal, 0),      // 0003
+				code.Make(code.OpConstant, 1),       // 0006
+				code.Make(code.OpGetGlobal, 0),      // 0009
+				code.Make(code.OpGreaterThan),       // 0012
+				code.Make(code.OpJumpNotTruthy, 33), // 0013
+				code.Make(code.OpGetGlobal, 0),      // 0016
+				code.Make(code.OpConstant, 2),       // 0019
+				code.Make(code.OpAdd),               // 0022
+				code.Make(code.OpSetGlobal, 0),      // 0023
+				// The body pops its expression statements
+				code.Make(code.OpGetGlobal, 0), // 0026
+				code.Make(code.OpPop),          // 0029
+				// Jump back to the condition
+				code.Make(code.OpJump, 6), // 0030
+			},
+		},
+		{
+			input: `
+			fn(n) { while (n) { n = false; } }
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),       // 0000
+					code.Make(code.OpJumpNotTruthy, 11), // 0002
+					code.Make(code.OpFalse),             // 0005
+					code.Make(code.OpSetLocal, 0),       // 0006
+					code.Make(code.OpJump, 0),           // 0008
+					code.Make(code.OpReturn),            // 0011
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `try { 1 } catch (e) { e }`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTry, 10),     // 0000
+				code.Make(code.OpConstant, 0), // 0003
+				code.Make(code.OpEndTry),      // 0006
+				code.Make(code.OpJump, 16),    // 0007
+				// The handler stores the exception in its parameter
+				code.Make(code.OpSetGlobal, 0), // 0010
+				code.Make(code.OpGetGlobal, 0), // 0013
+				code.Make(code.OpPop),          // 0016
+			},
+		},
+		{
+			input:             `throw 1;`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpThrow),
+			},
+		},
+		{
+			// A call in the try block is not a tail call, or its frame
+			// would drop the handler
+			input: `fn(f) { try { return f() } catch (e) { f(e) } }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpTry, 13),     // 0000
+					code.Make(code.OpGetLocal, 0), // 0003
+					code.Make(code.OpCall, 0),     // 0005
+					code.Make(code.OpReturnValue), // 0007
+					code.Make(code.OpNull),        // 0008
+					code.Make(code.OpEndTry),      // 0009
+					code.Make(code.OpJump, 21),    // 0010
+					code.Make(code.OpSetLocal, 1), // 0013
+					code.Make(code.OpGetLocal, 0), // 0015
+					code.Make(code.OpGetLocal, 1), // 0017
+					code.Make(code.OpTailCall, 1), // 0019
+					code.Make(code.OpReturnValue), // 0021
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	// The catch parameter is not visible after the catch block
+	err := New().Compile(parse("try { 1 } catch (e) { e }; e"))
+	if err == nil || err.Error() != "line 1, col 28: undefined variable e" {
+		t.Errorf("wrong compiler error: %v", err)
+	}
+}
+
+func TestSpawnExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `spawn fn() { 1 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSpawn),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSwitchExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// Too few values for a jump table, so each is compared in turn
+			input:             `switch (5) { case 1, 2 { 10 } default { 20 } }`,
+			expectedConstants: []interface{}{5, 1, 2, 10, 20},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),       // 0000
+				code.Make(code.OpSetGlobal, 0),      // 0003
+				code.Make(code.OpGetGlobal, 0),      // 0006
+				code.Make(code.OpConstant, 1),       // 0009
+				code.Make(code.OpEqual),             // 0012
+				code.Make(code.OpJumpNotTruthy, 19), // 0013
+				code.Make(code.OpJump, 29),          // 0016
+				code.Make(code.OpGetGlobal, 0),      // 0019
+				code.Make(code.OpConstant, 2),       // 0022
+				code.Make(code.OpEqual),             // 0025
+				code.Make(code.OpJumpNotTruthy, 35), // 0026
+				code.Make(code.OpConstant, 3),       // 0029
+				code.Make(code.OpJump, 38),          // 0032
+				code.Make(code.OpConstant, 4),       // 0035
+				code.Make(code.OpPop),               // 0038
+			},
+		},
+		{
+			// The missing value 3 goes to the default, null here
+			input:             `switch (3) { case 1 { 10 } case 2, 4 { 20 } case 5 { 30 } }`,
+			expectedConstants: []interface{}{3, 10, 20, 30},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),     // 0000
+				code.Make(code.OpJumpTable, 1, 5), // 0003
+				code.Make(code.OpJump, 27),        // 0008
+				code.Make(code.OpJump, 33),        // 0011
+				code.Make(code.OpJump, 23),        // 0014
+				code.Make(code.OpJump, 33),        // 0017
+				code.Make(code.OpJump, 39),        // 0020
+				code.Make(code.OpNull),            // 0023
+				code.Make(code.OpJump, 45),        // 0024
+				code.Make(code.OpConstant, 1),     // 0027
+				code.Make(code.OpJump, 45),        // 0030
+				code.Make(code.OpConstant, 2),     // 0033
+				code.Make(code.OpJump, 45),        // 0036
+				code.Make(code.OpConstant, 3),     // 0039
+				code.Make(code.OpJump, 45),        // 0042
+				code.Make(code.OpPop),             // 0045
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	// Sparse values are compared in turn too
+	compiler := New()
+	err := compiler.Compile(parse(`switch (1) { case 1 { 1 } case 100 { 2 } case 200 { 3 } case 300 { 4 } }`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if strings.Contains(compiler.Bytecode().Instructions.String(), "OpJumpTable") {
+		t.Errorf("jump table for sparse values:\n%s", compiler.Bytecode().Instructions)
+	}
+}
+
+func TestPeepholeKeepsJumpTableEntries(t *testing.T) {
+	ins := concatInstructions([]code.Instructions{
+		code.Make(code.OpJumpTable, 0, 1), // 0000
+		code.Make(code.OpJump, 8),         // 0005
+		code.Make(code.OpNull),            // 0008
+	})
+
+	decoded := decodeInstructions(ins)
+	kept := peephole(decoded, len(ins), false)
+	got, _ := relocate(kept, decoded, len(ins), nil)
+
+	err := testInstructions([]code.Instructions{ins}, got)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`x = 1`, "line 1, col 1: undefined variable x"},
+		{`len = 1`, `line 1, col 1: cannot assign to builtin "len"`},
+		{`fn(a) { fn() { a = 1; } }`, "line 1, col 16: cannot assign to captured variable a"},
+		// Closures copy their free variables when they are made, so a local
+		// they capture cannot be assigned before or after that
+		{`fn() { let x = 1; let g = fn() { x }; x = 2; g() }`, "line 1, col 39: cannot assign to captured variable x"},
+		{`fn() { let x = 1; x = 2; fn() { x } }`, "line 1, col 19: cannot assign to captured variable x"},
+		{`fn() { let x = 1; let g = fn() { x }; let x = 2; g() }`, "line 1, col 39: cannot assign to captured variable x"},
+		{`fn(x) { fn() { fn() { x } }; x = 2 }`, "line 1, col 30: cannot assign to captured variable x"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected compiler error for %q but resulted in none.", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestUnexpandedMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(1 + 2)`, "line 1, col 6: quote is only supported inside macros"},
+		{`fn(x) { unquote(x) }`, "line 1, col 16: unquote is only supported inside macros"},
+		{`let quote = fn(x) { x }; quote(1)`, ""},
+		{`let m = macro(x) { x }`, "line 1, col 9: macros can only be defined by top level let statements"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected compiler error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong compiler error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestNestedConditionalJumps(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			if (true) { if (false) { 10 } else { 20 } } else { 30 }; 3333;
+			`,
+			expectedConstants: []interface{}{10, 20, 30, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 20),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0008
+				code.Make(code.OpConstant, 0),
+				// 0011
+				code.Make(code.OpJump, 17),
+				// 0014
+				code.Make(code.OpConstant, 1),
+				// 0017
+				code.Make(code.OpJump, 23),
+				// 0020
+				code.Make(code.OpConstant, 2),
+				// 0023
+				code.Make(code.OpPop),
+				// 0024
+				code.Make(code.OpConstant, 3),
+				// 0027
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestEmitJumpPatchJump(t *testing.T) {
+	compiler := New()
+
+	pos := compiler.emitJump(code.OpJump)
+	compiler.emit(code.OpTrue)
+	compiler.emit(code.OpPop)
+	compiler.patchJump(pos)
+
+	expected := []code.Instructions{
+		code.Make(code.OpJump, 5),
+		code.Make(code.OpTrue),
+		code.Make(code.OpPop),
+	}
+
+	err := testInstructions(expected, compiler.currentInstructions())
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+}
+
+func TestUnreachableBranches(t *testing.T) {
+	tests := []struct {
+		input                string
+		expectedConstants    []interface{}
+		expectedInstructions []code.Instructions
+		expectedWarnings     int
+	}{
+		{
+			input:             "if (true) { 1 } else { 2 }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+			expectedWarnings: 1,
+		},
+		{
+			input:             "if (false) { 1 } else { 2 }",
+			expectedConstants: []interface{}{2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+			expectedWarnings: 1,
+		},
+		{
+			input:             "if (false) { 1 }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+			expectedWarnings: 1,
+		},
+		{
+			input:             "if (true) { 1 }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+			expectedWarnings: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := NewWithOptions(Options{Optimize: true})
+		err := compiler.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("%s: testInstructions failed: %s", tt.input, err)
+		}
+
+		err = testConstants(t, tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("%s: testConstants failed: %s", tt.input, err)
+		}
+
+		if len(compiler.Warnings()) != tt.expectedWarnings {
+			t.Errorf("%s: wrong number of warnings. want=%d, got=%d (%q)",
+				tt.input, tt.expectedWarnings, len(compiler.Warnings()), compiler.Warnings())
+		}
+	}
+}
+
+func TestConstantFolding(t *testing.T) {
+	tests := []struct {
+		input     string
+		plain     compilerTestCase
+		optimized compilerTestCase
+	}{
+		{
+			input: "1 + 2 * 3",
+			plain: compilerTestCase{
+				expectedConstants: []interface{}{1, 2, 3},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpMul),
+					code.Make(code.OpAdd),
+					code.Make(code.OpPop),
+				},
+			},
+			optimized: compilerTestCase{
+				expectedConstants: []interface{}{7},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "(-(2 - 5) > 1) == !false",
+			plain: compilerTestCase{
+				expectedConstants: []interface{}{2, 5, 1},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSub),
+					code.Make(code.OpMinus),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpGreaterThan),
+					code.Make(code.OpFalse),
+					code.Make(code.OpBang),
+					code.Make(code.OpEqual),
+					code.Make(code.OpPop),
+				},
+			},
+			optimized: compilerTestCase{
+				expectedConstants: []interface{}{},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpTrue),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			// Errors are left for the VM to report
+			input: "1 / 0; 1 == true",
+			plain: compilerTestCase{
+				expectedConstants: []interface{}{1, 0},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpDiv),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTrue),
+					code.Make(code.OpEqual),
+					code.Make(code.OpPop),
+				},
+			},
+			optimized: compilerTestCase{
+				expectedConstants: []interface{}{1, 0},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpDiv),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTrue),
+					code.Make(code.OpEqual),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "let a = 1; a + 2 * 3; if (1 < 2) { a } else { 0 }",
+			plain: compilerTestCase{
+				expectedConstants: []interface{}{1, 2, 3, 0},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),       // 0000
+					code.Make(code.OpSetGlobal, 0),      // 0003
+					code.Make(code.OpGetGlobal, 0),      // 0006
+					code.Make(code.OpConstant, 1),       // 0009
+					code.Make(code.OpConstant, 2),       // 0012
+					code.Make(code.OpMul),               // 0015
+					code.Make(code.OpAdd),               // 0016
+					code.Make(code.OpPop),               // 0017
+					code.Make(code.OpConstant, 1),       // 0018
+					code.Make(code.OpConstant, 0),       // 0021
+					code.Make(code.OpGreaterThan),       // 0024
+					code.Make(code.OpJumpNotTruthy, 34), // 0025
+					code.Make(code.OpGetGlobal, 0),      // 0028
+					code.Make(code.OpJump, 37),          // 0031
+					code.Make(code.OpConstant, 3),       // 0034
+					code.Make(code.OpPop),               // 0037
+				},
+			},
+			optimized: compilerTestCase{
+				expectedConstants: []interface{}{1, 6},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, options := range []Options{{}, {Optimize: true}} {
+			expected := tt.plain
+			if options.Optimize {
+				expected = tt.optimized
+			}
+
+			compiler := NewWithOptions(options)
+			err := compiler.Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("%s: compiler error: %s", tt.input, err)
+			}
+
+			bytecode := compiler.Bytecode()
+
+			err = testInstructions(expected.expectedInstructions, bytecode.Instructions)
+			if err != nil {
+				t.Errorf("%s (%+v): testInstructions failed: %s", tt.input, options, err)
+			}
+
+			err = testConstants(t, expected.expectedConstants, bytecode.Constants)
+			if err != nil {
+				t.Errorf("%s (%+v): testConstants failed: %s", tt.input, options, err)
+			}
+		}
+	}
+}
+
+func TestPeepholeInFunctions(t *testing.T) {
+	input := "fn(a) {\n  1;\n  a;\n  if (a) { 2 };\n  a * 2\n}"
+
+	compiler := NewWithOptions(Options{Optimize: true})
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	fn, ok := compiler.Bytecode().Constants[2].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 2 is not a function. got=%T", compiler.Bytecode().Constants[2])
+	}
+
+	// The popped loads of 1 and a are gone; the if expression's OpPop is a
+	// jump target and stays
+	expected := []code.Instructions{
+		code.Make(code.OpGetLocal, 0),       // 0000
+		code.Make(code.OpJumpNotTruthy, 11), // 0002
+		code.Make(code.OpConstant, 1),       // 0005
+		code.Make(code.OpJump, 12),          // 0008
+		code.Make(code.OpNull),              // 0011
+		code.Make(code.OpPop),               // 0012
+		code.Make(code.OpGetLocal, 0),       // 0013
+		code.Make(code.OpConstant, 1),       // 0015
+		code.Make(code.OpMul),               // 0018
+		code.Make(code.OpReturnValue),       // 0019
+	}
+
+	err = testInstructions(expected, fn.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	// Line entries follow the instructions they moved with
+	pos, ok := fn.Lines.Lookup(0)
+	if !ok || pos != (code.Position{Line: 4, Column: 7}) {
+		t.Errorf("wrong position for the if condition. got=%s (%t)", pos, ok)
+	}
+	pos, ok = fn.Lines.Lookup(18)
+	if !ok || pos != (code.Position{Line: 5, Column: 5}) {
+		t.Errorf("wrong position for OpMul. got=%s (%t)", pos, ok)
+	}
+}
+
+func TestPeepholeDropsJumpsToNextInstruction(t *testing.T) {
+	ins := concatInstructions([]code.Instructions{
+		code.Make(code.OpTrue),             // 0000
+		code.Make(code.OpJumpNotTruthy, 7), // 0001
+		code.Make(code.OpJump, 7),          // 0004
+		code.Make(code.OpNull),             // 0007
+		code.Make(code.OpJump, 11),         // 0008
+		code.Make(code.OpPop),              // 0011
+	})
+	lines := code.LineTable{
+		{Offset: 0, Position: code.Position{Line: 1, Column: 1}},
+		{Offset: 7, Position: code.Position{Line: 2, Column: 1}},
+	}
+
+	decoded := decodeInstructions(ins)
+	kept := peephole(decoded, len(ins), false)
+	got, gotLines := relocate(kept, decoded, len(ins), lines)
+
+	expected := []code.Instructions{
+		code.Make(code.OpTrue),             // 0000
+		code.Make(code.OpJumpNotTruthy, 4), // 0001
+		code.Make(code.OpNull),             // 0004
+		code.Make(code.OpPop),              // 0005
+	}
+
+	err := testInstructions(expected, got)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	expectedLines := code.LineTable{
+		{Offset: 0, Position: code.Position{Line: 1, Column: 1}},
+		{Offset: 4, Position: code.Position{Line: 2, Column: 1}},
+	}
+	if !reflect.DeepEqual(gotLines, expectedLines) {
+		t.Errorf("wrong lines. want=%v, got=%v", expectedLines, gotLines)
+	}
+}
+
+func TestEliminateDeadCode(t *testing.T) {
+	ins := concatInstructions([]code.Instructions{
+		code.Make(code.OpTry, 14),          // 0000
+		code.Make(code.OpGetLocal, 0),      // 0003
+		code.Make(code.OpJumpNotTruthy, 9), // 0005
+		code.Make(code.OpThrow),            // 0008
+		code.Make(code.OpEndTry),           // 0009
+		code.Make(code.OpJump, 18),         // 0010
+		code.Make(code.OpPop),              // 0013 after a jump
+		code.Make(code.OpNull),             // 0014 the handler
+		code.Make(code.OpReturnValue),      // 0015
+		code.Make(code.OpNull),             // 0016 after a return
+		code.Make(code.OpPop),              // 0017
+		code.Make(code.OpReturn),           // 0018
+		code.Make(code.OpReturn),           // 0019 after a return
+	})
+	lines := code.LineTable{
+		{Offset: 0, Position: code.Position{Line: 1, Column: 1}},
+		{Offset: 16, Position: code.Position{Line: 2, Column: 1}},
+		{Offset: 18, Position: code.Position{Line: 3, Column: 1}},
+	}
+
+	decoded := decodeInstructions(ins)
+	got, gotLines := relocate(eliminateDeadCode(decoded), decoded, len(ins), lines)
+
+	expected := []code.Instructions{
+		code.Make(code.OpTry, 13),          // 0000
+		code.Make(code.OpGetLocal, 0),      // 0003
+		code.Make(code.OpJumpNotTruthy, 9), // 0005
+		code.Make(code.OpThrow),            // 0008
+		code.Make(code.OpEndTry),           // 0009
+		code.Make(code.OpJump, 15),         // 0010
+		code.Make(code.OpNull),             // 0013
+		code.Make(code.OpReturnValue),      // 0014
+		code.Make(code.OpReturn),           // 0015
+	}
+
+	err := testInstructions(expected, got)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	expectedLines := code.LineTable{
+		{Offset: 0, Position: code.Position{Line: 1, Column: 1}},
+		{Offset: 15, Position: code.Position{Line: 3, Column: 1}},
+	}
+	if !reflect.DeepEqual(gotLines, expectedLines) {
+		t.Errorf("wrong lines. want=%v, got=%v", expectedLines, gotLines)
+	}
+}
+
+func TestEliminateDeadCodeKeepsJumpTables(t *testing.T) {
+	// The body at 0019 is shadowed by an earlier case, so no entry selects it
+	ins := concatInstructions([]code.Instructions{
+		code.Make(code.OpJumpTable, 0, 2), // 0000
+		code.Make(code.OpJump, 15),        // 0005
+		code.Make(code.OpJump, 15),        // 0008
+		code.Make(code.OpNull),            // 0011 the default
+		code.Make(code.OpJump, 23),        // 0012
+		code.Make(code.OpTrue),            // 0015
+		code.Make(code.OpJump, 23),        // 0016
+		code.Make(code.OpFalse),           // 0019
+		code.Make(code.OpJump, 23),        // 0020
+	})
+
+	decoded := decodeInstructions(ins)
+	got, _ := relocate(eliminateDeadCode(decoded), decoded, len(ins), nil)
+
+	expected := []code.Instructions{
+		code.Make(code.OpJumpTable, 0, 2), // 0000
+		code.Make(code.OpJump, 15),        // 0005
+		code.Make(code.OpJump, 15),        // 0008
+		code.Make(code.OpNull),            // 0011
+		code.Make(code.OpJump, 19),        // 0012
+		code.Make(code.OpTrue),            // 0015
+		code.Make(code.OpJump, 19),        // 0016
+	}
+
+	err := testInstructions(expected, got)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+}
+
+func TestDeadCodeInFunctions(t *testing.T) {
+	input := "fn(a) { if (a) { return 1 } else { return 2 }; 3 }"
+
+	compiler := NewWithOptions(Options{Optimize: true})
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	fn, ok := compiler.Bytecode().Constants[3].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 3 is not a function. got=%T", compiler.Bytecode().Constants[3])
+	}
+
+	// Both branches return, so the jump over the alternative, the OpPop of
+	// the if expression and the trailing 3 are never reached
+	expected := []code.Instructions{
+		code.Make(code.OpGetLocal, 0),      // 0000
+		code.Make(code.OpJumpNotTruthy, 9), // 0002
+		code.Make(code.OpConstant, 0),      // 0005
+		code.Make(code.OpReturnValue),      // 0008
+		code.Make(code.OpConstant, 1),      // 0009
+		code.Make(code.OpReturnValue),      // 0012
+	}
+
+	err = testInstructions(expected, fn.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+}
+
+func TestUnreachableBranchWarningWithoutOptimize(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse("if (true) { 1 } else { 2 }"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	if len(compiler.Warnings()) != 1 {
+		t.Fatalf("wrong number of warnings. want=1, got=%d", len(compiler.Warnings()))
+	}
+
+	// Without optimization both branches are still emitted
+	if compiler.Bytecode().ConstantCount() != 2 {
+		t.Errorf("wrong constant count. want=%d, got=%d", 2, compiler.Bytecode().ConstantCount())
+	}
+}
+
+func TestImmediateIntegers(t *testing.T) {
+	tests := []struct {
+		options              Options
+		expectedConstants    []interface{}
+		expectedInstructions []code.Instructions
+	}{
+		{
+			options:           Options{},
+			expectedConstants: []interface{}{1, 2, 70000},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			options:           Options{ImmediateIntegers: true},
+			expectedConstants: []interface{}{70000},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpLoadImmediate, 1),
+				code.Make(code.OpLoadImmediate, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := NewWithOptions(tt.options)
+		err := compiler.Compile(parse("1 + 2 + 70000"))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("%+v: testInstructions failed: %s", tt.options, err)
+		}
+
+		err = testConstants(t, tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("%+v: testConstants failed: %s", tt.options, err)
+		}
+	}
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let one = 1;
+			let two = 2;
+			`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+		{
+			input: `
+			let one = 1;
+			one
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let one = 1;
+			let two = one;
+			two
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "`a ${1} b ${true}`",
+			expectedConstants: []interface{}{"a ", 1, " b "},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpToString),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpTrue),
+				code.Make(code.OpToString),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "``",
+			expectedConstants: []interface{}{""},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"monkey"`,
+			expectedConstants: []interface{}{"monkey"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"mon", "key"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[]",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2, 3]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1 + 2, 3 - 4, 5 * 6]",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSub),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpMul),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2, 3: 4, 5: 6}",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpHash, 6),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2 + 3, 4: 5 * 6}",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpMul),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, 2, 3][1 + 1]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2}[2 - 1]",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSub),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			len([]);
+			push([], 1);
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetBuiltin, 5),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { len([]) }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpArray, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	compiler := New()
+	symbol, err := compiler.RegisterBuiltin("double", func(args ...object.Object) object.Object {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterBuiltin error: %s", err)
+	}
+
+	expected := Symbol{Name: "double", Scope: BuiltinScope, Index: len(object.Builtins)}
+	if symbol != expected {
+		t.Fatalf("wrong symbol. want=%+v, got=%+v", expected, symbol)
+	}
+
+	err = compiler.Compile(parse("double(1)"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+
+	expectedInstructions := []code.Instructions{
+		code.Make(code.OpGetBuiltin, len(object.Builtins)),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpCall, 1),
+		code.Make(code.OpPop),
+	}
+
+	err = testInstructions(expectedInstructions, bytecode.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	if len(bytecode.Builtins) != len(object.Builtins)+1 {
+		t.Fatalf("wrong number of builtins. want=%d, got=%d",
+			len(object.Builtins)+1, len(bytecode.Builtins))
+	}
+}
+
+func TestRegisterTooManyBuiltins(t *testing.T) {
+	compiler := New()
+	noop := func(args ...object.Object) object.Object { return nil }
+
+	for i := len(object.Builtins); i < MaxBuiltins; i++ {
+		_, err := compiler.RegisterBuiltin(fmt.Sprintf("host%d", i), noop)
+		if err != nil {
+			t.Fatalf("RegisterBuiltin error for builtin %d: %s", i, err)
+		}
+	}
+
+	_, err := compiler.RegisterBuiltin("overflow", noop)
+	want := `cannot register builtin "overflow": more than 256 builtins`
+	if err == nil || err.Error() != want {
+		t.Fatalf("wrong error. want=%q, got=%v", want, err)
+	}
+
+	if _, ok := compiler.symbolTable.Resolve("overflow"); ok {
+		t.Errorf("builtin past the limit was defined")
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { return 5 + 10 }`,
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { 5 + 10 }`,
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { 1; 2 }`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctionCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { 24 }();`,
+			expectedConstants: []interface{}{
+				24,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let manyArg = fn(a, b, c) { a; b; c };
+			manyArg(24, 25, 26);
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpReturnValue),
+				},
+				24,
+				25,
+				26,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpCall, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLetStatementScopes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let num = 55;
+			fn() { num }
+			`,
+			expectedConstants: []interface{}{
+				55,
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn() {
+				let a = 55;
+				let b = 77;
+				a + b
+			}
+			`,
+			expectedConstants: []interface{}{
+				55,
+				77,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn(a, b) { let (x, y) = (b, a); x }
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpArray, 2),
+					code.Make(code.OpDestructure, 2),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpSetLocal, 3),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			fn(a) {
+				fn(b) {
+					a + b
+				}
+			}
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn(a) {
+				fn(b) {
+					fn(c) {
+						a + b + c
+					}
+				}
+			};
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let global = 55;
+
+			fn() {
+				let a = 66;
+
+				fn() {
+					let b = 77;
+
+					fn() {
+						let c = 88;
+
+						global + a + b + c;
+					}
+				}
+			}
+			`,
+			expectedConstants: []interface{}{
+				55,
+				66,
+				77,
+				88,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 4, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 5, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 6, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let countDown = fn(x) { countDown(x - 1); };
+			countDown(1);
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let wrapper = fn() {
+				let countDown = fn(x) { countDown(x - 1); };
+				countDown(1);
+			};
+			wrapper();
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(f) { return f(); }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(f) { if (true) { f() } else { f(1) } }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTrue),
+					// 0001
+					code.Make(code.OpJumpNotTruthy, 11),
+					// 0004
+					code.Make(code.OpGetLocal, 0),
+					// 0006
+					code.Make(code.OpTailCall, 0),
+					// 0008
+					code.Make(code.OpJump, 18),
+					// 0011
+					code.Make(code.OpGetLocal, 0),
+					// 0013
+					code.Make(code.OpConstant, 0),
+					// 0016
+					code.Make(code.OpTailCall, 1),
+					// 0018
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let f = fn() { f() + 1 }; f();`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// importFrom returns an Importer serving the given modules by path
+func importFrom(modules map[string]string) func(path string) (string, error) {
+	return func(path string) (string, error) {
+		src, ok := modules[path]
+		if !ok {
+			return "", fmt.Errorf("no such module")
+		}
+		return src, nil
+	}
+}
+
+func TestImports(t *testing.T) {
+	modules := map[string]string{
+		"m.monkey": `let x = 2; let double = fn(a) { a * 2 };`,
+	}
+
+	compiler := NewWithOptions(Options{Importer: importFrom(modules)})
+	err := compiler.Compile(parse(`let x = 1; let m = import("m.monkey"); import("./m.monkey"); m`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+
+	expectedInstructions := []code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpImport, 5),
+		code.Make(code.OpSetGlobal, 4),
+		code.Make(code.OpImport, 5),
+		code.Make(code.OpPop),
+		code.Make(code.OpGetGlobal, 4),
+		code.Make(code.OpPop),
+	}
+	err = testInstructions(expectedInstructions, bytecode.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	// The module's globals take the slots after the one caching its exports
+	err = testConstants(t, []interface{}{
+		1,
+		2,
+		[]code.Instructions{
+			code.Make(code.OpGetLocal, 0),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpMul),
+			code.Make(code.OpReturnValue),
+		},
+		"x",
+		"double",
+	}, bytecode.Constants[:5])
+	if err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+
+	module, ok := bytecode.Constants[5].(*object.CompiledModule)
+	if !ok {
+		t.Fatalf("constant 5 is not a module: %T", bytecode.Constants[5])
+	}
+	if module.Path != "m.monkey" || module.Slot != 1 {
+		t.Errorf("wrong module. want path %q and slot 1, got=%q and slot %d", "m.monkey", module.Path, module.Slot)
+	}
+
+	err = testInstructions([]code.Instructions{
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpSetGlobal, 2),
+		code.Make(code.OpClosure, 2, 0),
+		code.Make(code.OpSetGlobal, 3),
+		code.Make(code.OpConstant, 3),
+		code.Make(code.OpGetGlobal, 2),
+		code.Make(code.OpConstant, 4),
+		code.Make(code.OpGetGlobal, 3),
+		code.Make(code.OpHash, 4),
+		code.Make(code.OpSetGlobal, 1),
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpReturnValue),
+	}, module.Fn.Instructions)
+	if err != nil {
+		t.Fatalf("module testInstructions failed: %s", err)
+	}
+
+	if n := bytecode.SymbolTable.NumDefinitions(); n != 5 {
+		t.Errorf("wrong number of global slots. want=5, got=%d", n)
+	}
+}
+
+func TestNestedImportsResolveRelativeToTheImporter(t *testing.T) {
+	requested := []string{}
+	importer := func(path string) (string, error) {
+		requested = append(requested, path)
+		if path == "lib/a.monkey" {
+			return `let b = import("b.monkey");`, nil
+		}
+		return `let value = 1;`, nil
+	}
+
+	compiler := NewWithOptions(Options{Importer: importer})
+	err := compiler.Compile(parse(`import("lib/a.monkey")`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	if len(requested) != 2 || requested[0] != "lib/a.monkey" || requested[1] != "lib/b.monkey" {
+		t.Errorf("wrong modules requested. got=%q", requested)
+	}
+}
+
+func TestImportsResolveRelativeToDir(t *testing.T) {
+	requested := []string{}
+	importer := func(path string) (string, error) {
+		requested = append(requested, path)
+		return `let value = 1;`, nil
+	}
+
+	compiler := NewWithOptions(Options{Importer: importer, Dir: "sub"})
+	err := compiler.Compile(parse(`import("lib.monkey"); import("/abs/lib.monkey")`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	if len(requested) != 2 || requested[0] != "sub/lib.monkey" || requested[1] != "/abs/lib.monkey" {
+		t.Errorf("wrong modules requested. got=%q", requested)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	modules := map[string]string{
+		"a.monkey":       `import("b.monkey")`,
+		"b.monkey":       `import("a.monkey")`,
+		"private.monkey": `secret`,
+		"return.monkey":  `return 1;`,
+		"broken.monkey":  `let = 1;`,
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import("a.monkey")`, `import "a.monkey": import "b.monkey": line 1, col 1: import "a.monkey": import cycle`},
+		{`let secret = 1; import("private.monkey")`, `import "private.monkey": line 1, col 1: undefined variable secret`},
+		{`import("return.monkey")`, `import "return.monkey": line 1, col 1: return statement outside of function`},
+		{`import("broken.monkey")`, `import "broken.monkey": parser errors: `},
+		{`import("missing.monkey")`, `line 1, col 1: import "missing.monkey": no such module`},
+	}
+
+	for _, tt := range tests {
+		compiler := NewWithOptions(Options{Importer: importFrom(modules)})
+		err := compiler.Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("%s: expected compiler error", tt.input)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong compiler error. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestCompilerScopes(t *testing.T) {
+	compiler := New()
+	if compiler.scopeIndex != 0 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 0)
+	}
+	globalSymbolTable := compiler.symbolTable
+
+	compiler.emit(code.OpMul)
+
+	compiler.enterScope()
+	if compiler.scopeIndex != 1 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 1)
+	}
+
+	compiler.emit(code.OpSub)
+
+	if len(compiler.scopes[compiler.scopeIndex].instructions) != 1 {
+		t.Errorf("instructions length wrong. got=%d",
+			len(compiler.scopes[compiler.scopeIndex].instructions))
+	}
+
+	last := compiler.scopes[compiler.scopeIndex].lastInstruction
+	if last.Opcode != code.OpSub {
+		t.Errorf("lastInstruction.Opcode wrong. got=%d, want=%d", last.Opcode, code.OpSub)
+	}
+
+	if compiler.symbolTable.Outer != globalSymbolTable {
+		t.Errorf("compiler did not enclose symbolTable")
+	}
+
+	compiler.leaveScope()
+	if compiler.scopeIndex != 0 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 0)
+	}
+
+	if compiler.symbolTable != globalSymbolTable {
+		t.Errorf("compiler did not restore global symbol table")
+	}
+
+	compiler.emit(code.OpAdd)
+
+	if len(compiler.scopes[compiler.scopeIndex].instructions) != 2 {
+		t.Errorf("instructions length wrong. got=%d",
+			len(compiler.scopes[compiler.scopeIndex].instructions))
+	}
+
+	last = compiler.scopes[compiler.scopeIndex].lastInstruction
+	if last.Opcode != code.OpAdd {
+		t.Errorf("lastInstruction.Opcode wrong. got=%d, want=%d", last.Opcode, code.OpAdd)
+	}
+
+	previous := compiler.scopes[compiler.scopeIndex].previousInstruction
+	if previous.Opcode != code.OpMul {
+		t.Errorf("previousInstruction.Opcode wrong. got=%d, want=%d", previous.Opcode, code.OpMul)
+	}
+}
+
+func TestReturnOutsideFunction(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse("return 1;"))
+	if err == nil {
+		t.Fatalf("expected compiler error but resulted in none.")
+	}
+
+	if err.Error() != "line 1, col 1: return statement outside of function" {
+		t.Errorf("wrong compiler error: %q", err)
+	}
 }
 
-func TestGlobalLetStatements(t *testing.T) {
+func TestFailedFunctionLeavesItsScope(t *testing.T) {
+	compiler := New()
+	globalSymbolTable := compiler.symbolTable
+
+	err := compiler.Compile(parse("fn() { fn() { undefined } }"))
+	if err == nil {
+		t.Fatalf("expected compiler error but resulted in none.")
+	}
+
+	if compiler.scopeIndex != 0 || len(compiler.scopes) != 1 {
+		t.Errorf("scopes not left. scopeIndex=%d, scopes=%d", compiler.scopeIndex, len(compiler.scopes))
+	}
+	if compiler.symbolTable != globalSymbolTable {
+		t.Errorf("compiler did not restore global symbol table")
+	}
+}
+
+func TestBlockExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input: `
-			let one = 1;
-			let two = 2;
-			`,
-			expectedConstants: []interface{}{1, 2},
+			input:             `let x = { let y = 2; y * 3 }`,
+			expectedConstants: []interface{}{2, 3},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
 				code.Make(code.OpSetGlobal, 1),
 			},
 		},
 		{
-			input: `
-			let one = 1;
-			one
-			`,
-			expectedConstants: []interface{}{1},
+			input:             `{ let y = 2 }`,
+			expectedConstants: []interface{}{2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpNull),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input: `
-			let one = 1;
-			let two = one;
-			two
-			`,
-			expectedConstants: []interface{}{1},
+			input:             `if (true) { }`,
+			expectedConstants: []interface{}{},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpSetGlobal, 1),
-				code.Make(code.OpGetGlobal, 1),
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpNull),
+				// 0005
+				code.Make(code.OpJump, 9),
+				// 0008
+				code.Make(code.OpNull),
+				// 0009
 				code.Make(code.OpPop),
 			},
 		},
@@ -265,24 +2174,111 @@ func TestGlobalLetStatements(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-func TestStringExpressions(t *testing.T) {
+func TestBlockExpressionScope(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse(`let x = { let y = 2; y * 3 }; y`))
+	if err == nil {
+		t.Fatalf("expected compiler error but resulted in none.")
+	}
+
+	if err.Error() != "line 1, col 31: undefined variable y" {
+		t.Errorf("wrong compiler error: %q", err)
+	}
+}
+
+func TestDestructuring(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input:             `"monkey"`,
-			expectedConstants: []interface{}{"monkey"},
+			input:             `let (x, y) = (1, 2)`,
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpDestructure, 2),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
 			},
 		},
+	}
+
+	runCompilerTests(t, tests)
+
+	compiler := New()
+	err := compiler.Compile(parse(`let (x, y) = (1, 2, 3)`))
+	if err == nil {
+		t.Fatalf("expected compiler error but resulted in none.")
+	}
+
+	if err.Error() != "line 1, col 1: cannot destructure 3 values into 2 names" {
+		t.Errorf("wrong compiler error: %q", err)
+	}
+}
+
+func TestRedefiningBuiltinsAndKeywords(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let len = 5", `line 1, col 1: cannot redefine builtin or keyword "len"`},
+		{"let (a, push) = (1, 2)", `line 1, col 1: cannot redefine builtin or keyword "push"`},
+		{"let length = 5", ""},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected compiler error: %s", tt.input, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Fatalf("%s: expected compiler error but resulted in none.", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong compiler error. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+
+	// Keywords never reach the compiler as names through the parser
+	let := &ast.LetStatement{
+		Token: token.Token{Type: token.LET, Literal: "let"},
+		Name:  &ast.Identifier{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: "true"},
+		Value: &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "3"}, Value: 3},
+	}
+
+	err := New().Compile(let)
+	if err == nil || err.Error() != `cannot redefine builtin or keyword "true"` {
+		t.Errorf("wrong compiler error for keyword. got=%v", err)
+	}
+}
+
+func TestShadowingDoesNotCapture(t *testing.T) {
+	tests := []compilerTestCase{
 		{
-			input:             `"mon" + "key"`,
-			expectedConstants: []interface{}{"mon", "key"},
+			// Checking the inner a against the builtins must not capture the outer one
+			input: `let f = fn(a) { fn() { let a = 1; a } }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpAdd),
-				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 0),
 			},
 		},
 	}
@@ -290,41 +2286,73 @@ func TestStringExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-func TestArrayLiterals(t *testing.T) {
+func TestStringInterning(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input:             "[]",
-			expectedConstants: []interface{}{},
+			input:             `"hi" == "hi"`,
+			expectedConstants: []interface{}{"hi"},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpEqual),
 				code.Make(code.OpPop),
 			},
 		},
+	}
+
+	runCompilerTests(t, tests)
+
+	compiler := New()
+	err := compiler.Compile(parse(`"hi"; "there"; "hi"`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	constants := compiler.Bytecode().Constants
+	if len(constants) != 2 {
+		t.Fatalf("wrong number of constants. got=%d, want=%d", len(constants), 2)
+	}
+
+	// A compiler continuing from existing state reuses the interned strings
+	next := NewWithState(compiler.symbolTable, constants)
+	err = next.Compile(parse(`"hi"`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	if len(next.Bytecode().Constants) != 2 {
+		t.Errorf("string was not interned across compilers. got=%d constants",
+			len(next.Bytecode().Constants))
+	}
+}
+
+func TestFloatLiterals(t *testing.T) {
+	tests := []compilerTestCase{
 		{
-			input:             "[1, 2, 3]",
-			expectedConstants: []interface{}{1, 2, 3},
+			input:             "1.5 + 2; 1.5 * 0.5; -1.5",
+			expectedConstants: []interface{}{1.5, 2, 0.5},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 2),
-				code.Make(code.OpArray, 3),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "[1 + 2, 3 - 4, 5 * 6]",
-			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			// A whole float is not shared with the integer of the same value
+			input:             "2.0; 2",
+			expectedConstants: []interface{}{2.0, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpAdd),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpSub),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpMul),
-				code.Make(code.OpArray, 3),
 				code.Make(code.OpPop),
 			},
 		},
@@ -333,85 +2361,241 @@ func TestArrayLiterals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-func TestHashLiterals(t *testing.T) {
+func TestComparisonAndLogicalOperators(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input:             "{}",
-			expectedConstants: []interface{}{},
+			input:             "1 <= 2; 1 >= 2",
+			expectedConstants: []interface{}{2, 1},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpHash, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterThanOrEqual),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpGreaterThanOrEqual),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "{1: 2, 3: 4, 5: 6}",
-			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			input:             "true && false",
+			expectedConstants: []interface{}{},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpHash, 6),
-				code.Make(code.OpPop),
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 9), // 0001
+				code.Make(code.OpFalse),            // 0004
+				code.Make(code.OpBool),             // 0005
+				code.Make(code.OpJump, 10),         // 0006
+				code.Make(code.OpFalse),            // 0009
+				code.Make(code.OpPop),              // 0010
 			},
 		},
 		{
-			input:             "{1: 2 + 3, 4: 5 * 6}",
-			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			input:             "false || true",
+			expectedConstants: []interface{}{},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpAdd),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpMul),
-				code.Make(code.OpHash, 4),
-				code.Make(code.OpPop),
+				code.Make(code.OpFalse),            // 0000
+				code.Make(code.OpJumpNotTruthy, 8), // 0001
+				code.Make(code.OpTrue),             // 0004
+				code.Make(code.OpJump, 10),         // 0005
+				code.Make(code.OpTrue),             // 0008
+				code.Make(code.OpBool),             // 0009
+				code.Make(code.OpPop),              // 0010
 			},
 		},
 	}
 
 	runCompilerTests(t, tests)
+
+	compiler := NewWithOptions(Options{Optimize: true})
+	err := compiler.Compile(parse("1 <= 2 && 3 >= 4 || !(2 >= 2)"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = testInstructions([]code.Instructions{code.Make(code.OpFalse), code.Make(code.OpPop)},
+		compiler.Bytecode().Instructions)
+	if err != nil {
+		t.Errorf("logical expression of constants was not folded: %s", err)
+	}
 }
 
-func TestIndexEspressions(t *testing.T) {
+func TestConstantDeduplication(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input:             "[1, 2, 3][1 + 1]",
-			expectedConstants: []interface{}{1, 2, 3, 1, 1},
+			input:             "1 + 1 + 1",
+			expectedConstants: []interface{}{1},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpArray, 3),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpAdd),
-				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "{1: 2}[2 - 1]",
-			expectedConstants: []interface{}{1, 2, 2, 1},
+			// Equal values of different types are kept apart
+			input:             `[1, "1", 1, "1"]`,
+			expectedConstants: []interface{}{1, "1"},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpHash, 2),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpSub),
-				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 4),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { 1 }; fn() { 1 }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			},
 		},
 	}
 
 	runCompilerTests(t, tests)
+
+	// Integers already in the pool are reused by a compiler continuing from it,
+	// so REPL sessions do not grow the pool for repeated literals
+	compiler := New()
+	err := compiler.Compile(parse("let x = 10; x + 10"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	constants := compiler.Bytecode().Constants
+	for i := 0; i < 3; i++ {
+		next := NewWithState(compiler.symbolTable, constants)
+		err = next.Compile(parse("x * 10"))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		constants = next.Bytecode().Constants
+	}
+
+	if len(constants) != 1 {
+		t.Errorf("integer was not deduplicated across compilers. got=%d constants", len(constants))
+	}
+}
+
+func TestBytecodeConstants(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse(`1 + "two"`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+
+	if bytecode.ConstantCount() != 2 {
+		t.Fatalf("wrong constant count. want=%d, got=%d", 2, bytecode.ConstantCount())
+	}
+
+	constant, ok := bytecode.Constant(0)
+	if !ok {
+		t.Fatalf("constant 0 not found")
+	}
+	if err := testIntegerObject(1, constant); err != nil {
+		t.Errorf("constant 0 - testIntegerObject failed: %s", err)
+	}
+
+	constant, ok = bytecode.Constant(1)
+	if !ok {
+		t.Fatalf("constant 1 not found")
+	}
+	if err := testStringObject("two", constant); err != nil {
+		t.Errorf("constant 1 - testStringObject failed: %s", err)
+	}
+
+	for _, i := range []int{-1, 2, 100} {
+		constant, ok := bytecode.Constant(i)
+		if ok || constant != nil {
+			t.Errorf("expected no constant at %d. got=%+v", i, constant)
+		}
+	}
+}
+
+func TestBytecodeString(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse(`let f = fn(a) { a + 1 }; f("x")`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := `Instructions:
+0000 OpClosure 1 0
+0004 OpSetGlobal 0
+0007 OpGetGlobal 0
+0010 OpConstant 2
+0013 OpCall 1
+0015 OpPop
+
+Constants:
+0000 INTEGER 1
+0001 COMPILED_FUNCTION_OBJ locals=1 parameters=1
+     0000 OpGetLocal 0
+     0002 OpConstant 0
+     0005 OpAdd
+     0006 OpReturnValue
+0002 STRING "x"
+`
+
+	if got := compiler.Bytecode().String(); got != expected {
+		t.Errorf("bytecode wrongly formatted.\nwant=%s\ngot=%s", expected, got)
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	input := "let a = 1;\nlet f = fn(x) {\n  x[0]\n};\na + 2"
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	expected := code.LineTable{
+		{Offset: 0, Position: code.Position{Line: 1, Column: 9}},  // OpConstant 1
+		{Offset: 3, Position: code.Position{Line: 1, Column: 1}},  // OpSetGlobal a
+		{Offset: 6, Position: code.Position{Line: 2, Column: 9}},  // OpClosure
+		{Offset: 10, Position: code.Position{Line: 2, Column: 1}}, // OpSetGlobal f
+		{Offset: 13, Position: code.Position{Line: 5, Column: 1}}, // OpGetGlobal a
+		{Offset: 16, Position: code.Position{Line: 5, Column: 5}}, // OpConstant 2
+		{Offset: 19, Position: code.Position{Line: 5, Column: 3}}, // OpAdd
+		{Offset: 20, Position: code.Position{Line: 5, Column: 1}}, // OpPop
+	}
+
+	if !reflect.DeepEqual(bytecode.Lines, expected) {
+		t.Errorf("wrong main line table.\nwant=%v\ngot =%v", expected, bytecode.Lines)
+	}
+
+	fn, ok := bytecode.Constants[2].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 2 is not a function. got=%T", bytecode.Constants[2])
+	}
+
+	// OpIndex is located at the [ of x[0]
+	pos, ok := fn.Lines.Lookup(len(fn.Instructions) - 2)
+	if !ok || pos != (code.Position{Line: 3, Column: 4}) {
+		t.Errorf("wrong position for OpIndex. got=%s (%t)\n%v", pos, ok, fn.Lines)
+	}
 }
 
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
@@ -497,12 +2681,30 @@ func testConstants(
 				return fmt.Errorf("constant %d - testIntegerObject failed: %s",
 					i, err)
 			}
+		case float64:
+			err := testFloatObject(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testFloatObject failed: %s",
+					i, err)
+			}
 		case string:
 			err := testStringObject(constant, actual[i])
 			if err != nil {
 				return fmt.Errorf("constant %d - testStringObject failed: %s",
 					i, err)
 			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T",
+					i, actual[i])
+			}
+
+			err := testInstructions(constant, fn.Instructions)
+			if err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s",
+					i, err)
+			}
 		}
 	}
 	return nil
@@ -522,6 +2724,20 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value.  got=%g, want=%g", result.Value, expected)
+	}
+
+	return nil
+}
+
 func testStringObject(expected string, actual object.Object) error {
 	result, ok := actual.(*object.String)
 	if !ok {
@@ -0,0 +1,126 @@
+package compiler
+
+import (
+	"fmt"
+	"go-compiler/src/monkey/ast"
+	"go-compiler/src/monkey/code"
+	"go-compiler/src/monkey/evaluator"
+	"go-compiler/src/monkey/lexer"
+	"go-compiler/src/monkey/object"
+	"go-compiler/src/monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compileImport compiles the imported module the first time its path is seen
+// and emits an OpImport of it
+func (c *Compiler) compileImport(node *ast.ImportExpression) error {
+	path := node.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.moduleDir, path)
+	}
+	path = filepath.Clean(path)
+
+	index, ok := c.modules[path]
+	if !ok {
+		var err error
+		index, err = c.compileModule(path)
+		if err != nil {
+			return fmt.Errorf("import %q: %w", node.Path, err)
+		}
+	}
+
+	c.emit(code.OpImport, index)
+	return nil
+}
+
+// compileModule compiles the module at path into a CompiledModule constant
+// and returns its index.
+//
+// The module's top level is compiled like a function body, but with a global
+// table of its own: its globals take slots in the program's globals store
+// without clashing with the importer's names. The function ends by collecting
+// the globals into a hash of exports, which is cached in a hidden global slot
+func (c *Compiler) compileModule(path string) (int, error) {
+	if c.importing[path] {
+		return 0, fmt.Errorf("import cycle")
+	}
+
+	importer := c.options.Importer
+	if importer == nil {
+		importer = readModule
+	}
+
+	src, err := importer(path)
+	if err != nil {
+		return 0, err
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return 0, fmt.Errorf("parser errors: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	program, err = evaluator.ExpandProgram(program)
+	if err != nil {
+		return 0, fmt.Errorf("macro expansion failed: %s", err)
+	}
+
+	globals := c.symbolTable.globalTable()
+	slot := globals.nextIndex()
+
+	symbolTable, moduleDir := c.symbolTable, c.moduleDir
+	c.symbolTable = NewModuleSymbolTable(globals)
+	c.moduleDir = filepath.Dir(path)
+	c.importing[path] = true
+	c.scopes = append(c.scopes, CompilationScope{module: true})
+	c.scopeIndex++
+
+	defer func() {
+		c.symbolTable, c.moduleDir = symbolTable, moduleDir
+		delete(c.importing, path)
+	}()
+
+	err = c.Compile(program)
+	if err != nil {
+		c.scopes = c.scopes[:len(c.scopes)-1]
+		c.scopeIndex--
+		return 0, err
+	}
+
+	exports := c.symbolTable.Globals()
+	for _, symbol := range exports {
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: symbol.Name}))
+		c.emit(code.OpGetGlobal, symbol.Index)
+	}
+	c.emit(code.OpHash, len(exports)*2)
+	c.emit(code.OpSetGlobal, slot)
+	c.emit(code.OpGetGlobal, slot)
+	c.emit(code.OpReturnValue)
+
+	lines := c.scopes[c.scopeIndex].lines
+	instructions := c.currentInstructions()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	module := &object.CompiledModule{
+		Path: path,
+		Fn:   &object.CompiledFunction{Instructions: instructions, Lines: lines},
+		Slot: slot,
+	}
+	index := c.addConstant(module)
+	c.modules[path] = index
+
+	return index, nil
+}
+
+// readModule is the default Importer, reading the module from disk
+func readModule(path string) (string, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(src), nil
+}
@@ -0,0 +1,352 @@
+package compiler
+
+import (
+	"go-compiler/src/monkey/ast"
+	"go-compiler/src/monkey/code"
+	"go-compiler/src/monkey/object"
+)
+
+// foldConstant evaluates expressions built only from integer and boolean
+// literals, following the VM's semantics for each operator. Expressions the
+// VM would reject, like mixed operand types or division by zero, are not
+// folded so they still fail at runtime
+func foldConstant(node ast.Expression) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return object.NewInteger(node.Value), true
+
+	case *ast.Boolean:
+		return nativeBool(node.Value), true
+
+	case *ast.PrefixExpression:
+		right, ok := foldConstant(node.Right)
+		if !ok {
+			return nil, false
+		}
+
+		switch node.Operator {
+		case "!":
+			// Every value other than false is truthy
+			return nativeBool(right == object.FALSE), true
+		case "-":
+			if integer, ok := right.(*object.Integer); ok {
+				return object.NewInteger(-integer.Value), true
+			}
+		}
+
+	case *ast.InfixExpression:
+		left, ok := foldConstant(node.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := foldConstant(node.Right)
+		if !ok {
+			return nil, false
+		}
+
+		switch node.Operator {
+		case "&&":
+			return nativeBool(left != object.FALSE && right != object.FALSE), true
+		case "||":
+			return nativeBool(left != object.FALSE || right != object.FALSE), true
+		}
+
+		leftInt, leftIsInt := left.(*object.Integer)
+		rightInt, rightIsInt := right.(*object.Integer)
+		if leftIsInt && rightIsInt {
+			return foldIntegers(node.Operator, leftInt.Value, rightInt.Value)
+		}
+
+		if !leftIsInt && !rightIsInt {
+			switch node.Operator {
+			case "==":
+				return nativeBool(left == right), true
+			case "!=":
+				return nativeBool(left != right), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func foldIntegers(operator string, left, right int64) (object.Object, bool) {
+	switch operator {
+	case "+":
+		return object.NewInteger(left + right), true
+	case "-":
+		return object.NewInteger(left - right), true
+	case "*":
+		return object.NewInteger(left * right), true
+	case "/":
+		if right == 0 {
+			return nil, false
+		}
+		return object.NewInteger(left / right), true
+	case "<":
+		return nativeBool(left < right), true
+	case ">":
+		return nativeBool(left > right), true
+	case "<=":
+		return nativeBool(left <= right), true
+	case ">=":
+		return nativeBool(left >= right), true
+	case "==":
+		return nativeBool(left == right), true
+	case "!=":
+		return nativeBool(left != right), true
+	}
+
+	return nil, false
+}
+
+func nativeBool(value bool) *object.Boolean {
+	if value {
+		return object.TRUE
+	}
+	return object.FALSE
+}
+
+// instruction is a decoded instruction of a scope being optimized
+type instruction struct {
+	offset   int
+	op       code.Opcode
+	operands []int
+}
+
+// pureLoads push a value without any other effect, so popping it straight
+// away can be dropped along with the load
+var pureLoads = map[code.Opcode]bool{
+	code.OpConstant:      true,
+	code.OpLoadImmediate: true,
+	code.OpTrue:          true,
+	code.OpFalse:         true,
+	code.OpNull:          true,
+	code.OpGetGlobal:     true,
+	code.OpGetLocal:      true,
+	code.OpGetFree:       true,
+	code.OpGetBuiltin:    true,
+
+	code.OpCurrentClosure: true,
+}
+
+// optimizeScope drops the unreachable instructions of the scope being compiled
+// and runs the peephole pass over the rest. Values popped in the main scope
+// stay, since the last one is the program's result
+func (c *Compiler) optimizeScope(inFunction bool) {
+	scope := &c.scopes[c.scopeIndex]
+
+	decoded := decodeInstructions(scope.instructions)
+	kept := peephole(eliminateDeadCode(decoded), len(scope.instructions), inFunction)
+	scope.instructions, scope.lines = relocate(kept, decoded, len(scope.instructions), scope.lines)
+
+	// Keep lastInstructionIs accurate for anything emitted after the pass
+	final := decodeInstructions(scope.instructions)
+	scope.lastInstruction = EmittedInstruction{}
+	scope.previousInstruction = EmittedInstruction{}
+	if n := len(final); n > 0 {
+		scope.lastInstruction = EmittedInstruction{Opcode: final[n-1].op, Position: final[n-1].offset}
+	}
+	if n := len(final); n > 1 {
+		scope.previousInstruction = EmittedInstruction{Opcode: final[n-2].op, Position: final[n-2].offset}
+	}
+}
+
+func decodeInstructions(ins code.Instructions) []instruction {
+	decoded := []instruction{}
+
+	for offset := 0; offset < len(ins); {
+		op := code.Opcode(ins[offset])
+		operands, read := code.ReadOperandsOf(op, ins[offset+1:])
+		decoded = append(decoded, instruction{offset: offset, op: op, operands: operands})
+		offset += 1 + read
+	}
+
+	return decoded
+}
+
+// peephole returns the instructions worth keeping: jumps to the very next
+// instruction are dropped, and in functions so are pure loads that are popped
+// straight away
+func peephole(decoded []instruction, end int, inFunction bool) []instruction {
+	targets := map[int]bool{}
+	entries := map[int]bool{}
+	for i, ins := range decoded {
+		if ins.op == code.OpJump || ins.op == code.OpJumpNotTruthy || ins.op == code.OpTry {
+			targets[ins.operands[0]] = true
+		}
+		if ins.op == code.OpJumpTable {
+			for _, entry := range decoded[i+1 : i+1+ins.operands[1]] {
+				entries[entry.offset] = true
+			}
+		}
+	}
+
+	kept := []instruction{}
+	for i := 0; i < len(decoded); i++ {
+		ins := decoded[i]
+
+		next := end
+		if i+1 < len(decoded) {
+			next = decoded[i+1].offset
+		}
+
+		// Jump table entries are found by position, so all of them stay
+		if ins.op == code.OpJump && ins.operands[0] == next && !entries[ins.offset] {
+			continue
+		}
+
+		// A jump landing on the OpPop still needs the value it pops
+		if inFunction && pureLoads[ins.op] && i+1 < len(decoded) &&
+			decoded[i+1].op == code.OpPop && !targets[decoded[i+1].offset] {
+			i++
+			continue
+		}
+
+		kept = append(kept, ins)
+	}
+
+	return kept
+}
+
+// eliminateDeadCode returns the instructions reachable from the start of the
+// scope, following jumps, catch handlers and jump table entries, so code after
+// a return, a throw or an unconditional jump is dropped
+func eliminateDeadCode(decoded []instruction) []instruction {
+	index := make(map[int]int, len(decoded))
+	for i, ins := range decoded {
+		index[ins.offset] = i
+	}
+
+	reachable := make([]bool, len(decoded))
+	work := []int{0}
+
+	// A jump to the end of the scope leaves it, so only targets inside count
+	jumpTo := func(offset int) {
+		if i, ok := index[offset]; ok {
+			work = append(work, i)
+		}
+	}
+
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		if i >= len(decoded) || reachable[i] {
+			continue
+		}
+		reachable[i] = true
+
+		ins := decoded[i]
+		switch ins.op {
+		case code.OpJump:
+			jumpTo(ins.operands[0])
+		case code.OpJumpNotTruthy, code.OpTry:
+			jumpTo(ins.operands[0])
+			work = append(work, i+1)
+		case code.OpJumpTable:
+			// Each entry is a jump of its own, and a value outside the
+			// table falls through to the default after them
+			for entry := i + 1; entry <= i+1+ins.operands[1]; entry++ {
+				work = append(work, entry)
+			}
+		case code.OpReturnValue, code.OpReturn, code.OpThrow:
+		default:
+			work = append(work, i+1)
+		}
+	}
+
+	live := make([]instruction, 0, len(decoded))
+	for i, ins := range decoded {
+		if reachable[i] {
+			live = append(live, ins)
+		}
+	}
+
+	return live
+}
+
+// markTailCalls turns every OpCall whose result is returned straight away,
+// by the next instruction or through jumps landing on an OpReturnValue, into
+// an OpTailCall so the callee reuses the returning function's frame. Calls
+// in try blocks are left alone
+func markTailCalls(ins code.Instructions) {
+	decoded := decodeInstructions(ins)
+
+	index := make(map[int]int, len(decoded))
+	for i, d := range decoded {
+		index[d.offset] = i
+	}
+
+	// returns follows jumps from decoded[i], giving up after visiting every
+	// instruction once so a jump cycle cannot loop forever
+	returns := func(i int) bool {
+		for steps := 0; i < len(decoded) && steps < len(decoded); steps++ {
+			switch decoded[i].op {
+			case code.OpReturnValue:
+				return true
+			case code.OpJump:
+				next, ok := index[decoded[i].operands[0]]
+				if !ok {
+					return false
+				}
+				i = next
+			default:
+				return false
+			}
+		}
+		return false
+	}
+
+	// A call in a try block must keep the frame holding its handler
+	handlerEnd := 0
+	for i, d := range decoded {
+		if d.op == code.OpTry && d.operands[0] > handlerEnd {
+			handlerEnd = d.operands[0]
+		}
+		if d.op == code.OpCall && d.offset >= handlerEnd && returns(i+1) {
+			ins[d.offset] = byte(code.OpTailCall)
+		}
+	}
+}
+
+// relocate re-encodes the kept instructions, pointing jumps and line entries
+// at the new offsets. A target whose instruction was dropped moves to the
+// next instruction that was kept
+func relocate(kept, decoded []instruction, end int, lines code.LineTable) (code.Instructions, code.LineTable) {
+	newOffsets := map[int]int{}
+
+	offset := 0
+	k := 0
+	for _, ins := range decoded {
+		newOffsets[ins.offset] = offset
+		if k < len(kept) && kept[k].offset == ins.offset {
+			offset += len(code.Make(ins.op, ins.operands...))
+			k++
+		}
+	}
+	newOffsets[end] = offset
+
+	instructions := code.Instructions{}
+	newLines := code.LineTable{}
+
+	for _, ins := range kept {
+		operands := ins.operands
+		if ins.op == code.OpJump || ins.op == code.OpJumpNotTruthy || ins.op == code.OpTry {
+			operands = []int{newOffsets[operands[0]]}
+		}
+
+		if pos, ok := lines.Lookup(ins.offset); ok {
+			if n := len(newLines); n == 0 || newLines[n-1].Position != pos {
+				newLines = append(newLines, code.LineEntry{Offset: len(instructions), Position: pos})
+			}
+		}
+
+		instructions = append(instructions, code.Make(ins.op, operands...)...)
+	}
+
+	if len(lines) == 0 {
+		newLines = nil
+	}
+	return instructions, newLines
+}
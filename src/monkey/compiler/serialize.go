@@ -0,0 +1,311 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"go-compiler/src/monkey/code"
+	"go-compiler/src/monkey/object"
+	"io"
+	"math"
+)
+
+// BytecodeVersion is bumped whenever the serialized layout or the opcode set changes
+const BytecodeVersion = 10
+
+// bytecodeMagic opens every serialized Bytecode
+var bytecodeMagic = [4]byte{'M', 'B', 'C', 0}
+
+// Tags identifying the type of each serialized constant
+const (
+	tagInteger byte = iota + 1
+	tagString
+	tagCompiledFunction
+	tagFloat
+	tagCompiledModule
+)
+
+// Encode writes the instructions, line tables, constant pool and global names of b to w.
+//
+// All numbers are big endian. The layout is the magic "MBC\x00", a uint16
+// version, the main instructions and lines, the constants and finally the globals:
+//
+//	instructions := uint32 length, bytes
+//	lines        := uint32 count, { uint32 offset, uint32 line, uint32 column }
+//	constants    := uint32 count, { byte tag, payload }
+//	globals      := uint16 slots, uint16 count, { uint16 index, string name }
+//	string       := uint32 length, bytes
+//
+// Integer payloads are an int64, floats a float64, strings a string and compiled functions a
+// uint16 NumLocals, uint16 NumParameters, their instructions and lines. Compiled modules
+// are their path as a string, a uint16 Slot and the instructions and lines of their function.
+func (b *Bytecode) Encode(w io.Writer) error {
+	e := &encoder{w: bufio.NewWriter(w)}
+
+	e.write(bytecodeMagic)
+	e.write(uint16(BytecodeVersion))
+	e.writeBytes(b.Instructions)
+	e.writeLines(b.Lines)
+
+	e.write(uint32(len(b.Constants)))
+	for _, c := range b.Constants {
+		e.writeConstant(c)
+	}
+
+	e.writeGlobals(b.SymbolTable)
+
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// Decode reads Bytecode written by Encode. The builtins are those of the running
+// binary, and the symbol table holds the builtins and the encoded globals.
+func Decode(r io.Reader) (*Bytecode, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+
+	var magic [4]byte
+	d.read(&magic)
+	if d.err != nil || magic != bytecodeMagic {
+		return nil, fmt.Errorf("not a monkey bytecode file")
+	}
+
+	var version uint16
+	d.read(&version)
+	if d.err == nil && version != BytecodeVersion {
+		return nil, fmt.Errorf("unsupported bytecode version: %d, want=%d", version, BytecodeVersion)
+	}
+
+	instructions := code.Instructions(d.readBytes())
+	lines := d.readLines()
+
+	var count uint32
+	d.read(&count)
+	constants := []object.Object{}
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		constants = append(constants, d.readConstant())
+	}
+
+	symbolTable := NewSymbolTable()
+	builtins := []*object.Builtin{}
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+		builtins = append(builtins, v.Builtin)
+	}
+	d.readGlobals(symbolTable)
+
+	if d.err != nil {
+		return nil, fmt.Errorf("malformed bytecode: %s", d.err)
+	}
+
+	return &Bytecode{
+		Instructions: instructions,
+		Lines:        lines,
+		Constants:    constants,
+		SymbolTable:  symbolTable,
+		Builtins:     builtins,
+	}, nil
+}
+
+// encoder writes big endian values, keeping the first error so callers check once
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (e *encoder) write(v interface{}) {
+	if e.err != nil {
+		return
+	}
+	e.err = binary.Write(e.w, binary.BigEndian, v)
+}
+
+func (e *encoder) writeBytes(b []byte) {
+	e.write(uint32(len(b)))
+	e.write(b)
+}
+
+func (e *encoder) writeConstant(obj object.Object) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.write(tagInteger)
+		e.write(obj.Value)
+
+	case *object.Float:
+		e.write(tagFloat)
+		e.write(obj.Value)
+
+	case *object.String:
+		e.write(tagString)
+		e.writeBytes([]byte(obj.Value))
+
+	case *object.CompiledFunction:
+		e.write(tagCompiledFunction)
+		e.write(uint16(obj.NumLocals))
+		e.write(uint16(obj.NumParameters))
+		e.writeBytes(obj.Instructions)
+		e.writeLines(obj.Lines)
+
+	case *object.CompiledModule:
+		e.write(tagCompiledModule)
+		e.writeBytes([]byte(obj.Path))
+		e.write(uint16(obj.Slot))
+		e.writeBytes(obj.Fn.Instructions)
+		e.writeLines(obj.Fn.Lines)
+
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("cannot serialize constant of type %s", obj.Type())
+		}
+	}
+}
+
+func (e *encoder) writeLines(lines code.LineTable) {
+	e.write(uint32(len(lines)))
+	for _, entry := range lines {
+		e.write(uint32(entry.Offset))
+		e.write(uint32(entry.Position.Line))
+		e.write(uint32(entry.Position.Column))
+	}
+}
+
+// writeGlobals records the global slots in use and the names bound to them,
+// so functions of a decoded program can still be looked up by name
+func (e *encoder) writeGlobals(s *SymbolTable) {
+	if s == nil {
+		e.write(uint16(0))
+		e.write(uint16(0))
+		return
+	}
+
+	// Slots are counted in 16 bits, so the last slot of a full globals
+	// store cannot be encoded
+	if s.numDefinitions > math.MaxUint16 {
+		if e.err == nil {
+			e.err = fmt.Errorf("cannot serialize %d global slots, more than %d", s.numDefinitions, math.MaxUint16)
+		}
+		return
+	}
+
+	globals := s.Globals()
+
+	e.write(uint16(s.numDefinitions))
+	e.write(uint16(len(globals)))
+	for _, symbol := range globals {
+		e.write(uint16(symbol.Index))
+		e.writeBytes([]byte(symbol.Name))
+	}
+}
+
+// decoder mirrors encoder, turning a short read into io.ErrUnexpectedEOF
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) read(v interface{}) {
+	if d.err != nil {
+		return
+	}
+	d.err = binary.Read(d.r, binary.BigEndian, v)
+	if d.err == io.EOF {
+		d.err = io.ErrUnexpectedEOF
+	}
+}
+
+func (d *decoder) readBytes() []byte {
+	var length uint32
+	d.read(&length)
+	if d.err != nil {
+		return nil
+	}
+
+	// Copy rather than allocate length bytes up front, so a corrupt length
+	// fails on the short read instead of a huge allocation
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(length)); err != nil {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	return buf.Bytes()
+}
+
+func (d *decoder) readConstant() object.Object {
+	var tag byte
+	d.read(&tag)
+	if d.err != nil {
+		return nil
+	}
+
+	switch tag {
+	case tagInteger:
+		var value int64
+		d.read(&value)
+		return object.NewInteger(value)
+
+	case tagFloat:
+		var value float64
+		d.read(&value)
+		return &object.Float{Value: value}
+
+	case tagString:
+		return &object.String{Value: string(d.readBytes())}
+
+	case tagCompiledFunction:
+		var numLocals, numParameters uint16
+		d.read(&numLocals)
+		d.read(&numParameters)
+		return &object.CompiledFunction{
+			Instructions:  d.readBytes(),
+			Lines:         d.readLines(),
+			NumLocals:     int(numLocals),
+			NumParameters: int(numParameters),
+		}
+
+	case tagCompiledModule:
+		path := string(d.readBytes())
+		var slot uint16
+		d.read(&slot)
+		return &object.CompiledModule{
+			Path: path,
+			Fn:   &object.CompiledFunction{Instructions: d.readBytes(), Lines: d.readLines()},
+			Slot: int(slot),
+		}
+	}
+
+	d.err = fmt.Errorf("unknown constant tag %d", tag)
+	return nil
+}
+
+func (d *decoder) readLines() code.LineTable {
+	var count uint32
+	d.read(&count)
+
+	var lines code.LineTable
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		var offset, line, column uint32
+		d.read(&offset)
+		d.read(&line)
+		d.read(&column)
+
+		entry := code.LineEntry{Offset: int(offset), Position: code.Position{Line: int(line), Column: int(column)}}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func (d *decoder) readGlobals(s *SymbolTable) {
+	var slots, count uint16
+	d.read(&slots)
+	d.read(&count)
+
+	for i := uint16(0); i < count && d.err == nil; i++ {
+		var index uint16
+		d.read(&index)
+		name := string(d.readBytes())
+		s.store[name] = Symbol{Name: name, Index: int(index), Scope: GlobalScope}
+	}
+	s.numDefinitions = int(slots)
+}
@@ -0,0 +1,191 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"go-compiler/src/monkey/object"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	input := `
+	let greeting = "hello";
+	let big = 100000;
+	let ratio = 0.25;
+	let adder = fn(a) { fn(b) { a + b + big } };
+	adder(1)(2);
+	`
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	original := compiler.Bytecode()
+
+	var buf bytes.Buffer
+	if err := original.Encode(&buf); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	if !bytes.Equal(decoded.Instructions, original.Instructions) {
+		t.Errorf("wrong instructions.\nwant=%q\ngot =%q", original.Instructions, decoded.Instructions)
+	}
+
+	if !reflect.DeepEqual(decoded.Lines, original.Lines) {
+		t.Errorf("wrong lines.\nwant=%v\ngot =%v", original.Lines, decoded.Lines)
+	}
+
+	if len(decoded.Constants) != len(original.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d",
+			len(original.Constants), len(decoded.Constants))
+	}
+
+	for i, want := range original.Constants {
+		got := decoded.Constants[i]
+
+		switch want := want.(type) {
+		case *object.Integer:
+			if err := testIntegerObject(want.Value, got); err != nil {
+				t.Errorf("constant %d - testIntegerObject failed: %s", i, err)
+			}
+
+		case *object.Float:
+			if err := testFloatObject(want.Value, got); err != nil {
+				t.Errorf("constant %d - testFloatObject failed: %s", i, err)
+			}
+
+		case *object.String:
+			if err := testStringObject(want.Value, got); err != nil {
+				t.Errorf("constant %d - testStringObject failed: %s", i, err)
+			}
+
+		case *object.CompiledFunction:
+			fn, ok := got.(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("constant %d - not a function: %T", i, got)
+				continue
+			}
+			if !bytes.Equal(fn.Instructions, want.Instructions) || !reflect.DeepEqual(fn.Lines, want.Lines) ||
+				fn.NumLocals != want.NumLocals || fn.NumParameters != want.NumParameters {
+				t.Errorf("constant %d - wrong function. want=%+v, got=%+v", i, want, fn)
+			}
+		}
+	}
+
+	for _, name := range []string{"greeting", "big", "adder", "len"} {
+		want, _ := original.SymbolTable.Resolve(name)
+		got, ok := decoded.SymbolTable.Resolve(name)
+		if !ok || got != want {
+			t.Errorf("wrong symbol for %s. want=%+v, got=%+v", name, want, got)
+		}
+	}
+
+	if len(decoded.Builtins) != len(object.Builtins) {
+		t.Errorf("wrong number of builtins. want=%d, got=%d", len(object.Builtins), len(decoded.Builtins))
+	}
+}
+
+func TestEncodeDecodeModules(t *testing.T) {
+	importer := importFrom(map[string]string{"m.monkey": "let x = 1;\nlet y = x + 1;"})
+
+	compiler := NewWithOptions(Options{Importer: importer})
+	err := compiler.Compile(parse(`import("m.monkey")["y"]`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	original := compiler.Bytecode()
+
+	var buf bytes.Buffer
+	if err := original.Encode(&buf); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	want := original.Constants[len(original.Constants)-1].(*object.CompiledModule)
+	got, ok := decoded.Constants[len(decoded.Constants)-1].(*object.CompiledModule)
+	if !ok {
+		t.Fatalf("last constant is not a module: %T", decoded.Constants[len(decoded.Constants)-1])
+	}
+
+	if got.Path != want.Path || got.Slot != want.Slot || !bytes.Equal(got.Fn.Instructions, want.Fn.Instructions) ||
+		!reflect.DeepEqual(got.Fn.Lines, want.Fn.Lines) {
+		t.Errorf("wrong module. want=%+v, got=%+v", want, got)
+	}
+
+	if decoded.SymbolTable.NumDefinitions() != original.SymbolTable.NumDefinitions() {
+		t.Errorf("wrong number of global slots. want=%d, got=%d",
+			original.SymbolTable.NumDefinitions(), decoded.SymbolTable.NumDefinitions())
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse(`let a = "abc"; a`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := compiler.Bytecode().Encode(&buf); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	valid := buf.Bytes()
+
+	newerVersion := append([]byte{}, valid...)
+	newerVersion[5] = BytecodeVersion + 1
+
+	tests := []struct {
+		input    []byte
+		expected string
+	}{
+		{[]byte("let a = 1;"), "not a monkey bytecode file"},
+		{[]byte{}, "not a monkey bytecode file"},
+		{newerVersion, fmt.Sprintf("unsupported bytecode version: %d, want=%d", BytecodeVersion+1, BytecodeVersion)},
+		{valid[:len(valid)-2], "malformed bytecode: unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.input))
+		if err == nil {
+			t.Errorf("expected error %q. got none", tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestEncodeTooManyGlobals(t *testing.T) {
+	symbolTable := NewSymbolTable()
+	for i := 0; i <= math.MaxUint16; i++ {
+		symbolTable.Define(fmt.Sprintf("g%d", i))
+	}
+	bytecode := &Bytecode{SymbolTable: symbolTable}
+
+	err := bytecode.Encode(&bytes.Buffer{})
+	if err == nil || err.Error() != "cannot serialize 65536 global slots, more than 65535" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestEncodeUnsupportedConstant(t *testing.T) {
+	bytecode := &Bytecode{Constants: []object.Object{object.TRUE}}
+
+	err := bytecode.Encode(&bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "cannot serialize constant of type BOOLEAN") {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package compiler
+
+import (
+	"go-compiler/src/monkey/ast"
+	"go-compiler/src/monkey/code"
+	"math"
+)
+
+// minJumpTableCases is the fewest case values worth a jump table rather than
+// a chain of comparisons
+const minJumpTableCases = 4
+
+// switchValue names the slot holding the value a jump chain compares against
+const switchValue = "switch"
+
+// compileSwitch compiles a switch expression into a jump table when its case
+// values are dense small integers, and a chain of comparisons otherwise.
+// Either way the body that runs leaves its value on the stack
+func (c *Compiler) compileSwitch(node *ast.SwitchExpression) error {
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+
+	if min, targets, ok := jumpTable(node); ok {
+		return c.compileJumpTable(node, min, targets)
+	}
+	return c.compileJumpChain(node)
+}
+
+// jumpTable returns the smallest case value and, for it and each value up
+// to the largest, the index of the case it selects or -1 for the default,
+// if the values are integer literals dense enough for a jump table
+func jumpTable(node *ast.SwitchExpression) (int, []int, bool) {
+	cases := map[int64]int{}
+	min, max := int64(math.MaxInt64), int64(-1)
+
+	for i, sc := range node.Cases {
+		for _, v := range sc.Values {
+			lit, ok := v.(*ast.IntegerLiteral)
+			if !ok || lit.Value < 0 || lit.Value > math.MaxUint16 {
+				return 0, nil, false
+			}
+
+			// The first case with a value is the one that runs
+			if _, seen := cases[lit.Value]; !seen {
+				cases[lit.Value] = i
+			}
+			if lit.Value < min {
+				min = lit.Value
+			}
+			if lit.Value > max {
+				max = lit.Value
+			}
+		}
+	}
+
+	span := max - min + 1
+	if len(cases) < minJumpTableCases || span > 2*int64(len(cases)) || span > math.MaxUint16 {
+		return 0, nil, false
+	}
+
+	targets := make([]int, span)
+	for i := range targets {
+		target, ok := cases[min+int64(i)]
+		if !ok {
+			target = -1
+		}
+		targets[i] = target
+	}
+	return int(min), targets, true
+}
+
+// compileJumpTable emits an OpJumpTable followed by an OpJump for each of
+// targets. The default, or null, comes straight after the table, where the
+// VM continues when the value is not in it
+func (c *Compiler) compileJumpTable(node *ast.SwitchExpression, min int, targets []int) error {
+	c.emit(code.OpJumpTable, min, len(targets))
+
+	entries := make([]int, len(targets))
+	for i := range targets {
+		entries[i] = c.emitJump(code.OpJump)
+	}
+
+	defaultPos := len(c.currentInstructions())
+	err := c.compileSwitchDefault(node)
+	if err != nil {
+		return err
+	}
+	ends := []int{c.emitJump(code.OpJump)}
+
+	bodies := make([]int, len(node.Cases))
+	for i, sc := range node.Cases {
+		bodies[i] = len(c.currentInstructions())
+
+		err := c.compileBlockValue(sc.Body)
+		if err != nil {
+			return err
+		}
+		ends = append(ends, c.emitJump(code.OpJump))
+	}
+
+	for i, target := range targets {
+		if target < 0 {
+			c.changeOperand(entries[i], defaultPos)
+		} else {
+			c.changeOperand(entries[i], bodies[target])
+		}
+	}
+	for _, pos := range ends {
+		c.patchJump(pos)
+	}
+
+	return nil
+}
+
+// compileJumpChain stores the switch value in a hidden slot and compares it
+// with each case value in turn, jumping to the body of the first match
+func (c *Compiler) compileJumpChain(node *ast.SwitchExpression) error {
+	// The slot is allocated from a block that is left straight away, so no
+	// name resolves to it, while the cases run in the enclosing scope like
+	// the branches of an if expression
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	value := c.symbolTable.Define(switchValue)
+	c.symbolTable = c.symbolTable.Outer
+
+	c.storeSymbol(value)
+
+	ends := []int{}
+	for _, sc := range node.Cases {
+		matches := []int{}
+		next := 0
+
+		for i, v := range sc.Values {
+			c.loadSymbol(value)
+			err := c.Compile(v)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpEqual)
+
+			if i == len(sc.Values)-1 {
+				next = c.emitJump(code.OpJumpNotTruthy)
+				break
+			}
+
+			skip := c.emitJump(code.OpJumpNotTruthy)
+			matches = append(matches, c.emitJump(code.OpJump))
+			c.patchJump(skip)
+		}
+
+		for _, pos := range matches {
+			c.patchJump(pos)
+		}
+
+		err := c.compileBlockValue(sc.Body)
+		if err != nil {
+			return err
+		}
+		ends = append(ends, c.emitJump(code.OpJump))
+		c.patchJump(next)
+	}
+
+	err := c.compileSwitchDefault(node)
+	if err != nil {
+		return err
+	}
+
+	for _, pos := range ends {
+		c.patchJump(pos)
+	}
+	return nil
+}
+
+// compileSwitchDefault compiles the default case, or null without one
+func (c *Compiler) compileSwitchDefault(node *ast.SwitchExpression) error {
+	if node.Default == nil {
+		c.emit(code.OpNull)
+		return nil
+	}
+	return c.compileBlockValue(node.Default)
+}
@@ -1,9 +1,18 @@
 package compiler
 
+import (
+	"go-compiler/src/monkey/code"
+	"sort"
+)
+
 type SymbolScope string
 
 const (
-	GlobalScope SymbolScope = "Global"
+	GlobalScope   SymbolScope = "Global"
+	LocalScope    SymbolScope = "Local"
+	BuiltinScope  SymbolScope = "Builtin"
+	FreeScope     SymbolScope = "Free"
+	FunctionScope SymbolScope = "Function"
 )
 
 type Symbol struct {
@@ -13,8 +22,33 @@ type Symbol struct {
 }
 
 type SymbolTable struct {
+	Outer *SymbolTable
+
+	// FreeSymbols are the enclosing function's symbols captured by this one, in capture order
+	FreeSymbols []Symbol
+
 	store          map[string]Symbol
 	numDefinitions int
+	numBuiltins    int
+
+	// block tables only limit the visibility of names;
+	// their slots are allocated from the outer table
+	block bool
+
+	// globals owns the slots of a module's globals, which share the
+	// program's globals store without seeing the names defined in it
+	globals *SymbolTable
+
+	// captured and assigned record the local slots of a function that inner
+	// functions capture and the first assignment after each slot's let
+	captured map[int]bool
+	assigned map[int]assignment
+}
+
+// assignment locates an assignment to a local
+type assignment struct {
+	name     string
+	position code.Position
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -22,14 +56,212 @@ func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{store: s}
 }
 
+// NewEnclosedSymbolTable creates a table for the locals of a function nested in outer
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewModuleSymbolTable creates the global table of an imported module. Its
+// slots are allocated from globals, and it starts with globals' builtins
+func NewModuleSymbolTable(globals *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.globals = globals
+
+	for name, symbol := range globals.store {
+		if symbol.Scope == BuiltinScope {
+			s.DefineBuiltin(symbol.Index, name)
+		}
+	}
+	return s
+}
+
+// NewBlockSymbolTable creates a table whose names are only visible inside a block
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	s.block = true
+	return s
+}
+
 func (s *SymbolTable) Define(name string) Symbol {
-	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: GlobalScope}
+	symbol := Symbol{Name: name, Index: s.nextIndex(), Scope: s.scope()}
 	s.store[name] = symbol
+	return symbol
+}
+
+// Redefine defines name for a let statement, reporting whether the table
+// already defined it. Such a name keeps its slot, so a repeated let rebinds
+// the variable as in the evaluator, also for code compiled before it like the
+// condition of a loop
+func (s *SymbolTable) Redefine(name string) (Symbol, bool) {
+	if symbol, ok := s.store[name]; ok && symbol.Scope == s.scope() {
+		return symbol, true
+	}
+	return s.Define(name), false
+}
+
+// scope returns the scope of names defined in the table: global at the top level,
+// local inside a function, and that of the owning table for blocks
+func (s *SymbolTable) scope() SymbolScope {
+	if s.block {
+		return s.Outer.scope()
+	}
+
+	if s.Outer == nil {
+		return GlobalScope
+	}
+	return LocalScope
+}
+
+// nextIndex allocates the next slot from the table that owns the storage
+func (s *SymbolTable) nextIndex() int {
+	if s.block {
+		return s.Outer.nextIndex()
+	}
+	if s.globals != nil {
+		return s.globals.nextIndex()
+	}
+
+	index := s.numDefinitions
 	s.numDefinitions++
+	return index
+}
+
+// owner returns the table owning the slots of the names defined in s
+func (s *SymbolTable) owner() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
+
+// assign records an assignment at position to a local symbol
+func (s *SymbolTable) assign(symbol Symbol, position code.Position) {
+	if symbol.Scope != LocalScope {
+		return
+	}
+
+	owner := s.owner()
+	if owner.assigned == nil {
+		owner.assigned = map[int]assignment{}
+	}
+	if _, ok := owner.assigned[symbol.Index]; !ok {
+		owner.assigned[symbol.Index] = assignment{name: symbol.Name, position: position}
+	}
+}
+
+// capturedAssignment returns the first assignment to a local that an inner
+// function captures. Closures hold copies of their free variables, so they
+// would not see the assignment
+func (s *SymbolTable) capturedAssignment() (assignment, bool) {
+	var first assignment
+	found := false
+
+	for index, a := range s.assigned {
+		if !s.captured[index] {
+			continue
+		}
+		p := a.position
+		if !found || p.Line < first.position.Line || (p.Line == first.position.Line && p.Column < first.position.Column) {
+			first, found = a, true
+		}
+	}
+	return first, found
+}
+
+// globalTable returns the table owning the program's global slots
+func (s *SymbolTable) globalTable() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	if s.globals != nil {
+		return s.globals
+	}
+	return s
+}
+
+// NumDefinitions returns the number of slots allocated in the table's storage
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
+
+// Globals returns the global symbols defined in the table, ordered by index
+func (s *SymbolTable) Globals() []Symbol {
+	globals := []Symbol{}
+	for _, symbol := range s.store {
+		if symbol.Scope == GlobalScope {
+			globals = append(globals, symbol)
+		}
+	}
+	sort.Slice(globals, func(i, j int) bool { return globals[i].Index < globals[j].Index })
+
+	return globals
+}
+
+// DefineFunctionName binds name to the function whose body the table holds,
+// so the function can call itself before its let statement has stored it
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
 	return symbol
 }
 
+// DefineBuiltin binds name to the builtin at index in the VM's builtins
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	if index >= s.numBuiltins {
+		s.numBuiltins = index + 1
+	}
+	return symbol
+}
+
+// Resolve looks name up through the enclosing tables. A local of an enclosing
+// function is captured as a free symbol of the function resolving it.
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
-	return obj, ok
+	if ok || s.Outer == nil {
+		return obj, ok
+	}
+
+	obj, ok = s.Outer.Resolve(name)
+	if !ok {
+		return obj, ok
+	}
+
+	if s.block || obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+		return obj, ok
+	}
+
+	return s.defineFree(obj), true
+}
+
+// peek resolves name like Resolve, but without capturing it as a free
+// variable, for checks that only need to know what the name refers to
+func (s *SymbolTable) peek(name string) (Symbol, bool) {
+	for table := s; table != nil; table = table.Outer {
+		if obj, ok := table.store[name]; ok {
+			return obj, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// defineFree records original as captured from the enclosing function
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	if original.Scope == LocalScope {
+		owner := s.Outer.owner()
+		if owner.captured == nil {
+			owner.captured = map[int]bool{}
+		}
+		owner.captured[original.Index] = true
+	}
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
 }
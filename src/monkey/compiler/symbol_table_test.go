@@ -43,3 +43,308 @@ func TestResolveGlobal(t *testing.T) {
 		}
 	}
 }
+
+func TestDefineResolveBuiltins(t *testing.T) {
+	global := NewSymbolTable()
+
+	expected := []Symbol{
+		Symbol{Name: "a", Scope: BuiltinScope, Index: 0},
+		Symbol{Name: "c", Scope: BuiltinScope, Index: 1},
+		Symbol{Name: "e", Scope: BuiltinScope, Index: 2},
+		Symbol{Name: "f", Scope: BuiltinScope, Index: 3},
+	}
+
+	for i, v := range expected {
+		global.DefineBuiltin(i, v.Name)
+	}
+
+	for _, sym := range expected {
+		result, ok := global.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if global.numBuiltins != len(expected) {
+		t.Errorf("wrong numBuiltins. want=%d, got=%d", len(expected), global.numBuiltins)
+	}
+}
+
+func TestBlockSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	block := NewBlockSymbolTable(global)
+	b := block.Define("b")
+
+	expected := Symbol{Name: "b", Scope: GlobalScope, Index: 1}
+	if b != expected {
+		t.Errorf("expected b=%+v, got=%+v", expected, b)
+	}
+
+	if _, ok := block.Resolve("a"); !ok {
+		t.Errorf("name a not resolvable from block")
+	}
+
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("name b resolvable outside of block")
+	}
+
+	// Slots used by the block are not reused by the outer table
+	c := global.Define("c")
+	if c.Index != 2 {
+		t.Errorf("expected c to have index 2, got=%d", c.Index)
+	}
+}
+
+func TestDefineLocal(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": Symbol{Name: "a", Scope: GlobalScope, Index: 0},
+		"c": Symbol{Name: "c", Scope: LocalScope, Index: 0},
+		"d": Symbol{Name: "d", Scope: LocalScope, Index: 1},
+		"e": Symbol{Name: "e", Scope: LocalScope, Index: 0},
+	}
+
+	global := NewSymbolTable()
+	firstLocal := NewEnclosedSymbolTable(global)
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+
+	defined := map[string]Symbol{
+		"a": global.Define("a"),
+		"c": firstLocal.Define("c"),
+		"d": firstLocal.Define("d"),
+		"e": secondLocal.Define("e"),
+	}
+
+	for name, want := range expected {
+		if defined[name] != want {
+			t.Errorf("expected %s=%+v, got=%+v", name, want, defined[name])
+		}
+	}
+}
+
+func TestResolveLocal(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("c")
+
+	expected := []Symbol{
+		Symbol{Name: "a", Scope: GlobalScope, Index: 0},
+		Symbol{Name: "len", Scope: BuiltinScope, Index: 0},
+		Symbol{Name: "c", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := local.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+}
+
+func TestBlockSymbolTableInFunction(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+	local.Define("a")
+
+	block := NewBlockSymbolTable(local)
+	b := block.Define("b")
+
+	expected := Symbol{Name: "b", Scope: LocalScope, Index: 1}
+	if b != expected {
+		t.Errorf("expected b=%+v, got=%+v", expected, b)
+	}
+
+	if local.numDefinitions != 2 {
+		t.Errorf("block slot not counted by the function. numDefinitions=%d", local.numDefinitions)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	expected := []Symbol{
+		Symbol{Name: "a", Scope: GlobalScope, Index: 0},
+		Symbol{Name: "c", Scope: FreeScope, Index: 0},
+		Symbol{Name: "e", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	expectedFree := []Symbol{
+		Symbol{Name: "c", Scope: LocalScope, Index: 0},
+	}
+
+	if len(secondLocal.FreeSymbols) != len(expectedFree) {
+		t.Fatalf("wrong number of free symbols. got=%d, want=%d",
+			len(secondLocal.FreeSymbols), len(expectedFree))
+	}
+
+	for i, sym := range expectedFree {
+		if secondLocal.FreeSymbols[i] != sym {
+			t.Errorf("wrong free symbol. got=%+v, want=%+v", secondLocal.FreeSymbols[i], sym)
+		}
+	}
+}
+
+func TestPeekDoesNotCapture(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("a")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+
+	expected := []Symbol{
+		Symbol{Name: "len", Scope: BuiltinScope, Index: 0},
+		Symbol{Name: "a", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.peek(sym.Name)
+		if !ok || result != sym {
+			t.Errorf("expected %s to peek as %+v, got=%+v (%t)", sym.Name, sym, result, ok)
+		}
+	}
+
+	if _, ok := secondLocal.peek("b"); ok {
+		t.Errorf("undefined name b peeked as defined")
+	}
+	if len(secondLocal.FreeSymbols) != 0 {
+		t.Errorf("peek captured free symbols. got=%+v", secondLocal.FreeSymbols)
+	}
+}
+
+func TestResolveFreeThroughBlock(t *testing.T) {
+	global := NewSymbolTable()
+	outer := NewEnclosedSymbolTable(global)
+	block := NewBlockSymbolTable(outer)
+	block.Define("x")
+
+	inner := NewEnclosedSymbolTable(block)
+
+	result, ok := inner.Resolve("x")
+	if !ok {
+		t.Fatalf("name x not resolvable")
+	}
+
+	expected := Symbol{Name: "x", Scope: FreeScope, Index: 0}
+	if result != expected {
+		t.Errorf("expected x to resolve to %+v, got=%+v", expected, result)
+	}
+
+	// The block itself doesn't capture anything
+	if len(block.FreeSymbols) != 0 {
+		t.Errorf("block captured free symbols: %+v", block.FreeSymbols)
+	}
+}
+
+func TestDefineAndResolveFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineFunctionName("a")
+
+	expected := Symbol{Name: "a", Scope: FunctionScope, Index: 0}
+
+	result, ok := global.Resolve(expected.Name)
+	if !ok {
+		t.Fatalf("function name %s not resolvable", expected.Name)
+	}
+
+	if result != expected {
+		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
+	}
+}
+
+func TestShadowingFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineFunctionName("a")
+	global.Define("a")
+
+	expected := Symbol{Name: "a", Scope: GlobalScope, Index: 0}
+
+	result, ok := global.Resolve(expected.Name)
+	if !ok {
+		t.Fatalf("function name %s not resolvable", expected.Name)
+	}
+
+	if result != expected {
+		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
+	}
+}
+
+func TestRedefine(t *testing.T) {
+	local := NewEnclosedSymbolTable(NewSymbolTable())
+	local.Define("a")
+	local.DefineFunctionName("f")
+	block := NewBlockSymbolTable(local)
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+		rebound  bool
+	}{
+		{local, "a", Symbol{Name: "a", Scope: LocalScope, Index: 0}, true},
+		{local, "b", Symbol{Name: "b", Scope: LocalScope, Index: 1}, false},
+		{local, "f", Symbol{Name: "f", Scope: LocalScope, Index: 2}, false},
+		{block, "a", Symbol{Name: "a", Scope: LocalScope, Index: 3}, false},
+		{block, "a", Symbol{Name: "a", Scope: LocalScope, Index: 3}, true},
+	}
+
+	for _, tt := range tests {
+		result, rebound := tt.table.Redefine(tt.name)
+		if result != tt.expected || rebound != tt.rebound {
+			t.Errorf("expected %s to redefine as %+v (rebound=%t), got=%+v (rebound=%t)",
+				tt.name, tt.expected, tt.rebound, result, rebound)
+		}
+	}
+}
+
+func TestResolveUnresolvableFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	for _, name := range []string{"b", "d"} {
+		_, ok := secondLocal.Resolve(name)
+		if ok {
+			t.Errorf("name %s resolved, but was expected not to", name)
+		}
+	}
+}
@@ -1,16 +1,18 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"go-compiler/src/monkey/ast"
 	"go-compiler/src/monkey/object"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
 // Eval evaluates the given AST Node
@@ -24,7 +26,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return Eval(node.Expression, env)
 
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return object.NewInteger(node.Value)
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
@@ -37,6 +42,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
+
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -51,9 +60,32 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
 
+	case *ast.BlockExpression:
+		result := evalBlockStatement(node.Block, object.NewEnclosedEnvironment(env))
+		if result == nil {
+			return NULL
+		}
+		return result
+
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
+	case *ast.SwitchExpression:
+		return evalSwitchExpression(node, env)
+
+	case *ast.SpawnExpression:
+		return evalSpawnExpression(node, env)
+
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return &object.Error{Message: "uncaught exception: " + val.Inspect(), Value: val}
+
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
@@ -68,6 +100,25 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		env.Set(node.Name.Value, val)
 
+	case *ast.AssignStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if _, ok := env.Assign(node.Name.Value, val); !ok {
+			return newError("identifier not found: " + node.Name.Value)
+		}
+
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.DestructuringLetStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return evalDestructuring(node.Names, val, env)
+
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
@@ -76,7 +127,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		body := node.Body
 		return &object.Function{Parameters: params, Env: env, Body: body}
 
+	case *ast.MacroLiteral:
+		return newError("macros can only be defined by top level let statements")
+
 	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments to quote. got=%d, want=1", len(node.Arguments))
+			}
+			return quote(node.Arguments[0], env)
+		}
+
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
@@ -91,6 +152,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
+	case *ast.ImportExpression:
+		return newError("import is only supported by the compiler")
+
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
+
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
@@ -99,6 +166,14 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 		return &object.Array{Elements: elements}
 
+	case *ast.TupleLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+
+		return &object.Array{Elements: elements}
+
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -118,8 +193,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	return nil
 }
 
-// evalProgram evaluates an AST Program Node
+// evalProgram evaluates an AST Program Node. Like the compiler, it rejects a
+// return statement outside of a function before running any of the program
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	if returnOutsideFunction(program) {
+		return newError("return statement outside of function")
+	}
+
 	var result object.Object
 
 	for _, statement := range program.Statements {
@@ -138,6 +218,35 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
+// returnOutsideFunction reports whether program has a return statement that
+// is not in the body of a function literal
+func returnOutsideFunction(program *ast.Program) bool {
+	returns := []ast.Node{}
+	inFunction := map[ast.Node]bool{}
+
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.ReturnStatement:
+			returns = append(returns, node)
+		case *ast.FunctionLiteral:
+			ast.Modify(node.Body, func(inner ast.Node) ast.Node {
+				if _, ok := inner.(*ast.ReturnStatement); ok {
+					inFunction[inner] = true
+				}
+				return inner
+			})
+		}
+		return node
+	})
+
+	for _, r := range returns {
+		if !inFunction[r] {
+			return true
+		}
+	}
+	return false
+}
+
 // nativeBoolToBooleanObject returns corresponding Boolean object
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
@@ -175,13 +284,14 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 // evalMinusOperatorExpression evaluates prefix expression inolving (-)
 func evalMinusOperatorExpression(right object.Object) object.Object {
 
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return object.NewInteger(-right.Value)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
-
 }
 
 // evalInfixExpression evaluates infix expressions
@@ -191,6 +301,8 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 		return evalIntegerInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
@@ -210,17 +322,60 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return object.NewInteger(leftVal + rightVal)
+	case "-":
+		return object.NewInteger(leftVal - rightVal)
+	case "*":
+		return object.NewInteger(leftVal * rightVal)
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return object.NewInteger(leftVal / rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalFloatInfixExpression evaluates Infix Expressions on numbers where at
+// least one is a Float, promoting an Integer operand to Float
+func evalFloatInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+
+	leftVal, _ := object.FloatValue(left)
+	rightVal, _ := object.FloatValue(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return &object.Float{Value: leftVal - rightVal}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return &object.Float{Value: leftVal * rightVal}
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -230,21 +385,71 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 	}
 }
 
-// evalStringInfixExpression returns string concatenated string
+func isNumber(obj object.Object) bool {
+	_, ok := object.FloatValue(obj)
+	return ok
+}
+
+// evalStringInfixExpression concatenates or compares strings
 func evalStringInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
 
-	// TODO: Add string comparisons (== and !=)
 	switch operator {
 	case "+":
 		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unkown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
+// evalInterpolatedString concatenates the text and stringified expressions of a backtick string
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	var out strings.Builder
+
+	for _, part := range node.Parts {
+		value := Eval(part, env)
+		if isError(value) {
+			return value
+		}
+
+		if str, ok := value.(*object.String); ok {
+			out.WriteString(str.Value)
+		} else {
+			out.WriteString(value.Inspect())
+		}
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+// evalLogicalExpression evaluates && and ||, only evaluating the right operand
+// when the left one does not decide the boolean result
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 // evalIfExpression evaluates an if conditional expression
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
@@ -261,6 +466,111 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
+// evalTryExpression evaluates the try block, or the catch block with its
+// parameter bound to the exception when the try block fails
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Block, env)
+
+	err, ok := result.(*object.Error)
+	if !ok {
+		if result == nil {
+			return NULL
+		}
+		return result
+	}
+
+	// A thrown value is caught as itself and any other error as its message,
+	// since error objects cannot be passed around without aborting evaluation
+	var exception object.Object = &object.String{Value: err.Message}
+	if err.Value != nil {
+		exception = err.Value
+	}
+
+	handlerEnv := object.NewEnclosedEnvironment(env)
+	handlerEnv.Set(te.Param.Value, exception)
+
+	result = Eval(te.Handler, handlerEnv)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// evalSpawnExpression starts the spawned function on a goroutine and returns a
+// channel that receives its result, or the error it fails with
+func evalSpawnExpression(se *ast.SpawnExpression, env *object.Environment) object.Object {
+	fn := Eval(se.Function, env)
+	if isError(fn) {
+		return fn
+	}
+
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return newError("cannot spawn %s", fn.Type())
+	}
+	if len(function.Parameters) != 0 {
+		return newError("spawned function must take no arguments, takes %d", len(function.Parameters))
+	}
+
+	result := object.NewChannel(1)
+
+	go func() {
+		value := applyFunction(function, nil)
+		if value == nil {
+			value = NULL
+		}
+		result.Send(context.Background(), value)
+	}()
+
+	return result
+}
+
+// evalSwitchExpression evaluates the body of the first case with a value
+// equal to the switch value, or the default case
+func evalSwitchExpression(se *ast.SwitchExpression, env *object.Environment) object.Object {
+	value := Eval(se.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	body, err := switchBody(se, value, env)
+	if err != nil {
+		return err
+	}
+	if body == nil {
+		return NULL
+	}
+
+	result := Eval(body, env)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// switchBody returns the body of the first case with a value equal to value,
+// or the default case, evaluating case values until one matches
+func switchBody(se *ast.SwitchExpression, value object.Object, env *object.Environment) (*ast.BlockStatement, object.Object) {
+	for _, c := range se.Cases {
+		for _, v := range c.Values {
+			caseValue := Eval(v, env)
+			if isError(caseValue) {
+				return nil, caseValue
+			}
+
+			equal := evalInfixExpression("==", value, caseValue)
+			if isError(equal) {
+				return nil, equal
+			}
+			if equal == TRUE {
+				return c.Body, nil
+			}
+		}
+	}
+
+	return se.Default, nil
+}
+
 // isTruthy returns true if object is not NULL or false
 func isTruthy(obj object.Object) bool {
 	switch obj {
@@ -275,6 +585,29 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
+// evalWhileStatement runs the body until the condition is falsy, stopping
+// early on a return or an error
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		result := evalBlockStatement(ws.Body, env)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+}
+
 // evalBlockStatemnt evaluates an AST BlockStatement Node
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
@@ -315,6 +648,24 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// evalDestructuring binds each element of the array to the matching name
+func evalDestructuring(names []*ast.Identifier, val object.Object, env *object.Environment) object.Object {
+	array, ok := val.(*object.Array)
+	if !ok {
+		return newError("cannot destructure %s", val.Type())
+	}
+
+	if len(array.Elements) != len(names) {
+		return newError("cannot destructure %d values into %d names", len(array.Elements), len(names))
+	}
+
+	for i, name := range names {
+		env.Set(name.Value, array.Elements[i])
+	}
+
+	return nil
+}
+
 // evalIdentifier evaluates identifiers
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
@@ -36,6 +36,70 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalComparisonAndLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 <= 2", true},
+		{"3 <= 2", false},
+		{"2 >= 2", true},
+		{"1.5 >= 2", false},
+		{"true && false", false},
+		{"1 && 2", true},
+		{"false || true", true},
+		{"let n = if (false) { 1 }; n || false", false},
+		{"let called = false; let f = fn() { called = true; true }; false && f(); called", false},
+		{"let called = false; let f = fn() { called = true; true }; true || f(); called", false},
+		{"let called = false; let f = fn() { called = true; true }; false || f(); called", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+
+	// The right operand is never evaluated, so its error does not surface
+	testBooleanObject(t, testEval("false && (1 + true)"), false)
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1.5 + 2.25", 3.75},
+		{"3 / 2", 1},
+		{"3 / 2.0", 1.5},
+		{"2 * 0.5 - 1", 0.0},
+		{"1 == 1.0", true},
+		{"1 < 1.5", true},
+		{"2.5 > 3", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case float64:
+			float, ok := evaluated.(*object.Float)
+			if !ok {
+				t.Errorf("%s: object is not Float. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if float.Value != expected {
+				t.Errorf("%s: object has wrong value. got=%g, want=%g", tt.input, float.Value, expected)
+			}
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -116,10 +180,11 @@ func TestReturnStatements(t *testing.T) {
 		input    string
 		expected int64
 	}{
-		{"return 10;", 10},
-		{"return 10; 9;", 10},
-		{"return 2 * 5; 9;", 10},
-		{"9; return 2 * 5; 9;", 10},
+		{"fn() { return 10; }()", 10},
+		{"fn() { return 10; 9; }()", 10},
+		{"fn() { return 2 * 5; 9; }()", 10},
+		{"fn() { 9; return 2 * 5; 9; }()", 10},
+		{"fn() { if (10 > 1) { if (10 > 1) { return 10; } return 1; } }()", 10},
 	}
 
 	for _, tt := range tests {
@@ -160,27 +225,49 @@ func TestErrorHandling(t *testing.T) {
 		},
 		{
 			`
-			if (10 > 1) {
+			fn() {
 				if (10 > 1) {
-					return true + false;
+					if (10 > 1) {
+						return true + false;
+					}
+					return 1;
 				}
-				return 1;
-			}
+			}()
 			`,
 			"unknown operator: BOOLEAN + BOOLEAN",
 		},
+		{
+			"return 10;",
+			"return statement outside of function",
+		},
+		{
+			"if (false) { return 10; }; 9",
+			"return statement outside of function",
+		},
 		{
 			"foobar",
 			"identifier not found: foobar",
 		},
 		{
 			`"Hello" - "World"`,
-			"unkown operator: STRING - STRING",
+			"unknown operator: STRING - STRING",
 		},
 		{
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			"10 / (5 - 5)",
+			"division by zero",
+		},
+		{
+			"1.5 / 0",
+			"division by zero",
+		},
+		{
+			`1.5 + "a"`,
+			"type mismatch: FLOAT + STRING",
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -212,6 +299,157 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestWhileLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; while (i < 10) { i = i + 1; }; i", 10},
+		{"let i = 5; while (false) { i = 0; }; i", 5},
+		{"let sum = 0; let i = 0; while (i < 5) { sum = sum + i; i = i + 1 }; sum", 10},
+		{`
+		let find = fn(arr, x) {
+			let i = 0;
+			while (i < len(arr)) {
+				if (arr[i] == x) { return i; }
+				i = i + 1;
+			}
+			-1
+		};
+		find([4, 5, 6], 6)`, 2},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	evaluated := testEval("x = 1")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "identifier not found: x" {
+		t.Errorf("expected error for assignment to undefined name. got=%+v", evaluated)
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { throw 5; 1 } catch (e) { e * 2 }", 10},
+		{"try { } catch (e) { 2 }", nil},
+		{"let x = try { 1 + true } catch (e) { e }; x", "type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn(n) { if (n > 2) { throw n } f(n + 1) }; try { f(0) } catch (e) { e }", 3},
+		{"try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e * 10 }", 20},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("wrong caught error. want=%q, got=%+v", expected, evaluated)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	evaluated := testEval("try { 1 } catch (e) { 2 }; e")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "identifier not found: e" {
+		t.Errorf("catch parameter visible after the catch block. got=%+v", evaluated)
+	}
+
+	evaluated = testEval(`throw "no"`)
+	errObj, ok = evaluated.(*object.Error)
+	if !ok || errObj.Message != "uncaught exception: no" || errObj.Value.Inspect() != "no" {
+		t.Errorf("wrong uncaught exception. got=%+v", evaluated)
+	}
+}
+
+func TestSwitchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"switch (2) { case 1 { 10 } case 2, 3 { 20 } default { 30 } }", 20},
+		{"switch (4) { case 1 { 10 } case 2, 3 { 20 } default { 30 } }", 30},
+		{`switch ("a") { case 1 { 10 } case "a" { 20 } }`, 20},
+		{"switch (2.0) { case 2 { 10 } }", 10},
+		{"switch (4) { case 1 { 10 } }", nil},
+		{"switch (1) { case 1 { 10 } case 1 { 20 } }", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+
+	evaluated := testEval("switch (1) { case undefined { 1 } }")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "identifier not found: undefined" {
+		t.Errorf("error in a case value not returned. got=%+v", evaluated)
+	}
+}
+
+func TestBlockExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = { let y = 2; y * 3 }; x", 6},
+		{"let y = 1; let x = { let y = 10; y }; x + y", 11},
+		{"{ let a = 1 }", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+
+	evaluated := testEval("let x = { let y = 2; y }; y")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Message != "identifier not found: y" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestTuples(t *testing.T) {
+	input := `
+	let swap = fn(a, b) { return (b, a) };
+	let (x, y) = swap(1, 2);
+	x * 10 + y`
+
+	testIntegerObject(t, testEval(input), 21)
+
+	evaluated := testEval("let (x, y) = (1, 2, 3)")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Message != "cannot destructure 3 values into 2 names" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 	evaluated := testEval(input)
@@ -279,6 +517,20 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestInterpolatedString(t *testing.T) {
+	input := "let name = \"monkey\"; let age = 3; `hello ${name}, you are ${age + 1}`"
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "hello monkey, you are 4" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
 
@@ -293,6 +545,24 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"hi" == "hi"`, true},
+		{`"hi" != "hi"`, false},
+		{`"hi" == "there"`, false},
+		{`"hi" != "there"`, true},
+		{`"h" + "i" == "hi"`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -316,6 +586,10 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`rest([])`, nil},
 		{`push([], 1)`, []int{1}},
 		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`format("{}")`, "wrong number of arguments to `format`. placeholders=1, got=0"},
+		{`keys({2: "b", 1: "a"})`, []int{1, 2}},
+		{`values({"b": 2, "a": 1})`, []int{1, 2}},
+		{`keys("ab")`, "argument to `keys` must be HASH, got STRING"},
 	}
 
 	for _, tt := range tests {
@@ -339,6 +613,67 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestSpawnExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`receive(spawn fn() { 40 + 2 })`, 42},
+		{`receive(spawn fn() { })`, nil},
+		{`let x = 10; receive(spawn fn() { x * 2 })`, 20},
+		{`let results = chan();
+		let square = fn(n) { fn() { send(results, n * n) } };
+		spawn square(2);
+		spawn square(3);
+		receive(results) + receive(results)`, 13},
+		{`let c = chan(1); send(c, 5); receive(c)`, 5},
+		{`receive(spawn fn() { 1 + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`spawn 1`, "cannot spawn INTEGER"},
+		{`spawn fn(x) { x }`, "spawned function must take no arguments, takes 1"},
+		{`chan(-1)`, "channel size must not be negative, got -1"},
+		{`receive([])`, "argument to `receive` must be CHANNEL, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("wrong error. want=%q, got=%+v", expected, evaluated)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestSpawnedTasksShareEnvironment(t *testing.T) {
+	input := `
+	let x = 0;
+	let count = fn() { let i = 0; while (i < 5000) { x = x + 1; i = i + 1 } };
+	let tasks = [spawn count, spawn count];
+	receive(tasks[0]);
+	receive(tasks[1]);
+	x`
+
+	// Unsynchronized increments may be lost, but the environment stays intact
+	x, ok := testEval(input).(*object.Integer)
+	if !ok || x.Value < 5000 || x.Value > 10000 {
+		t.Errorf("wrong count. got=%+v", x)
+	}
+}
+
+func TestBuiltinsSharedWithVM(t *testing.T) {
+	for _, def := range object.Builtins {
+		if builtins[def.Name] != def.Builtin {
+			t.Errorf("builtin %q is not the one used by the VM", def.Name)
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
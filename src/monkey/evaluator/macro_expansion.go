@@ -0,0 +1,114 @@
+package evaluator
+
+import (
+	"fmt"
+	"go-compiler/src/monkey/ast"
+	"go-compiler/src/monkey/object"
+)
+
+// DefineMacros binds every top level `let name = macro(...)` of program in env
+// and removes those statements from program
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := program.Statements[:0]
+
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+
+		literal, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+
+		env.Set(let.Name.Value, &object.Macro{
+			Parameters: literal.Parameters,
+			Body:       literal.Body,
+			Env:        env,
+		})
+	}
+
+	program.Statements = statements
+}
+
+// ExpandMacros replaces every call of a macro defined in env with the code the
+// macro returns. Arguments are passed to the macro as quotes, and are expanded
+// before the call that takes them
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+
+		macro, ok := isMacroCall(call, env)
+		if !ok {
+			return node
+		}
+
+		if len(call.Arguments) != len(macro.Parameters) {
+			err = fmt.Errorf("wrong number of arguments to macro %s: want=%d, got=%d",
+				call.Function, len(macro.Parameters), len(call.Arguments))
+			return node
+		}
+
+		evalEnv := object.NewEnclosedEnvironment(macro.Env)
+		for i, param := range macro.Parameters {
+			evalEnv.Set(param.Value, &object.Quote{Node: call.Arguments[i]})
+		}
+
+		result := unwrapReturnValue(Eval(macro.Body, evalEnv))
+		switch result := result.(type) {
+		case *object.Quote:
+			return result.Node
+		case *object.Error:
+			err = fmt.Errorf("expanding macro %s: %s", call.Function, result.Message)
+		default:
+			err = fmt.Errorf("macro %s must return a quote, got %s", call.Function, typeName(result))
+		}
+		return node
+	})
+
+	return expanded, err
+}
+
+// ExpandProgram defines the macros of program and expands their calls, for
+// programs that use only the macros they define themselves
+func ExpandProgram(program *ast.Program) (*ast.Program, error) {
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+
+	expanded, err := ExpandMacros(program, env)
+	if err != nil {
+		return nil, err
+	}
+	return expanded.(*ast.Program), nil
+}
+
+// isMacroCall returns the macro call invokes, if its function names one in env
+func isMacroCall(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
+
+func typeName(obj object.Object) string {
+	if obj == nil {
+		return "nothing"
+	}
+	return string(obj.Type())
+}
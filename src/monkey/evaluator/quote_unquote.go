@@ -0,0 +1,95 @@
+package evaluator
+
+import (
+	"fmt"
+	"go-compiler/src/monkey/ast"
+	"go-compiler/src/monkey/object"
+	"go-compiler/src/monkey/token"
+	"strconv"
+)
+
+// quote returns a copy of node unevaluated, except for the arguments of
+// unquote calls within it, which are evaluated in env and put back as code.
+// Copying leaves node intact for the next time its function or macro runs
+func quote(node ast.Node, env *object.Environment) object.Object {
+	node, err := evalUnquoteCalls(ast.Copy(node), env)
+	if err != nil {
+		return newError("%s", err)
+	}
+	return &object.Quote{Node: node}
+}
+
+// evalUnquoteCalls replaces every unquote(x) within quoted with the value of x
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+
+	node := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil || call.Function.TokenLiteral() != "unquote" {
+			return node
+		}
+
+		if len(call.Arguments) != 1 {
+			err = fmt.Errorf("wrong number of arguments to unquote. got=%d, want=1", len(call.Arguments))
+			return node
+		}
+
+		unquoted := Eval(call.Arguments[0], env)
+		if errObj, ok := unquoted.(*object.Error); ok {
+			err = fmt.Errorf("%s", errObj.Message)
+			return node
+		}
+
+		converted, ok := convertObjectToASTNode(unquoted)
+		if !ok {
+			err = fmt.Errorf("cannot unquote %s into code", unquoted.Type())
+			return node
+		}
+		return converted
+	})
+
+	return node, err
+}
+
+// convertObjectToASTNode returns the code that evaluates to obj, if there is any
+func convertObjectToASTNode(obj object.Object) (ast.Node, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		literal := strconv.FormatInt(obj.Value, 10)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal}, Value: obj.Value}, true
+
+	case *object.Float:
+		literal := strconv.FormatFloat(obj.Value, 'f', -1, 64)
+		return &ast.FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: literal}, Value: obj.Value}, true
+
+	case *object.Boolean:
+		if obj.Value {
+			return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}, true
+		}
+		return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false}, true
+
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: obj.Value}, Value: obj.Value}, true
+
+	case *object.Array:
+		elements := make([]ast.Expression, len(obj.Elements))
+		for i, el := range obj.Elements {
+			node, ok := convertObjectToASTNode(el)
+			if !ok {
+				return nil, false
+			}
+			elements[i], ok = node.(ast.Expression)
+			if !ok {
+				return nil, false
+			}
+		}
+		return &ast.ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Elements: elements}, true
+
+	case *object.Quote:
+		// A quote may be unquoted more than once, and each use must be its own node
+		return ast.Copy(obj.Node), true
+
+	default:
+		return nil, false
+	}
+}
@@ -10,17 +10,27 @@ type Lexer struct {
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (points to NEXT char after current)
 	ch           byte // current char under examination
+
+	line      int // line of the current char, starting at 1
+	lineStart int // position of the first char of the current line
+
+	pending []token.Token // tokens already lexed from an interpolated string
 }
 
 // Returns Lexer for input string. This Lexer can read the input string's tokens
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar() // Initialize ch, position and readPosition
 	return l
 }
 
 // Reads next char of input string
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -32,9 +42,16 @@ func (l *Lexer) readChar() {
 
 // Returns the Token Type and Literal of the char ch under examination
 func (l *Lexer) NextToken() token.Token {
+	if len(l.pending) > 0 {
+		tok := l.pending[0]
+		l.pending = l.pending[1:]
+		return tok
+	}
+
 	var tok token.Token
 
-	l.skipWhiteSpace()
+	afterNewline := l.skipWhiteSpace()
+	line, column := l.line, l.column()
 
 	switch l.ch {
 	case '=':
@@ -72,9 +89,35 @@ func (l *Lexer) NextToken() token.Token {
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.LT_EQ, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.GT_EQ, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: "||"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -86,6 +129,8 @@ func (l *Lexer) NextToken() token.Token {
 	case '"':
 		tok.Type = token.STRING
 		tok.Literal = l.readString()
+	case '`':
+		tok = l.readTemplate()
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -99,10 +144,13 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.AfterNewline = afterNewline
+			tok.Line, tok.Column = line, column
 			return tok // Returning early since ch is advanced in l.readIdentifier()
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
+			tok.AfterNewline = afterNewline
+			tok.Line, tok.Column = line, column
 			return tok // Returning early since ch is advanced in l.readNumber()
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -110,9 +158,30 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.AfterNewline = afterNewline
+	tok.Line, tok.Column = line, column
 	return tok
 }
 
+// column returns the column of the current char, starting at 1
+func (l *Lexer) column() int {
+	return l.position - l.lineStart + 1
+}
+
+// Tokens drains the lexer and returns every remaining token, ending with the EOF token
+func (l *Lexer) Tokens() []token.Token {
+	tokens := []token.Token{}
+
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
 // Returns new token
 func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
@@ -132,11 +201,16 @@ func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
 
-// Moves position to skip whitespace
-func (l *Lexer) skipWhiteSpace() {
+// Moves position to skip whitespace, returning true if a newline was skipped
+func (l *Lexer) skipWhiteSpace() bool {
+	newline := false
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+		if l.ch == '\n' {
+			newline = true
+		}
 		l.readChar()
 	}
+	return newline
 }
 
 // Returns true if ch is Digit
@@ -144,13 +218,23 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-// Returns number string from l.position
-func (l *Lexer) readNumber() string {
+// Returns number string from l.position, which is a float when its digits
+// are followed by a fraction like 1.5
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+
+	if l.ch != '.' || !isDigit(l.peekChar()) {
+		return l.input[position:l.position], token.INT
+	}
+
+	l.readChar()
+	for isDigit(l.ch) {
+		l.readChar()
+	}
+	return l.input[position:l.position], token.FLOAT
 }
 
 // Returns char in next position
@@ -177,6 +261,87 @@ func (l *Lexer) readString() string {
 	return l.input[position:l.position]
 }
 
+// readTemplate lexes a backtick string into TEMPLATE_TEXT segments and the tokens of each
+// ${...} expression, returning TEMPLATE_START and queuing the rest up to TEMPLATE_END.
+// An unterminated template or unbalanced ${ is returned as an ILLEGAL token.
+//
+// Every token of the template, including those of embedded expressions, is
+// positioned at the opening '`'
+func (l *Lexer) readTemplate() token.Token {
+	tokens := []token.Token{{Type: token.TEMPLATE_START, Literal: "`"}}
+	segment := l.position + 1
+	line, column := l.line, l.column()
+
+	for {
+		l.readChar()
+
+		switch {
+		case l.ch == 0:
+			return token.Token{Type: token.ILLEGAL, Literal: "unterminated template string"}
+
+		case l.ch == '`':
+			tokens = appendTemplateText(tokens, l.input[segment:l.position])
+			tokens = append(tokens, token.Token{Type: token.TEMPLATE_END, Literal: "`"})
+
+			for i := range tokens {
+				tokens[i].Line, tokens[i].Column = line, column
+			}
+			l.pending = tokens[1:]
+			return tokens[0]
+
+		case l.ch == '$' && l.peekChar() == '{':
+			tokens = appendTemplateText(tokens, l.input[segment:l.position])
+
+			l.readChar()
+			start := l.position + 1
+			if !l.skipInterpolation() {
+				return token.Token{Type: token.ILLEGAL, Literal: "unbalanced ${ in template string"}
+			}
+
+			// Lex the embedded expression on its own, dropping its EOF
+			expression := New(l.input[start:l.position]).Tokens()
+
+			tokens = append(tokens, token.Token{Type: token.INTERP_START, Literal: "${"})
+			tokens = append(tokens, expression[:len(expression)-1]...)
+			tokens = append(tokens, token.Token{Type: token.INTERP_END, Literal: "}"})
+
+			segment = l.position + 1
+		}
+	}
+}
+
+// skipInterpolation moves from the '{' of a ${ to its matching '}', skipping over
+// nested braces and string literals. It returns false if the template ends first
+func (l *Lexer) skipInterpolation() bool {
+	depth := 1
+
+	for {
+		l.readChar()
+
+		switch l.ch {
+		case 0, '`':
+			return false
+		case '"':
+			l.readString()
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+}
+
+// appendTemplateText appends a TEMPLATE_TEXT token for text unless it is empty
+func appendTemplateText(tokens []token.Token, text string) []token.Token {
+	if text == "" {
+		return tokens
+	}
+	return append(tokens, token.Token{Type: token.TEMPLATE_TEXT, Literal: text})
+}
+
 // readComment returns the comment text
 func (l *Lexer) readComment() string {
 	position := l.position + 1
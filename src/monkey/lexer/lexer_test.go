@@ -143,3 +143,277 @@ func TestNextToken(t *testing.T) {
 	}
 
 }
+
+func TestNumbers(t *testing.T) {
+	input := "5 1.5 10.25*2 3."
+
+	expected := []token.Token{
+		{Type: token.INT, Literal: "5"},
+		{Type: token.FLOAT, Literal: "1.5"},
+		{Type: token.FLOAT, Literal: "10.25"},
+		{Type: token.ASTERISK, Literal: "*"},
+		{Type: token.INT, Literal: "2"},
+		{Type: token.INT, Literal: "3"},
+		{Type: token.ILLEGAL, Literal: "."},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	tokens := New(input).Tokens()
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%+v)",
+			len(expected), len(tokens), tokens)
+	}
+
+	for i, tok := range tokens {
+		if tok.Type != expected[i].Type || tok.Literal != expected[i].Literal {
+			t.Errorf("tokens[%d] wrong. expected=%+v, got=%+v", i, expected[i], tok)
+		}
+	}
+}
+
+func TestAfterNewline(t *testing.T) {
+	input := "let a = 1\nlet b = a\n\t+ 2;"
+
+	expected := []bool{
+		false, false, false, false, // let a = 1
+		true, false, false, false, // let b = a
+		true, false, false, // + 2;
+	}
+
+	l := New(input)
+
+	for i, want := range expected {
+		tok := l.NextToken()
+
+		if tok.AfterNewline != want {
+			t.Fatalf("tests[%d] - AfterNewline wrong for %q. expected=%t, got=%t",
+				i, tok.Literal, want, tok.AfterNewline)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let a = 1;\n\tputs(\"x\ny\", a)\n`${a}`"
+
+	expected := []struct {
+		literal string
+		line    int
+		column  int
+	}{
+		{"let", 1, 1},
+		{"a", 1, 5},
+		{"=", 1, 7},
+		{"1", 1, 9},
+		{";", 1, 10},
+		{"puts", 2, 2},
+		{"(", 2, 6},
+		{"x\ny", 2, 7},
+		{",", 3, 3},
+		{"a", 3, 5},
+		{")", 3, 6},
+		{"`", 4, 1},
+		{"${", 4, 1},
+		{"a", 4, 1},
+		{"}", 4, 1},
+		{"`", 4, 1},
+		{"", 4, 7},
+	}
+
+	l := New(input)
+
+	for i, want := range expected {
+		tok := l.NextToken()
+
+		if tok.Literal != want.literal || tok.Line != want.line || tok.Column != want.column {
+			t.Fatalf("tests[%d] - wrong token. expected=%q at %d:%d, got=%q at %d:%d",
+				i, want.literal, want.line, want.column, tok.Literal, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestComparisonOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{
+			"a==b!=c<=d>=e=f",
+			[]token.Token{
+				{Type: token.IDENT, Literal: "a"},
+				{Type: token.EQ, Literal: "=="},
+				{Type: token.IDENT, Literal: "b"},
+				{Type: token.NOT_EQ, Literal: "!="},
+				{Type: token.IDENT, Literal: "c"},
+				{Type: token.LT_EQ, Literal: "<="},
+				{Type: token.IDENT, Literal: "d"},
+				{Type: token.GT_EQ, Literal: ">="},
+				{Type: token.IDENT, Literal: "e"},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.IDENT, Literal: "f"},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+		{
+			"a=!b<c>d===e",
+			[]token.Token{
+				{Type: token.IDENT, Literal: "a"},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.BANG, Literal: "!"},
+				{Type: token.IDENT, Literal: "b"},
+				{Type: token.LT, Literal: "<"},
+				{Type: token.IDENT, Literal: "c"},
+				{Type: token.GT, Literal: ">"},
+				{Type: token.IDENT, Literal: "d"},
+				{Type: token.EQ, Literal: "=="},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.IDENT, Literal: "e"},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+		{"=", []token.Token{{Type: token.ASSIGN, Literal: "="}, {Type: token.EOF, Literal: ""}}},
+		{"!", []token.Token{{Type: token.BANG, Literal: "!"}, {Type: token.EOF, Literal: ""}}},
+		{"<", []token.Token{{Type: token.LT, Literal: "<"}, {Type: token.EOF, Literal: ""}}},
+		{">", []token.Token{{Type: token.GT, Literal: ">"}, {Type: token.EOF, Literal: ""}}},
+		{"a !=", []token.Token{
+			{Type: token.IDENT, Literal: "a"},
+			{Type: token.NOT_EQ, Literal: "!="},
+			{Type: token.EOF, Literal: ""},
+		}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+
+			if tok.Type != expected.Type {
+				t.Fatalf("%q: tokens[%d] - tokentype wrong. expected=%q, got=%q",
+					tt.input, i, expected.Type, tok.Type)
+			}
+
+			if tok.Literal != expected.Literal {
+				t.Fatalf("%q: tokens[%d] - literal wrong. expected=%q, got=%q",
+					tt.input, i, expected.Literal, tok.Literal)
+			}
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	input := "a && b || c & d | e"
+
+	expected := []token.Token{
+		{Type: token.IDENT, Literal: "a"},
+		{Type: token.AND, Literal: "&&"},
+		{Type: token.IDENT, Literal: "b"},
+		{Type: token.OR, Literal: "||"},
+		{Type: token.IDENT, Literal: "c"},
+		{Type: token.ILLEGAL, Literal: "&"},
+		{Type: token.IDENT, Literal: "d"},
+		{Type: token.ILLEGAL, Literal: "|"},
+		{Type: token.IDENT, Literal: "e"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	tokens := New(input).Tokens()
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%+v)",
+			len(expected), len(tokens), tokens)
+	}
+
+	for i, tok := range tokens {
+		if tok.Type != expected[i].Type || tok.Literal != expected[i].Literal {
+			t.Errorf("tokens[%d] wrong. expected=%+v, got=%+v", i, expected[i], tok)
+		}
+	}
+}
+
+func TestTemplateString(t *testing.T) {
+	input := "`hi ${name}, ${a + {\"b\": 1}[\"}\"]}!` 1"
+
+	expected := []token.Token{
+		{Type: token.TEMPLATE_START, Literal: "`"},
+		{Type: token.TEMPLATE_TEXT, Literal: "hi "},
+		{Type: token.INTERP_START, Literal: "${"},
+		{Type: token.IDENT, Literal: "name"},
+		{Type: token.INTERP_END, Literal: "}"},
+		{Type: token.TEMPLATE_TEXT, Literal: ", "},
+		{Type: token.INTERP_START, Literal: "${"},
+		{Type: token.IDENT, Literal: "a"},
+		{Type: token.PLUS, Literal: "+"},
+		{Type: token.LBRACE, Literal: "{"},
+		{Type: token.STRING, Literal: "b"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.INT, Literal: "1"},
+		{Type: token.RBRACE, Literal: "}"},
+		{Type: token.LBRACKET, Literal: "["},
+		{Type: token.STRING, Literal: "}"},
+		{Type: token.RBRACKET, Literal: "]"},
+		{Type: token.INTERP_END, Literal: "}"},
+		{Type: token.TEMPLATE_TEXT, Literal: "!"},
+		{Type: token.TEMPLATE_END, Literal: "`"},
+		{Type: token.INT, Literal: "1"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	tokens := New(input).Tokens()
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%+v)",
+			len(expected), len(tokens), tokens)
+	}
+
+	for i, tok := range tokens {
+		if tok.Type != expected[i].Type || tok.Literal != expected[i].Literal {
+			t.Errorf("tokens[%d] wrong. expected=%+v, got=%+v", i, expected[i], tok)
+		}
+	}
+}
+
+func TestTemplateStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"`a ${b`", "unbalanced ${ in template string"},
+		{"`a ${ {b} `", "unbalanced ${ in template string"},
+		{"`a ${b}", "unterminated template string"},
+	}
+
+	for _, tt := range tests {
+		tok := New(tt.input).NextToken()
+
+		if tok.Type != token.ILLEGAL || tok.Literal != tt.expected {
+			t.Errorf("%q: expected ILLEGAL %q, got=%+v", tt.input, tt.expected, tok)
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	input := `let x = 5;`
+
+	expected := []token.Token{
+		{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+		{Type: token.IDENT, Literal: "x", Line: 1, Column: 5},
+		{Type: token.ASSIGN, Literal: "=", Line: 1, Column: 7},
+		{Type: token.INT, Literal: "5", Line: 1, Column: 9},
+		{Type: token.SEMICOLON, Literal: ";", Line: 1, Column: 10},
+		{Type: token.EOF, Literal: "", Line: 1, Column: 11},
+	}
+
+	tokens := New(input).Tokens()
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%+v)",
+			len(expected), len(tokens), tokens)
+	}
+
+	for i, tok := range tokens {
+		if tok != expected[i] {
+			t.Errorf("tokens[%d] wrong. expected=%+v, got=%+v", i, expected[i], tok)
+		}
+	}
+}
@@ -1,22 +1,325 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 
+	"go-compiler/src/monkey/monkey"
+	"go-compiler/src/monkey/object"
 	"go-compiler/src/monkey/repl"
 )
 
+const usage = `usage:
+  monkey [repl] [-engine vm|eval] [-history file]
+                                            start the REPL
+  monkey run [-engine vm|eval] <file>       run a .monkey source or .mbc bytecode file
+  monkey run -trace <file>                  run on the vm and print a profile to stderr
+  monkey compile <file.monkey> [-o out]     compile a source file to bytecode
+  monkey debug <file>                       step through a .monkey or .mbc file on the vm
+`
+
+// Exit codes, so scripts can tell why a program failed
+const (
+	exitCompileError = 1
+	exitUsage        = 2
+	exitRuntimeError = 3
+	exitIOError      = 4 // a file could not be read or written
+)
+
+// failure carries the exit code for err
+type failure struct {
+	code int
+	err  error
+}
+
+func (f *failure) Error() string { return f.err.Error() }
+
+func usageError(format string, a ...interface{}) error {
+	return &failure{exitUsage, fmt.Errorf(format, a...)}
+}
+
+func ioError(err error) error {
+	return &failure{exitIOError, err}
+}
+
 func main() {
+	args := os.Args[1:]
+
+	command := "repl"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "repl":
+		err = startREPL(args)
+	case "run":
+		err = runFile(args)
+	case "compile":
+		err = compileFile(args)
+	case "debug":
+		err = debugFile(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		err = usageError("unknown command %q", command)
+	}
+
+	if err == nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "monkey: %s\n", err)
+
+	code := exitCompileError
+	var f *failure
+	if errors.As(err, &f) {
+		code = f.code
+	}
+	if code == exitUsage {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	os.Exit(code)
+}
+
+// startREPL runs the REPL on the terminal, coloring errors unless the output is redirected
+func startREPL(args []string) error {
+	config := repl.DefaultConfig()
+
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	engineName := flags.String("engine", config.Engine.Name(), "vm or eval")
+	flags.StringVar(&config.HistoryFile, "history", config.HistoryFile, "history file, empty to keep none")
+
+	if err := flags.Parse(args); err != nil {
+		return usageError("repl: %s", err)
+	}
+	if flags.NArg() != 0 {
+		return usageError("repl: unexpected arguments %v", flags.Args())
+	}
+
+	engine, err := monkey.EngineByName(*engineName)
+	if err != nil {
+		return usageError("repl: %s", err)
+	}
+	config.Engine = engine
+
+	if info, err := os.Stdout.Stat(); err == nil {
+		config.Color = info.Mode()&os.ModeCharDevice != 0
+	}
+
+	r, err := repl.New(config)
+	if err != nil {
+		return err
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
 
 	fmt.Printf("\nHello %s! This is the Monkey Programming Language!\n", user.Username)
-	fmt.Println("Statements need a semicolon to end; enter `exit()` or CTRL-d (i.e. EOF) to exit. Synatx: https://monkeylang.org")
+	fmt.Println("Statements end at a newline or semicolon; enter `exit()` or CTRL-d (i.e. EOF) to exit. Syntax: https://monkeylang.org")
+	fmt.Println("Enter `:help` for REPL commands.")
 	fmt.Printf("\n")
 
-	repl.REPL(os.Stdin, os.Stdout)
+	return r.Run()
+}
+
+// parseFileArgs parses flags given on either side of the single file argument
+func parseFileArgs(flags *flag.FlagSet, args []string) (string, error) {
+	flags.SetOutput(io.Discard)
+
+	if err := flags.Parse(args); err != nil {
+		return "", usageError("%s: %s", flags.Name(), err)
+	}
+	if flags.NArg() == 0 {
+		return "", usageError("%s: missing file", flags.Name())
+	}
+
+	file := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		return "", usageError("%s: %s", flags.Name(), err)
+	}
+	if flags.NArg() != 0 {
+		return "", usageError("%s: unexpected arguments %v", flags.Name(), flags.Args())
+	}
+
+	return file, nil
+}
+
+// runFile executes a source file on the chosen engine, or a bytecode file
+// written by compileFile on the VM
+func runFile(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	engineName := flags.String("engine", monkey.VM.Name(), "vm or eval")
+	trace := flags.Bool("trace", false, "print opcode and function timings")
+
+	file, err := parseFileArgs(flags, args)
+	if err != nil {
+		return err
+	}
+
+	engine, err := monkey.EngineByName(*engineName)
+	if err != nil {
+		return usageError("run: %s", err)
+	}
+
+	if *trace && engine.Name() != monkey.VM.Name() {
+		return usageError("run: -trace only works on the vm engine")
+	}
+
+	if filepath.Ext(file) == ".mbc" {
+		if engine.Name() != monkey.VM.Name() {
+			return usageError("run: bytecode files only run on the vm engine")
+		}
+		return runBytecode(file, *trace)
+	}
+
+	input, err := os.ReadFile(file)
+	if err != nil {
+		return ioError(err)
+	}
+
+	// Imports are relative to the file, wherever it is run from
+	dir := filepath.Dir(file)
+
+	if *trace {
+		program, err := monkey.CompileIn(string(input), dir)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		return runProgram(file, program, true)
+	}
+
+	result := monkey.RunIn(engine, string(input), dir)
+
+	switch {
+	case len(result.ParseErrors) != 0:
+		for _, msg := range result.ParseErrors {
+			fmt.Fprintf(os.Stderr, "\t%s\n", msg)
+		}
+		return fmt.Errorf("%s: parser errors", file)
+	case result.ExpandError != nil:
+		return fmt.Errorf("%s: macro expansion failed: %s", file, result.ExpandError)
+	case result.CompileError != nil:
+		return fmt.Errorf("%s: compilation failed: %s", file, result.CompileError)
+	}
+
+	return runtimeFailure(file, result.Value, result.RuntimeError)
+}
+
+func runBytecode(file string, trace bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return ioError(err)
+	}
+	defer f.Close()
+
+	program, err := monkey.Load(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+
+	return runProgram(file, program, trace)
+}
+
+// runProgram runs a compiled program, printing its profile to stderr when tracing
+func runProgram(file string, program *monkey.Program, trace bool) error {
+	if !trace {
+		value, err := program.Run()
+		return runtimeFailure(file, value, err)
+	}
+
+	value, profile, err := program.Profile()
+	fmt.Fprint(os.Stderr, profile)
+	return runtimeFailure(file, value, err)
+}
+
+// runtimeFailure reports err, or an error object left as the program's final value
+func runtimeFailure(file string, value object.Object, err error) error {
+	if errObj, ok := value.(*object.Error); ok && err == nil {
+		err = errors.New(errObj.Message)
+	}
+	if err != nil {
+		return &failure{exitRuntimeError, fmt.Errorf("%s: %s", file, err)}
+	}
+	return nil
+}
+
+// debugFile runs a source or bytecode file under the interactive debugger
+func debugFile(args []string) error {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+
+	file, err := parseFileArgs(flags, args)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return ioError(err)
+	}
+	defer f.Close()
+
+	var program *monkey.Program
+	if filepath.Ext(file) == ".mbc" {
+		program, err = monkey.Load(f)
+	} else {
+		input, readErr := io.ReadAll(f)
+		if readErr != nil {
+			return ioError(readErr)
+		}
+		program, err = monkey.CompileIn(string(input), filepath.Dir(file))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+
+	repl.Debug(program.Bytecode, os.Stdin, os.Stdout)
+	return nil
+}
+
+// compileFile compiles a source file to bytecode, written next to it with
+// an .mbc extension unless -o is given
+func compileFile(args []string) error {
+	flags := flag.NewFlagSet("compile", flag.ContinueOnError)
+	out := flags.String("o", "", "output file")
+
+	src, err := parseFileArgs(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		*out = strings.TrimSuffix(src, filepath.Ext(src)) + ".mbc"
+	}
+
+	input, err := os.ReadFile(src)
+	if err != nil {
+		return ioError(err)
+	}
+
+	program, err := monkey.CompileIn(string(input), filepath.Dir(src))
+	if err != nil {
+		return fmt.Errorf("%s: %s", src, err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return ioError(err)
+	}
+
+	err = program.Save(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
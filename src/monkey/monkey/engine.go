@@ -0,0 +1,139 @@
+package monkey
+
+import (
+	"fmt"
+	"go-compiler/src/monkey/object"
+	"strings"
+)
+
+// Engine runs source code on one of the interpreter backends
+type Engine interface {
+	Name() string
+	Run(src string) Result
+}
+
+// engine adapts a pipeline function such as runIn to Engine
+type engine struct {
+	name string
+	run  func(src, dir string) Result
+}
+
+func (e engine) Name() string                 { return e.name }
+func (e engine) Run(src string) Result        { return e.run(src, "") }
+func (e engine) RunIn(src, dir string) Result { return e.run(src, dir) }
+
+var (
+	// VM compiles the source to bytecode and executes it on the virtual machine
+	VM Engine = engine{"vm", runIn}
+
+	// Evaluator walks the AST directly, without compiling it. It does not
+	// support imports, so it has no use for a directory
+	Evaluator Engine = engine{"eval", func(src, _ string) Result { return Evaluate(src) }}
+)
+
+// RunIn runs src on e, resolving its relative imports against dir when e
+// supports imports
+func RunIn(e Engine, src, dir string) Result {
+	if e, ok := e.(interface{ RunIn(src, dir string) Result }); ok {
+		return e.RunIn(src, dir)
+	}
+	return e.Run(src)
+}
+
+// Engines lists every backend, in the order they are offered to users
+var Engines = []Engine{VM, Evaluator}
+
+// EngineByName returns the engine with the given Name
+func EngineByName(name string) (Engine, error) {
+	names := []string{}
+	for _, e := range Engines {
+		if e.Name() == name {
+			return e, nil
+		}
+		names = append(names, e.Name())
+	}
+
+	return nil, fmt.Errorf("unknown engine %q, want one of %s", name, strings.Join(names, ", "))
+}
+
+// Compare runs src on both engines and describes the first way their results
+// differ, or returns nil if they agree.
+//
+// Values agree when they have the same type and inspect the same. Arrays and
+// hashes are compared element by element, and functions, represented
+// differently by each engine, only need to be functions on both. Failures
+// agree when both engines fail, as their messages differ and the evaluator
+// reports at runtime what the compiler rejects.
+func Compare(src string, a, b Engine) error {
+	resultA, resultB := a.Run(src), b.Run(src)
+
+	errA, errB := resultA.Err(), resultB.Err()
+	switch {
+	case errA != nil && errB != nil:
+		return nil
+	case errA != nil:
+		return fmt.Errorf("%s failed with %q, %s returned %s", a.Name(), errA, b.Name(), describe(resultB.Value))
+	case errB != nil:
+		return fmt.Errorf("%s returned %s, %s failed with %q", a.Name(), describe(resultA.Value), b.Name(), errB)
+	}
+
+	if !sameValue(resultA.Value, resultB.Value) {
+		return fmt.Errorf("%s returned %s, %s returned %s",
+			a.Name(), describe(resultA.Value), b.Name(), describe(resultB.Value))
+	}
+	return nil
+}
+
+func sameValue(a, b object.Object) bool {
+	if isFunction(a) || isFunction(b) {
+		return isFunction(a) && isFunction(b)
+	}
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	switch a := a.(type) {
+	case *object.Array:
+		other, ok := b.(*object.Array)
+		if !ok || len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i, e := range a.Elements {
+			if !sameValue(e, other.Elements[i]) {
+				return false
+			}
+		}
+		return true
+
+	case *object.Hash:
+		// Pairs are compared by key, since inspecting a hash follows map order
+		other, ok := b.(*object.Hash)
+		if !ok || len(a.Pairs) != len(other.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			otherPair, ok := other.Pairs[key]
+			if !ok || !sameValue(pair.Value, otherPair.Value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a.Type() == b.Type() && a.Inspect() == b.Inspect()
+}
+
+func isFunction(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Closure, *object.CompiledFunction, *object.Builtin:
+		return true
+	}
+	return false
+}
+
+func describe(obj object.Object) string {
+	if obj == nil {
+		return "no value"
+	}
+	return fmt.Sprintf("%s %s", obj.Type(), obj.Inspect())
+}
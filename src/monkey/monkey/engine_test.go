@@ -0,0 +1,165 @@
+package monkey
+
+import (
+	"strings"
+	"testing"
+)
+
+// differentialPrograms exercise each language feature on every engine
+var differentialPrograms = []string{
+	"1 + 2 * 3 - 4 / 2",
+	"-5 + 10; !true; !!5",
+	"1 < 2 == true; 3 > 4 != false",
+	"1.5 * 2 + 3 / 2; 1 == 1.0; -0.5 < 0",
+	"[1.5, 2][0] / 3",
+	"10 / 0",
+	"1 <= 2 && 2 >= 3 || 1.5 <= 1",
+	"let hits = 0; let f = fn(x) { hits = hits + 1; x }; f(false) && f(true); f(true) || f(true); hits",
+	"false && (1 + true)",
+	`"mon" + "key"`,
+	"`sum: ${1 + 2}`",
+	"if (1 > 2) { 10 } else { 20 }",
+	"if (false) { 10 }",
+	"let a = 5; let b = a * 2; a + b",
+	"let add = fn(a, b) { a + b }; add(1, add(2, 3))",
+	"let adder = fn(x) { fn(y) { x + y } }; adder(2)(3)",
+	"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)",
+	"let f = fn() { return 1; 2 }; f()",
+	"return 1",
+	"if (false) { return 1 }; 2",
+	"[1, 2 * 2, 3 + 3][1]",
+	`{"one": 1, "two": 1 + 1, 3: true}`,
+	`{"a": [1, {"b": 2}]}["a"][1]["b"]`,
+	`len("four") + len([1, 2])`,
+	"first([7, 8]); last([7, 8]); rest([7, 8])",
+	"push([1], 2)",
+	"let i = 0; let sum = 0; while (i < 5) { sum = sum + i; i = i + 1 }; sum",
+	"let x = 1; while (x < 5) { let x = x + 1; }; x",
+	"let f = fn() { let x = 1; while (x < 5) { let x = x + 1; }; x }; f()",
+	"let f = fn() { let x = 1; let g = fn() { x }; g() }; f()",
+	"let [a, b] = [1, 2]; a + b",
+	`let map = fn(arr, f) {
+		let i = 0;
+		let out = [];
+		while (i < len(arr)) { out = push(out, f(arr[i])); i = i + 1 };
+		out
+	};
+	map([1, 2, 3], fn(x) { x * x })`,
+	"let f = fn(x) { x }; f",
+	`let unless = macro(cond, then, otherwise) {
+		quote(if (!(unquote(cond))) { unquote(then) } else { unquote(otherwise) })
+	};
+	let double = macro(x) { quote(unquote(x) * 2) };
+	let f = fn(n) { unless(n > 10, double(double(n)), n) };
+	[f(3), f(30)]`,
+	"let m = macro(x) { 1 }; m(2)",
+	`let get = fn(xs, i) { if (i >= len(xs)) { throw "out of range" } xs[i] };
+	let safe = fn(xs, i) { try { get(xs, i) } catch (e) { e } };
+	[safe([1], 0), safe([1], 3)]`,
+	`try { try { throw 1 } catch (e) { throw [e, 2] } } catch (e) { e }`,
+	`try { 1 + "a" } catch (e) { 0 }`,
+	`try { len(1) } catch (e) { "c" }`,
+	`try { push(1, 1) } catch (e) { e }`,
+	"throw 1",
+	`let f = fn(n) { switch (n) { case 0 { "a" } case 1, 2 { "b" } case 4 { "c" } default { "d" } } };
+	[f(0), f(1), f(2), f(3), f(4), f(2.0), f("x")]`,
+	`switch ("b") { case "a" { 1 } case "b", "c" { 2 } }`,
+	`let results = chan();
+	let square = fn(n) { fn() { send(results, n * n) } };
+	spawn square(2);
+	spawn square(3);
+	receive(results) + receive(results) + receive(spawn fn() { 1 })`,
+	`1 + "a"`,
+	"-true",
+	"undefined",
+	"len(1)",
+}
+
+func TestEnginesAgree(t *testing.T) {
+	for _, src := range differentialPrograms {
+		if err := Compare(src, VM, Evaluator); err != nil {
+			t.Errorf("%s\n\tengines disagree: %s", src, err)
+		}
+	}
+}
+
+// knownDifferences are programs the engines are known to disagree on. Compare
+// must keep reporting them until the engines are brought in line
+var knownDifferences = []string{
+	// The VM returns null for an index out of range, the evaluator an error
+	"[1, 2, 3][5]",
+	// Closures copy their free variables on the VM, so it rejects assigning a
+	// captured local that the evaluator's closures would see change
+	"let f = fn() { let x = 1; let g = fn() { x }; x = 2; g() }; f()",
+}
+
+func TestKnownDifferences(t *testing.T) {
+	for _, src := range knownDifferences {
+		if err := Compare(src, VM, Evaluator); err == nil {
+			t.Errorf("%s\n\tengines now agree, remove it from knownDifferences", src)
+		}
+	}
+}
+
+func TestCompareReportsDifferences(t *testing.T) {
+	constant := func(src string) Engine {
+		return engine{"const", func(string, string) Result { return Run(src) }}
+	}
+
+	tests := []struct {
+		other    Engine
+		expected string
+	}{
+		{constant("1"), "vm returned INTEGER 3, const returned INTEGER 1"},
+		{constant(`"3"`), "vm returned INTEGER 3, const returned STRING 3"},
+		{constant("[3]"), "vm returned INTEGER 3, const returned ARRAY [3]"},
+		{constant("undefined"), "vm returned INTEGER 3, const failed with"},
+	}
+
+	for _, tt := range tests {
+		err := Compare("1 + 2", VM, tt.other)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("wrong difference. want prefix %q, got=%v", tt.expected, err)
+		}
+	}
+
+	if err := Compare(`{"a": 1, "b": [2]}`, VM, constant(`{"b": [2], "a": 1}`)); err != nil {
+		t.Errorf("hashes with the same pairs differ: %s", err)
+	}
+}
+
+func TestEngineByName(t *testing.T) {
+	for _, e := range Engines {
+		got, err := EngineByName(e.Name())
+		if err != nil || got.Name() != e.Name() {
+			t.Errorf("EngineByName(%q) = %v, %v", e.Name(), got, err)
+		}
+	}
+
+	_, err := EngineByName("jit")
+	if err == nil || err.Error() != `unknown engine "jit", want one of vm, eval` {
+		t.Errorf("wrong error for unknown engine. got=%v", err)
+	}
+}
+
+func BenchmarkEngines(b *testing.B) {
+	src := `
+	let fib = fn(n) {
+		let a = 0;
+		let b = 1;
+		while (n > 0) { let t = a + b; a = b; b = t; n = n - 1 };
+		a
+	};
+	let i = 0;
+	while (i < 100) { fib(30); i = i + 1 }`
+
+	for _, e := range Engines {
+		b.Run(e.Name(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := e.Run(src).Err(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
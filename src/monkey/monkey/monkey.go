@@ -0,0 +1,148 @@
+// Package monkey provides a high-level entry point for embedding the Monkey language.
+package monkey
+
+import (
+	"fmt"
+	"go-compiler/src/monkey/compiler"
+	"go-compiler/src/monkey/evaluator"
+	"go-compiler/src/monkey/lexer"
+	"go-compiler/src/monkey/object"
+	"go-compiler/src/monkey/parser"
+	"go-compiler/src/monkey/vm"
+	"io"
+	"strings"
+)
+
+// Program holds compiled bytecode that can be run any number of times
+type Program struct {
+	Bytecode *compiler.Bytecode
+
+	// newGlobals returns a clean globals store for every run
+	newGlobals func() []object.Object
+}
+
+// HostFunction is a Go function exposed to Monkey source as the builtin Name
+type HostFunction struct {
+	Name string
+	Fn   object.BuiltinFunction
+}
+
+// Compile parses and compiles the given source into a reusable Program
+func Compile(src string) (*Program, error) {
+	return CompileWith(src)
+}
+
+// CompileWith compiles src like Compile, making every host function callable
+// from the source like a builtin. They are indexed after the standard builtins
+// in the order given, so LoadWith must receive them in the same order
+func CompileWith(src string, host ...HostFunction) (*Program, error) {
+	return CompileIn(src, "", host...)
+}
+
+// CompileIn compiles src like CompileWith, resolving its relative imports
+// against dir, usually the directory of the file src was read from
+func CompileIn(src, dir string, host ...HostFunction) (*Program, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parser errors: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	program, err := evaluator.ExpandProgram(program)
+	if err != nil {
+		return nil, fmt.Errorf("macro expansion failed: %s", err)
+	}
+
+	comp := compiler.NewWithOptions(compiler.Options{ImmediateIntegers: true, Dir: dir})
+	for _, h := range host {
+		_, err := comp.RegisterBuiltin(h.Name, h.Fn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = comp.Compile(program)
+	if err != nil {
+		return nil, fmt.Errorf("compilation failed: %s", err)
+	}
+
+	return &Program{
+		Bytecode: comp.Bytecode(),
+		newGlobals: func() []object.Object {
+			return make([]object.Object, vm.GlobalsSize)
+		},
+	}, nil
+}
+
+// Load reads a Program written by Save, rejecting bytecode that fails vm.Verify
+func Load(r io.Reader) (*Program, error) {
+	return LoadWith(r)
+}
+
+// LoadWith reads a Program compiled by CompileWith, wiring up the host
+// functions that cannot be saved along with the bytecode
+func LoadWith(r io.Reader, host ...HostFunction) (*Program, error) {
+	bytecode, err := compiler.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range host {
+		bytecode.SymbolTable.DefineBuiltin(len(bytecode.Builtins), h.Name)
+		bytecode.Builtins = append(bytecode.Builtins, &object.Builtin{Fn: h.Fn})
+	}
+
+	err = vm.Verify(bytecode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Program{
+		Bytecode: bytecode,
+		newGlobals: func() []object.Object {
+			return make([]object.Object, vm.GlobalsSize)
+		},
+	}, nil
+}
+
+// Save writes the Program's bytecode to w so it can be run later without recompiling
+func (p *Program) Save(w io.Writer) error {
+	return p.Bytecode.Encode(w)
+}
+
+// Run executes the Program on a new VM and returns the last popped value
+func (p *Program) Run() (object.Object, error) {
+	machine := vm.NewWithGlobalsStore(p.Bytecode, p.newGlobals())
+	err := machine.SafeRun()
+	if err != nil {
+		return nil, fmt.Errorf("executing bytecode failed: %s", err)
+	}
+
+	return machine.LastPoppedStackElem(), nil
+}
+
+// Profile runs the Program like Run with vm profiling enabled. The profile
+// covers the instructions executed even when the run fails
+func (p *Program) Profile() (object.Object, *vm.Profile, error) {
+	machine := vm.NewWithGlobalsStore(p.Bytecode, p.newGlobals())
+	machine.EnableProfiling()
+
+	err := machine.SafeRun()
+	if err != nil {
+		return nil, machine.Profile(), fmt.Errorf("executing bytecode failed: %s", err)
+	}
+
+	return machine.LastPoppedStackElem(), machine.Profile(), nil
+}
+
+// Eval parses, compiles and runs the given source, returning the last popped value
+func Eval(src string) (object.Object, error) {
+	program, err := Compile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	return program.Run()
+}
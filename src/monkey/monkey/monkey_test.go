@@ -0,0 +1,274 @@
+package monkey
+
+import (
+	"bytes"
+	"go-compiler/src/monkey/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	result, err := Eval("1 + 2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	integer, ok := result.(*object.Integer)
+	if !ok {
+		t.Fatalf("object is not Integer. got=%T (%+v)", result, result)
+	}
+
+	if integer.Value != 3 {
+		t.Errorf("object has wrong value. got=%d, want=%d", integer.Value, 3)
+	}
+}
+
+func TestEvalParserError(t *testing.T) {
+	result, err := Eval("1 +")
+	if err == nil {
+		t.Fatalf("expected parser error. got=%+v", result)
+	}
+
+	if !strings.HasPrefix(err.Error(), "parser errors:") {
+		t.Errorf("wrong error. got=%q", err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	program, err := Compile(`let add = fn(a) { fn(b) { a + b } }; add(40)(2)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := program.Save(&buf); err != nil {
+		t.Fatalf("save error: %s", err)
+	}
+
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatalf("load error: %s", err)
+	}
+
+	result, err := loaded.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	integer, ok := result.(*object.Integer)
+	if !ok {
+		t.Fatalf("object is not Integer. got=%T (%+v)", result, result)
+	}
+
+	if integer.Value != 42 {
+		t.Errorf("object has wrong value. got=%d, want=%d", integer.Value, 42)
+	}
+}
+
+func TestLoadVerifiesBytecode(t *testing.T) {
+	program, err := Compile(`let a = "x"; a`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Point the first constant load past the end of the pool
+	program.Bytecode.Instructions[2] = 9
+
+	var buf bytes.Buffer
+	if err := program.Save(&buf); err != nil {
+		t.Fatalf("save error: %s", err)
+	}
+
+	_, err = Load(&buf)
+	if err == nil || !strings.Contains(err.Error(), "constant index 9 out of range") {
+		t.Errorf("expected the corrupt constant index to be rejected. got=%v", err)
+	}
+}
+
+func TestProgramRunsWithCleanGlobals(t *testing.T) {
+	program, err := Compile(`let a = 1; let b = a + 1; b`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Record every globals store handed out to a run
+	stores := [][]object.Object{}
+	newGlobals := program.newGlobals
+	program.newGlobals = func() []object.Object {
+		s := newGlobals()
+		stores = append(stores, s)
+		return s
+	}
+
+	for i := 0; i < 2; i++ {
+		result, err := program.Run()
+		if err != nil {
+			t.Fatalf("run %d: unexpected error: %s", i, err)
+		}
+
+		integer, ok := result.(*object.Integer)
+		if !ok {
+			t.Fatalf("run %d: object is not Integer. got=%T (%+v)", i, result, result)
+		}
+
+		if integer.Value != 2 {
+			t.Errorf("run %d: object has wrong value. got=%d, want=%d", i, integer.Value, 2)
+		}
+
+		// Mutate the globals left behind by this run
+		stores[i][0] = &object.Integer{Value: 100}
+		stores[i][1] = &object.Integer{Value: 100}
+	}
+
+	if len(stores) != 2 {
+		t.Fatalf("wrong number of globals stores. got=%d, want=%d", len(stores), 2)
+	}
+
+	if &stores[0][0] == &stores[1][0] {
+		t.Errorf("globals store was shared between runs")
+	}
+}
+
+func TestHostFunctions(t *testing.T) {
+	calls := []string{}
+	host := []HostFunction{
+		{Name: "log", Fn: func(args ...object.Object) object.Object {
+			calls = append(calls, args[0].Inspect())
+			return nil
+		}},
+		{Name: "double", Fn: func(args ...object.Object) object.Object {
+			return object.NewInteger(args[0].(*object.Integer).Value * 2)
+		}},
+	}
+
+	program, err := CompileWith(`log("start"); double(len([1, 2])) + 1`, host...)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := program.Save(&buf); err != nil {
+		t.Fatalf("save error: %s", err)
+	}
+
+	if _, err := Load(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Errorf("expected loading without the host functions to fail")
+	}
+
+	loaded, err := LoadWith(&buf, host...)
+	if err != nil {
+		t.Fatalf("load error: %s", err)
+	}
+
+	for _, p := range []*Program{program, loaded} {
+		result, err := p.Run()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		integer, ok := result.(*object.Integer)
+		if !ok {
+			t.Fatalf("object is not Integer. got=%T (%+v)", result, result)
+		}
+
+		if integer.Value != 5 {
+			t.Errorf("object has wrong value. got=%d, want=%d", integer.Value, 5)
+		}
+	}
+
+	if len(calls) != 2 || calls[0] != "start" {
+		t.Errorf("log called wrong. got=%q", calls)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	program, err := Compile("let double = fn(x) { x * 2 }; double(1) + double(2)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, profile, err := program.Profile()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if integer, ok := result.(*object.Integer); !ok || integer.Value != 6 {
+		t.Fatalf("wrong result. want=6, got=%+v", result)
+	}
+
+	for _, fn := range profile.Functions {
+		if fn.Name == "double" {
+			if fn.Calls != 2 {
+				t.Errorf("wrong calls for double. want=2, got=%d", fn.Calls)
+			}
+			return
+		}
+	}
+	t.Errorf("profile has no entry for double: %+v", profile.Functions)
+}
+
+func TestMacros(t *testing.T) {
+	src := `
+	let unless = macro(cond, then, otherwise) {
+		quote(if (!(unquote(cond))) { unquote(then) } else { unquote(otherwise) })
+	};
+	unless(1 > 2, "expanded", "not expanded")`
+
+	for _, engine := range Engines {
+		result := engine.Run(src)
+		if err := result.Err(); err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine.Name(), err)
+		}
+		if result.Value.Inspect() != "expanded" {
+			t.Errorf("%s: wrong result. got=%s", engine.Name(), result.Value.Inspect())
+		}
+	}
+
+	_, err := Compile("let m = macro() { 1 }; m()")
+	if err == nil || err.Error() != "macro expansion failed: macro m must return a quote, got INTEGER" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	result := Run("let m = macro() { 1 }; m()")
+	if result.ExpandError == nil || result.Err() != result.ExpandError {
+		t.Errorf("expansion failure not reported as ExpandError: %+v", result)
+	}
+}
+
+func TestImportsRelativeToTheProgram(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sub")
+	err := os.Mkdir(dir, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "lib.monkey"), []byte("let value = 41;"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := `import("lib.monkey")["value"] + 1`
+
+	program, err := CompileIn(src, dir)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	value, err := program.Run()
+	if err != nil {
+		t.Fatalf("runtime error: %s", err)
+	}
+	if value.Inspect() != "42" {
+		t.Errorf("wrong value. want=42, got=%s", value.Inspect())
+	}
+
+	result := RunIn(VM, src, dir)
+	if result.Err() != nil || result.Value.Inspect() != "42" {
+		t.Errorf("wrong result running in %s. got=%+v", dir, result)
+	}
+
+	// Without the directory the module is looked for in the working directory
+	if _, err := Compile(src); err == nil {
+		t.Errorf("module found without the program's directory")
+	}
+}
@@ -0,0 +1,120 @@
+package monkey
+
+import (
+	"errors"
+	"fmt"
+	"go-compiler/src/monkey/ast"
+	"go-compiler/src/monkey/compiler"
+	"go-compiler/src/monkey/evaluator"
+	"go-compiler/src/monkey/lexer"
+	"go-compiler/src/monkey/object"
+	"go-compiler/src/monkey/parser"
+	"go-compiler/src/monkey/vm"
+	"strings"
+)
+
+// Result records the outcome of every stage of the pipeline for tooling
+type Result struct {
+	Value    object.Object
+	Bytecode *compiler.Bytecode
+
+	ParseErrors  []string
+	ExpandError  error // from expanding macros, between parsing and compiling
+	CompileError error
+	RuntimeError error
+}
+
+// Err returns the error of the stage that failed, or nil if the source ran.
+// An error object left as the final value counts as a runtime error
+func (r Result) Err() error {
+	switch {
+	case len(r.ParseErrors) != 0:
+		return fmt.Errorf("parser errors: %s", strings.Join(r.ParseErrors, "; "))
+	case r.ExpandError != nil:
+		return r.ExpandError
+	case r.CompileError != nil:
+		return r.CompileError
+	case r.RuntimeError != nil:
+		return r.RuntimeError
+	}
+
+	if errObj, ok := r.Value.(*object.Error); ok {
+		return errors.New(errObj.Message)
+	}
+	return nil
+}
+
+// Run parses, compiles and executes the given source, stopping at the first
+// failing stage. Bytecode is kept even when execution fails
+func Run(src string) Result {
+	return runIn(src, "")
+}
+
+// runIn runs src like Run, resolving its relative imports against dir
+func runIn(src, dir string) Result {
+	var result Result
+
+	program, ok := parse(src, &result)
+	if !ok {
+		return result
+	}
+
+	comp := compiler.NewWithOptions(compiler.Options{Dir: dir})
+	err := comp.Compile(program)
+	if err != nil {
+		result.CompileError = err
+		return result
+	}
+	result.Bytecode = comp.Bytecode()
+
+	machine := vm.New(result.Bytecode)
+	err = machine.SafeRun()
+	if err != nil {
+		result.RuntimeError = err
+		return result
+	}
+	result.Value = machine.LastPoppedStackElem()
+
+	return result
+}
+
+// Evaluate runs the given source on the tree-walking evaluator instead of the
+// VM. An error object left as the final value is reported as a RuntimeError
+func Evaluate(src string) Result {
+	var result Result
+
+	program, ok := parse(src, &result)
+	if !ok {
+		return result
+	}
+
+	value := evaluator.Eval(program, object.NewEnvironment())
+	if errObj, ok := value.(*object.Error); ok {
+		result.RuntimeError = errors.New(errObj.Message)
+		return result
+	}
+	result.Value = value
+
+	return result
+}
+
+// parse parses src and expands the macros it defines, recording the stage
+// that failed in result
+func parse(src string, result *Result) (*ast.Program, bool) {
+	l := lexer.New(src)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		result.ParseErrors = p.Errors()
+		return nil, false
+	}
+
+	program, err := evaluator.ExpandProgram(program)
+	if err != nil {
+		result.ExpandError = err
+		return nil, false
+	}
+
+	return program, true
+}
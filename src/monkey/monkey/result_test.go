@@ -0,0 +1,104 @@
+package monkey
+
+import (
+	"go-compiler/src/monkey/object"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	result := Run("let a = 2; a * 3")
+
+	if len(result.ParseErrors) != 0 || result.CompileError != nil || result.RuntimeError != nil {
+		t.Fatalf("unexpected errors: %+v", result)
+	}
+
+	integer, ok := result.Value.(*object.Integer)
+	if !ok || integer.Value != 6 {
+		t.Errorf("wrong Value. got=%+v", result.Value)
+	}
+
+	if result.Bytecode == nil || len(result.Bytecode.Instructions) == 0 {
+		t.Errorf("Bytecode not populated")
+	}
+}
+
+func TestRunParseErrors(t *testing.T) {
+	result := Run("let = 1")
+
+	if len(result.ParseErrors) == 0 {
+		t.Fatalf("expected ParseErrors. got=%+v", result)
+	}
+
+	if result.Bytecode != nil || result.Value != nil {
+		t.Errorf("later stages ran after parse errors: %+v", result)
+	}
+}
+
+func TestRunCompileError(t *testing.T) {
+	result := Run("undefined")
+
+	if result.CompileError == nil {
+		t.Fatalf("expected CompileError. got=%+v", result)
+	}
+
+	if result.Bytecode != nil || result.Value != nil {
+		t.Errorf("later stages ran after compile error: %+v", result)
+	}
+}
+
+func TestRunRuntimeError(t *testing.T) {
+	result := Run(`1 + "a"`)
+
+	if result.RuntimeError == nil {
+		t.Fatalf("expected RuntimeError. got=%+v", result)
+	}
+
+	if result.RuntimeError.Error() != "runtime error at line 1, col 3: unsupported types for binary operation: INTEGER STRING" {
+		t.Errorf("wrong RuntimeError. got=%q", result.RuntimeError)
+	}
+
+	if result.Bytecode == nil || len(result.Bytecode.Instructions) == 0 {
+		t.Errorf("Bytecode not populated on runtime error")
+	}
+
+	if result.Value != nil {
+		t.Errorf("Value set on runtime error: %+v", result.Value)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	result := Evaluate("let a = 2; a * 3")
+
+	if len(result.ParseErrors) != 0 || result.RuntimeError != nil {
+		t.Fatalf("unexpected errors: %+v", result)
+	}
+
+	integer, ok := result.Value.(*object.Integer)
+	if !ok || integer.Value != 6 {
+		t.Errorf("wrong Value. got=%+v", result.Value)
+	}
+
+	if result.Bytecode != nil {
+		t.Errorf("Bytecode populated by the evaluator: %+v", result.Bytecode)
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	result := Evaluate("let = 1")
+	if len(result.ParseErrors) == 0 {
+		t.Errorf("expected ParseErrors. got=%+v", result)
+	}
+
+	result = Evaluate(`1 + "a"`)
+	if result.RuntimeError == nil {
+		t.Fatalf("expected RuntimeError. got=%+v", result)
+	}
+
+	if result.RuntimeError.Error() != "type mismatch: INTEGER + STRING" {
+		t.Errorf("wrong RuntimeError. got=%q", result.RuntimeError)
+	}
+
+	if result.Value != nil {
+		t.Errorf("Value set after runtime error: %+v", result.Value)
+	}
+}
@@ -0,0 +1,306 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Builtins lists the builtin functions in the order the compiler and VM index them
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Array:
+				return NewInteger(int64(len(arg.Elements)))
+			case *String:
+				return NewInteger(int64(len(arg.Value)))
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		}},
+	},
+	{
+		"puts",
+		&Builtin{Fn: func(args ...Object) Object {
+			for _, arg := range args {
+				fmt.Println(arg.Inspect())
+			}
+			return NULL
+		}},
+	},
+	{
+		"first",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+
+			return NULL
+		}},
+	},
+	{
+		"last",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				return arr.Elements[length-1]
+			}
+
+			return NULL
+		}},
+	},
+	{
+		"rest",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				newElements := make([]Object, length-1)
+				copy(newElements, arr.Elements[1:length])
+				return &Array{Elements: newElements}
+			}
+
+			return NULL
+		}},
+	},
+	{
+		"push",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+
+			newElements := make([]Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+
+			return &Array{Elements: newElements}
+		}},
+	},
+	{
+		"format",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) < 1 {
+				return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+			}
+
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument to `format` must be STRING, got %s", args[0].Type())
+			}
+
+			template := args[0].(*String).Value
+			values := args[1:]
+
+			placeholders := strings.Count(template, "{}")
+			if placeholders != len(values) {
+				return newError("wrong number of arguments to `format`. placeholders=%d, got=%d",
+					placeholders, len(values))
+			}
+
+			// Substitute each {} placeholder with the next argument in order
+			var out strings.Builder
+			parts := strings.Split(template, "{}")
+			for i, part := range parts {
+				out.WriteString(part)
+				if i < len(values) {
+					out.WriteString(values[i].Inspect())
+				}
+			}
+
+			return &String{Value: out.String()}
+		}},
+	},
+	{
+		"keys",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `keys` must be HASH, got %s", args[0].Type())
+			}
+
+			pairs := sortedPairs(args[0].(*Hash))
+			elements := make([]Object, len(pairs))
+			for i, pair := range pairs {
+				elements[i] = pair.Key
+			}
+
+			return &Array{Elements: elements}
+		}},
+	},
+	{
+		"values",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `values` must be HASH, got %s", args[0].Type())
+			}
+
+			pairs := sortedPairs(args[0].(*Hash))
+			elements := make([]Object, len(pairs))
+			for i, pair := range pairs {
+				elements[i] = pair.Value
+			}
+
+			return &Array{Elements: elements}
+		}},
+	},
+	{
+		"chan",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+
+			if len(args) == 0 {
+				return NewChannel(0)
+			}
+
+			size, ok := args[0].(*Integer)
+			if !ok {
+				return newError("argument to `chan` must be INTEGER, got %s", args[0].Type())
+			}
+			if size.Value < 0 {
+				return newError("channel size must not be negative, got %d", size.Value)
+			}
+
+			return NewChannel(int(size.Value))
+		}},
+	},
+	{
+		"send",
+		withContext(func(ctx context.Context, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			ch, ok := args[0].(*Channel)
+			if !ok {
+				return newError("argument to `send` must be CHANNEL, got %s", args[0].Type())
+			}
+
+			if err := ch.Send(ctx, args[1]); err != nil {
+				return newError("send cancelled: %s", err)
+			}
+			return NULL
+		}),
+	},
+	{
+		"receive",
+		withContext(func(ctx context.Context, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			ch, ok := args[0].(*Channel)
+			if !ok {
+				return newError("argument to `receive` must be CHANNEL, got %s", args[0].Type())
+			}
+
+			obj, err := ch.Receive(ctx)
+			if err != nil {
+				return newError("receive cancelled: %s", err)
+			}
+			return obj
+		}),
+	},
+}
+
+// GetBuiltinByName returns the builtin with the given name, or nil if there is none
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+// sortedPairs returns the pairs of hash ordered by key type, then by key value
+func sortedPairs(hash *Hash) []HashPair {
+	pairs := make([]HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := pairs[i].Key, pairs[j].Key
+		if a.Type() != b.Type() {
+			return a.Type() < b.Type()
+		}
+
+		switch a := a.(type) {
+		case *Integer:
+			return a.Value < b.(*Integer).Value
+		case *String:
+			return a.Value < b.(*String).Value
+		case *Boolean:
+			return !a.Value && b.(*Boolean).Value
+		default:
+			return a.Inspect() < b.Inspect()
+		}
+	})
+
+	return pairs
+}
+
+// withContext makes a blocking builtin from fn. Its Fn waits without a deadline
+func withContext(fn ContextBuiltinFunction) *Builtin {
+	return &Builtin{
+		Fn:        func(args ...Object) Object { return fn(context.Background(), args...) },
+		ContextFn: fn,
+	}
+}
+
+// newError returns an Error object
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,151 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// FromGoValue converts a native Go value into its Monkey Object representation
+func FromGoValue(value interface{}) (Object, error) {
+	if value == nil {
+		return NULL, nil
+	}
+
+	if obj, ok := value.(Object); ok {
+		return obj, nil
+	}
+
+	v := reflect.ValueOf(value)
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewInteger(v.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("go value %d overflows INTEGER", v.Uint())
+		}
+		return NewInteger(int64(v.Uint())), nil
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return FromGoValue(v.Elem().Interface())
+
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+
+	case reflect.Slice, reflect.Array:
+		elements := make([]Object, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem, err := FromGoValue(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = elem
+		}
+		return &Array{Elements: elements}, nil
+
+	case reflect.Map:
+		pairs := make(map[HashKey]HashPair)
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := FromGoValue(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			hashKey, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hashkey: %s", key.Type())
+			}
+
+			value, err := FromGoValue(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			pairs[hashKey.HashKey()] = HashPair{Key: key, Value: value}
+		}
+		return &Hash{Pairs: pairs}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported go value: %T", value)
+}
+
+// ToGoValue converts a Monkey Object into its native Go representation. A hash
+// becomes a map[string]interface{}, so only hashes with string keys convert
+func ToGoValue(obj Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value, nil
+
+	case *Float:
+		return obj.Value, nil
+
+	case *String:
+		return obj.Value, nil
+
+	case *Boolean:
+		return obj.Value, nil
+
+	case *Null:
+		return nil, nil
+
+	case *Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, e := range obj.Elements {
+			elem, err := ToGoValue(e)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = elem
+		}
+		return elements, nil
+
+	case *Hash:
+		pairs, err := hashToGoValue(obj)
+		if err != nil {
+			return nil, err
+		}
+		return pairs, nil
+	}
+
+	if obj == nil {
+		return nil, fmt.Errorf("cannot convert nil object to go value")
+	}
+
+	return nil, fmt.Errorf("cannot convert %s to go value", obj.Type())
+}
+
+// hashToGoValue converts hash to a map keyed by strings, failing on any other
+// key rather than merging keys like 1 and "1"
+func hashToGoValue(hash *Hash) (map[string]interface{}, error) {
+	pairs := make(map[string]interface{}, len(hash.Pairs))
+
+	for _, pair := range hash.Pairs {
+		key, ok := pair.Key.(*String)
+		if !ok {
+			return nil, fmt.Errorf("cannot convert hash with %s key to go value", pair.Key.Type())
+		}
+
+		value, err := ToGoValue(pair.Value)
+		if err != nil {
+			return nil, err
+		}
+		pairs[key.Value] = value
+	}
+
+	return pairs, nil
+}
@@ -1,5 +1,10 @@
 package object
 
+import (
+	"sort"
+	"sync"
+)
+
 // NewEnvironment creates a new environment
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
@@ -13,23 +18,65 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 	return env
 }
 
-// Environment holds variable bindings in the current and outer scopes
+// Environment holds variable bindings in the current and outer scopes. Spawned
+// tasks share environments, so every scope guards its own store
 type Environment struct {
+	mu    sync.RWMutex
 	store map[string]Object
 	outer *Environment
 }
 
 // Get returns the object bindings from current or outer scope
 func (e *Environment) Get(name string) (Object, bool) {
+	e.mu.RLock()
 	obj, ok := e.store[name]
+	e.mu.RUnlock()
+
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
 	return obj, ok
 }
 
+// Assign rebinds name in the innermost scope that defines it, reporting false
+// when no scope does
+func (e *Environment) Assign(name string, val Object) (Object, bool) {
+	e.mu.Lock()
+	_, ok := e.store[name]
+	if ok {
+		e.store[name] = val
+	}
+	e.mu.Unlock()
+
+	if ok {
+		return val, true
+	}
+
+	if e.outer == nil {
+		return nil, false
+	}
+	return e.outer.Assign(name, val)
+}
+
+// Names returns the names bound in the innermost scope, sorted
+func (e *Environment) Names() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
 // Set stores a binding
 func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	e.store[name] = val
 	return val
 }
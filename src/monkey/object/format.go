@@ -0,0 +1,87 @@
+package object
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// basePrefixes maps the supported integer display bases to their literal prefix
+var basePrefixes = map[int]string{
+	2:  "0b",
+	8:  "0o",
+	10: "",
+	16: "0x",
+}
+
+// IsSupportedBase returns true if integers can be displayed in base
+func IsSupportedBase(base int) bool {
+	_, ok := basePrefixes[base]
+	return ok
+}
+
+// InspectInBase works like Inspect but renders integers in the given base.
+// It only changes how values are displayed, never the values themselves.
+func InspectInBase(obj Object, base int) string {
+	prefix, ok := basePrefixes[base]
+	if !ok || base == 10 {
+		return obj.Inspect()
+	}
+
+	return inspectInBase(obj, base, prefix, map[Object]bool{})
+}
+
+// inspectInBase renders obj in base, tracking the compound objects being visited
+func inspectInBase(obj Object, base int, prefix string, visiting map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Integer:
+		if obj.Value < 0 {
+			return "-" + prefix + strconv.FormatUint(uint64(-obj.Value), base)
+		}
+		return prefix + strconv.FormatInt(obj.Value, base)
+
+	case *Array:
+		if visiting[obj] {
+			return "[...]"
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		var out bytes.Buffer
+
+		elements := []string{}
+		for _, e := range obj.Elements {
+			elements = append(elements, inspectInBase(e, base, prefix, visiting))
+		}
+
+		out.WriteString("[")
+		out.WriteString(strings.Join(elements, ", "))
+		out.WriteString("]")
+
+		return out.String()
+
+	case *Hash:
+		if visiting[obj] {
+			return "{...}"
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		var out bytes.Buffer
+
+		pairs := []string{}
+		for _, pair := range obj.Pairs {
+			key := inspectInBase(pair.Key, base, prefix, visiting)
+			value := inspectInBase(pair.Value, base, prefix, visiting)
+			pairs = append(pairs, key+":"+value)
+		}
+
+		out.WriteString("{")
+		out.WriteString(strings.Join(pairs, ", "))
+		out.WriteString("}")
+
+		return out.String()
+	}
+
+	return obj.Inspect()
+}
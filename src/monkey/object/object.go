@@ -2,8 +2,10 @@ package object
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"hash/fnv"
+	"strconv"
 	"strings"
 
 	"go-compiler/src/monkey/ast"
@@ -13,8 +15,12 @@ import (
 type ObjectType string
 type BuiltinFunction func(args ...Object) Object
 
+// ContextBuiltinFunction is a builtin that may block, giving up once ctx is done
+type ContextBuiltinFunction func(ctx context.Context, args ...Object) Object
+
 const (
 	INTEGER_OBJ           = "INTEGER"
+	FLOAT_OBJ             = "FLOAT"
 	BOOLEAN_OBJ           = "BOOLEAN"
 	NULL_OBJ              = "NULL"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
@@ -25,6 +31,18 @@ const (
 	ARRAY_OBJ             = "ARRAY"
 	HASH_OBJ              = "HASH"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
+	CLOSURE_OBJ           = "CLOSURE"
+	COMPILED_MODULE_OBJ   = "COMPILED_MODULE"
+	QUOTE_OBJ             = "QUOTE"
+	MACRO_OBJ             = "MACRO"
+	CHANNEL_OBJ           = "CHANNEL"
+)
+
+// Singletons shared by every backend so identity comparisons hold across packages
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
 )
 
 // Object represents interpreted values
@@ -46,6 +64,56 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+// Range of integers preallocated by NewInteger
+const (
+	MinCachedInteger = -128
+	MaxCachedInteger = 1024
+)
+
+var smallIntegers = func() []*Integer {
+	cache := make([]*Integer, MaxCachedInteger-MinCachedInteger+1)
+	for i := range cache {
+		cache[i] = &Integer{Value: int64(i + MinCachedInteger)}
+	}
+	return cache
+}()
+
+// NewInteger returns an Integer for value, sharing a preallocated object for small values
+func NewInteger(value int64) *Integer {
+	if value >= MinCachedInteger && value <= MaxCachedInteger {
+		return smallIntegers[value-MinCachedInteger]
+	}
+	return &Integer{Value: value}
+}
+
+// Float Object represents a 64-bit floating point number
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect keeps a fractional part on whole numbers so 2.0 does not read as an Integer
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// FloatValue returns the value of an Integer or Float as a float64, so mixed
+// arithmetic can promote its integer operand
+func FloatValue(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *Float:
+		return obj.Value, true
+	}
+	return 0, false
+}
+
 // Boolean Object represents a Boolean
 type Boolean struct {
 	Value bool
@@ -71,6 +139,7 @@ func (rv *ReturnValue) Inspect() string  { return fmt.Sprintf("%v", rv.Value.Ins
 // Error contains the error message
 type Error struct {
 	Message string
+	Value   Object // the value of the throw statement that raised the error, if any
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
@@ -102,6 +171,75 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// Quote holds unevaluated code, produced by quote(...) and returned by macros
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+// Macro is a macro defined by a let statement, called with its arguments quoted
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// Channel passes values between concurrent tasks. It is backed by a Go channel,
+// so sends block while its buffer is full and receives while it is empty
+type Channel struct {
+	Value chan Object
+}
+
+// NewChannel returns a channel buffering up to size values
+func NewChannel(size int) *Channel {
+	return &Channel{Value: make(chan Object, size)}
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return fmt.Sprintf("channel(%d/%d)", len(c.Value), cap(c.Value)) }
+
+// Send sends obj on the channel, blocking until there is room for it or ctx is done
+func (c *Channel) Send(ctx context.Context, obj Object) error {
+	select {
+	case c.Value <- obj:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Receive returns the next value sent on the channel, blocking until there is
+// one or ctx is done
+func (c *Channel) Receive(ctx context.Context) (Object, error) {
+	select {
+	case obj := <-c.Value:
+		return obj, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 // String is a representation of string
 type String struct {
 	Value string
@@ -110,9 +248,11 @@ type String struct {
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 
-// Builtin represents builtin functions
+// Builtin represents builtin functions. Blocking builtins also set ContextFn,
+// which engines that can be cancelled call instead of Fn
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn        BuiltinFunction
+	ContextFn ContextBuiltinFunction
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -124,12 +264,21 @@ type Array struct {
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
-func (ao *Array) Inspect() string {
+func (ao *Array) Inspect() string  { return ao.inspect(map[Object]bool{}) }
+
+// inspect renders the array, printing [...] for arrays already being inspected
+func (ao *Array) inspect(visiting map[Object]bool) string {
+	if visiting[ao] {
+		return "[...]"
+	}
+	visiting[ao] = true
+	defer delete(visiting, ao)
+
 	var out bytes.Buffer
 
 	elements := []string{}
 	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
+		elements = append(elements, inspectNested(e, visiting))
 	}
 
 	out.WriteString("[")
@@ -180,13 +329,22 @@ type Hash struct {
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
+func (h *Hash) Inspect() string  { return h.inspect(map[Object]bool{}) }
+
+// inspect renders the hash, printing {...} for hashes already being inspected
+func (h *Hash) inspect(visiting map[Object]bool) string {
+	if visiting[h] {
+		return "{...}"
+	}
+	visiting[h] = true
+	defer delete(visiting, h)
+
 	var out bytes.Buffer
 
 	pairs := []string{}
 	for _, pair := range h.Pairs {
-		key := pair.Key.Inspect()
-		value := pair.Value.Inspect()
+		key := inspectNested(pair.Key, visiting)
+		value := inspectNested(pair.Value, visiting)
 		pairs = append(pairs, key+":"+value)
 	}
 
@@ -197,11 +355,54 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// inspectNested inspects an element of a compound object, carrying along the
+// compound objects currently being inspected so self-references terminate
+func inspectNested(obj Object, visiting map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.inspect(visiting)
+	case *Hash:
+		return obj.inspect(visiting)
+	default:
+		return obj.Inspect()
+	}
+}
+
 type CompiledFunction struct {
-	Instructions code.Instructions
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+
+	// Lines maps Instructions back to the source they were compiled from
+	Lines code.LineTable
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
 func (cf *CompiledFunction) Inspect() string {
 	return fmt.Sprintf("CompiledFunction[%p]", cf)
 }
+
+// CompiledModule is an imported file. Fn runs the file's top level and
+// returns a hash of its globals, which is kept in the global slot Slot so the
+// module only runs once
+type CompiledModule struct {
+	Path string
+	Fn   *CompiledFunction
+	Slot int
+}
+
+func (cm *CompiledModule) Type() ObjectType { return COMPILED_MODULE_OBJ }
+func (cm *CompiledModule) Inspect() string {
+	return fmt.Sprintf("CompiledModule[%s]", cm.Path)
+}
+
+// Closure pairs a CompiledFunction with the free variables it captured
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
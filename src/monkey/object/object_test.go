@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"reflect"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -20,3 +24,237 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestNewInteger(t *testing.T) {
+	if NewInteger(1) != NewInteger(1) {
+		t.Errorf("small integers are not shared")
+	}
+
+	if NewInteger(MaxCachedInteger+1) == NewInteger(MaxCachedInteger+1) {
+		t.Errorf("integers outside the cache are shared")
+	}
+
+	for _, v := range []int64{MinCachedInteger, -1, 0, MaxCachedInteger, MaxCachedInteger + 1} {
+		if NewInteger(v).Value != v {
+			t.Errorf("NewInteger(%d) has wrong value. got=%d", v, NewInteger(v).Value)
+		}
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-0.25, "-0.25"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("Inspect of %v wrong. want=%q, got=%q", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestFromGoValue(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{42, "42"},
+		{int64(-7), "-7"},
+		{2.5, "2.5"},
+		{float32(2), "2.0"},
+		{"monkey", "monkey"},
+		{true, "true"},
+		{nil, "null"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[]interface{}{1, "two", false}, "[1, two, false]"},
+		{map[string]int{"a": 1}, "{a:1}"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGoValue(tt.input)
+		if err != nil {
+			t.Fatalf("FromGoValue(%v) error: %s", tt.input, err)
+		}
+
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGoValue(%v) wrong. want=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	if obj, _ := FromGoValue(true); obj != TRUE {
+		t.Errorf("FromGoValue(true) is not the TRUE singleton")
+	}
+
+	_, err := FromGoValue(struct{}{})
+	if err == nil {
+		t.Errorf("expected error for unsupported value")
+	}
+}
+
+func TestFromGoValueUnsignedAndPointers(t *testing.T) {
+	n := 7
+	var missing *int
+
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{uint64(math.MaxInt64), "9223372036854775807"},
+		{uintptr(16), "16"},
+		{&n, "7"},
+		{missing, "null"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGoValue(tt.input)
+		if err != nil {
+			t.Fatalf("FromGoValue(%v) error: %s", tt.input, err)
+		}
+
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGoValue(%v) wrong. want=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	for _, input := range []interface{}{uint64(math.MaxUint64), uint(math.MaxInt64 + 1)} {
+		_, err := FromGoValue(input)
+		if err == nil {
+			t.Errorf("expected overflow error for %v", input)
+		}
+	}
+}
+
+func TestToGoValue(t *testing.T) {
+	tests := []struct {
+		input    Object
+		expected interface{}
+	}{
+		{&Integer{Value: 5}, int64(5)},
+		{&Float{Value: 0.5}, 0.5},
+		{&String{Value: "monkey"}, "monkey"},
+		{FALSE, false},
+		{NULL, nil},
+	}
+
+	for _, tt := range tests {
+		value, err := ToGoValue(tt.input)
+		if err != nil {
+			t.Fatalf("ToGoValue(%s) error: %s", tt.input.Inspect(), err)
+		}
+
+		if value != tt.expected {
+			t.Errorf("ToGoValue(%s) wrong. want=%v, got=%v", tt.input.Inspect(), tt.expected, value)
+		}
+	}
+
+	_, err := ToGoValue(&CompiledFunction{})
+	if err == nil {
+		t.Errorf("expected error converting a function")
+	}
+
+	// Keys that inspect the same are not merged
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []Hashable{&Integer{Value: 1}, &String{Value: "1"}} {
+		hash.Pairs[key.HashKey()] = HashPair{Key: key.(Object), Value: key.(Object)}
+	}
+
+	_, err = ToGoValue(hash)
+	if err == nil || err.Error() != "cannot convert hash with INTEGER key to go value" {
+		t.Errorf("wrong error converting a hash with an integer key. got=%v", err)
+	}
+}
+
+func TestGoValueRoundTrip(t *testing.T) {
+	input := map[string]interface{}{
+		"name":    "monkey",
+		"age":     int64(3),
+		"nothing": nil,
+		"tags":    []interface{}{"a", []interface{}{int64(1), true}},
+		"nested": map[string]interface{}{
+			"list": []interface{}{map[string]interface{}{"deep": false}},
+		},
+	}
+
+	obj, err := FromGoValue(input)
+	if err != nil {
+		t.Fatalf("FromGoValue error: %s", err)
+	}
+
+	output, err := ToGoValue(obj)
+	if err != nil {
+		t.Fatalf("ToGoValue error: %s", err)
+	}
+
+	if !reflect.DeepEqual(input, output) {
+		t.Errorf("round trip mismatch.\nwant=%#v\ngot=%#v", input, output)
+	}
+}
+
+func TestInspectInBase(t *testing.T) {
+	tests := []struct {
+		input    Object
+		base     int
+		expected string
+	}{
+		{&Integer{Value: 255}, 10, "255"},
+		{&Integer{Value: 255}, 16, "0xff"},
+		{&Integer{Value: -255}, 16, "-0xff"},
+		{&Integer{Value: 5}, 2, "0b101"},
+		{&Integer{Value: 8}, 8, "0o10"},
+		{&Array{Elements: []Object{&Integer{Value: 10}, &String{Value: "10"}}}, 16, "[0xa, 10]"},
+		{TRUE, 16, "true"},
+	}
+
+	for _, tt := range tests {
+		result := InspectInBase(tt.input, tt.base)
+		if result != tt.expected {
+			t.Errorf("InspectInBase(%s, %d) wrong. want=%q, got=%q",
+				tt.input.Inspect(), tt.base, tt.expected, result)
+		}
+	}
+}
+
+func TestInspectSelfReference(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: 1}}}
+	array.Elements = append(array.Elements, array)
+
+	if array.Inspect() != "[1, [...]]" {
+		t.Errorf("array.Inspect() wrong. got=%q", array.Inspect())
+	}
+
+	key := &String{Value: "self"}
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: hash}
+
+	if hash.Inspect() != "{self:{...}}" {
+		t.Errorf("hash.Inspect() wrong. got=%q", hash.Inspect())
+	}
+
+	// Mutual references through both kinds of container
+	inner := &Array{}
+	outer := &Hash{Pairs: map[HashKey]HashPair{key.HashKey(): {Key: key, Value: inner}}}
+	inner.Elements = []Object{outer}
+
+	if inner.Inspect() != "[{self:[...]}]" {
+		t.Errorf("inner.Inspect() wrong. got=%q", inner.Inspect())
+	}
+
+	// Shared, non-cyclic elements are printed in full each time
+	shared := &Array{Elements: []Object{&Integer{Value: 2}}}
+	pair := &Array{Elements: []Object{shared, shared}}
+
+	if pair.Inspect() != "[[2], [2]]" {
+		t.Errorf("pair.Inspect() wrong. got=%q", pair.Inspect())
+	}
+
+	if InspectInBase(array, 16) != "[0x1, [...]]" {
+		t.Errorf("InspectInBase(array, 16) wrong. got=%q", InspectInBase(array, 16))
+	}
+}
@@ -13,6 +13,8 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
@@ -28,6 +30,10 @@ var precedences = map[token.TokenType]int{
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LT_EQ:    LESSGREATER,
+	token.GT_EQ:    LESSGREATER,
+	token.AND:      AND,
+	token.OR:       OR,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
@@ -52,6 +58,10 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// nesting counts the open parentheses and brackets around the current token.
+	// Newlines only separate statements when nothing is left open.
+	nesting int
 }
 
 // New initializes and returns a new Parser given a lexer
@@ -69,6 +79,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBooleanExpression)
@@ -77,9 +88,15 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE_START, p.parseInterpolatedString)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
-	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.LBRACE, p.parseBraceExpression)
 	p.registerPrefix(token.COMMENT, p.parseCommentLiteral)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.SPAWN, p.parseSpawnExpression)
+	p.registerPrefix(token.SWITCH, p.parseSwitchExpression)
 
 	// Initialize infix parsing functions for the corresponding token types
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -91,6 +108,10 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
@@ -134,9 +155,21 @@ func (p *Parser) ParseProgram() *ast.Program {
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
+		if p.peekTokenIs(token.LPAREN) {
+			return p.parseDestructuringLetStatement()
+		}
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.IDENT:
+		if p.peekTokenIs(token.ASSIGN) {
+			return p.parseAssignStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -160,7 +193,94 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	// Let the function refer to itself by the name it is bound to
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseAssignStatement parses and returns an assignment to an existing name.
+// Eg: x = x + 1;
+func (p *Parser) parseAssignStatement() *ast.AssignStatement {
+	stmt := &ast.AssignStatement{Token: p.curToken}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	p.nextToken()
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseWhileStatement parses and returns an AST WhileStatement node.
+// Eg: while (x > 0) { x = x - 1; }
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseDestructuringLetStatement parses and returns a let statement AST node that unpacks a tuple.
+// Eg: let (x, y) = f();
+func (p *Parser) parseDestructuringLetStatement() *ast.DestructuringLetStatement {
+	stmt := &ast.DestructuringLetStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Names = p.parseFunctionParameters()
+	if stmt.Names == nil {
+		return nil
+	}
+
+	for _, name := range stmt.Names {
+		if name.Token.Type != token.IDENT {
+			msg := fmt.Sprintf("cannot destructure into %s", name.Token.Literal)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -202,7 +322,22 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseThrowStatement parses and returns an AST ThrowStatement node
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -242,7 +377,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 	leftExp := prefix()
 
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	for !p.peekTokenIs(token.SEMICOLON) && !p.peekTokenOnNewLine() && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -291,6 +426,22 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// parseFloatLiteral parses and returns an AST FloatLiteral node
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("Could not parse %q as float", p.curToken.Literal)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
 // parsePrefixExpression parses and returns an AST PrefixExpression node.
 // Eg: !5; -f(a, b); !flag(x);
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -309,6 +460,11 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return expression
 }
 
+// peekTokenOnNewLine returns true if a newline before peekToken ends the current statement
+func (p *Parser) peekTokenOnNewLine() bool {
+	return p.nesting == 0 && p.peekToken.AfterNewline
+}
+
 // peekPrecedence returns the precedence of Parser's peekToken type
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
@@ -352,12 +508,29 @@ func (p *Parser) parseBooleanExpression() ast.Expression {
 	}
 }
 
-// parseGroupedExpression parses and return an AST Expression node for expressions wrapped in parenthesis
+// parseGroupedExpression parses and return an AST Expression node for expressions wrapped in parenthesis.
+// A comma inside the parenthesis makes it a TupleLiteral. Eg: (a, b)
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	tok := p.curToken
 	p.nextToken()
 
+	p.nesting++
 	exp := p.parseExpression(LOWEST)
 
+	if p.peekTokenIs(token.COMMA) {
+		tuple := &ast.TupleLiteral{Token: tok, Elements: []ast.Expression{exp}}
+
+		for p.peekTokenIs(token.COMMA) {
+			// Advancing twice to move onto COMMA first, then onto the next element
+			p.nextToken()
+			p.nextToken()
+
+			tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
+		}
+		exp = tuple
+	}
+	p.nesting--
+
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
@@ -399,11 +572,142 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// parseTryExpression parses `try { ... } catch (name) { ... }`
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Handler = p.parseBlockStatement()
+
+	return expression
+}
+
+// parseSpawnExpression parses `spawn <function>`. The function binds tighter
+// than spawn, so `spawn make(1)` spawns the function make(1) returns
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	expression := &ast.SpawnExpression{Token: p.curToken}
+
+	p.nextToken()
+
+	expression.Function = p.parseExpression(PREFIX)
+	if expression.Function == nil {
+		return nil
+	}
+
+	return expression
+}
+
+// parseSwitchExpression parses
+// `switch (value) { case a, b { ... } case c { ... } default { ... } }`
+func (p *Parser) parseSwitchExpression() ast.Expression {
+	expression := &ast.SwitchExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for p.nextToken(); !p.curTokenIs(token.RBRACE); p.nextToken() {
+		switch p.curToken.Type {
+		case token.COMMENT:
+			continue
+
+		case token.CASE:
+			c := p.parseSwitchCase()
+			if c == nil {
+				return nil
+			}
+			expression.Cases = append(expression.Cases, c)
+
+		case token.DEFAULT:
+			if expression.Default != nil {
+				p.errors = append(p.errors, "switch has more than one default case")
+				return nil
+			}
+
+			if !p.expectPeek(token.LBRACE) {
+				return nil
+			}
+			expression.Default = p.parseBlockStatement()
+
+		default:
+			msg := fmt.Sprintf("expected case or default in switch. got %s instead", p.curToken.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+	}
+
+	return expression
+}
+
+// parseSwitchCase parses `case a, b { ... }`
+func (p *Parser) parseSwitchCase() *ast.SwitchCase {
+	c := &ast.SwitchCase{Token: p.curToken}
+
+	p.nextToken()
+	c.Values = append(c.Values, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		c.Values = append(c.Values, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	c.Body = p.parseBlockStatement()
+
+	return c
+}
+
 // parseBlockStatement parses and returns an AST BlockStatement node for if-else blocks
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
+	// Statements inside a block are separated by newlines again
+	nesting := p.nesting
+	p.nesting = 0
+	defer func() { p.nesting = nesting }()
+
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
@@ -436,6 +740,25 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+// parseMacroLiteral parses a macro, which has the parameters and body of a function
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
 // parseFunctionParameters parses and returns a slice of AST Idenifier nodes as function parameters
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
@@ -506,6 +829,54 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseImportExpression parses import("path"), whose path must be a plain string literal
+func (p *Parser) parseImportExpression() ast.Expression {
+	exp := &ast.ImportExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.STRING) {
+		return nil
+	}
+	exp.Path = p.curToken.Literal
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return exp
+}
+
+// parseInterpolatedString parses the text and ${...} expressions of a backtick string
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+
+	for !p.peekTokenIs(token.TEMPLATE_END) {
+		p.nextToken()
+
+		switch p.curToken.Type {
+		case token.TEMPLATE_TEXT:
+			str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+
+		case token.INTERP_START:
+			p.nextToken()
+
+			p.nesting++
+			str.Parts = append(str.Parts, p.parseExpression(LOWEST))
+			p.nesting--
+
+			if !p.expectPeek(token.INTERP_END) {
+				return nil
+			}
+
+		default:
+			p.peekError(token.TEMPLATE_END)
+			return nil
+		}
+	}
+	p.nextToken()
+
+	return str
+}
+
 // parseArrayLiteral returns an Array
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
@@ -524,13 +895,21 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		return list
 	}
 
+	p.nesting++
+	defer func() { p.nesting-- }()
+
 	p.nextToken()
 	list = append(list, p.parseExpression(LOWEST))
 
 	for p.peekTokenIs(token.COMMA) {
-
-		// Advancing twice to move onto COMMA first, then onto the next element
 		p.nextToken()
+
+		// A trailing comma before the end of the list is allowed
+		if p.peekTokenIs(end) {
+			break
+		}
+
+		// Advance from the COMMA onto the next element
 		p.nextToken()
 
 		list = append(list, p.parseExpression(LOWEST))
@@ -550,7 +929,9 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 
 	p.nextToken()
 
+	p.nesting++
 	exp.Index = p.parseExpression(LOWEST)
+	p.nesting--
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
@@ -559,10 +940,62 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+// parseBraceExpression parses either a hash literal or a block expression starting at '{'
+func (p *Parser) parseBraceExpression() ast.Expression {
+	if p.braceStartsBlock() {
+		return &ast.BlockExpression{Token: p.curToken, Block: p.parseBlockStatement()}
+	}
+	return p.parseHashLiteral()
+}
+
+// braceStartsBlock looks ahead from the current '{' to decide whether it opens a block.
+// A block is assumed unless a ':' appears before the matching '}' at the same depth.
+func (p *Parser) braceStartsBlock() bool {
+	switch p.peekToken.Type {
+	case token.RBRACE:
+		return false // {} stays an empty hash
+	case token.LET, token.RETURN:
+		return true
+	}
+
+	// Scan a copy of the lexer so the parser's position is untouched
+	lookahead := *p.l
+	tok := p.peekToken
+	depth := 0
+
+	for tok.Type != token.EOF {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET:
+			depth--
+		case token.RBRACE:
+			if depth == 0 {
+				return true
+			}
+			depth--
+		case token.COLON, token.COMMA:
+			if depth == 0 {
+				return false
+			}
+		case token.SEMICOLON:
+			if depth == 0 {
+				return true
+			}
+		}
+		tok = lookahead.NextToken()
+	}
+
+	return false
+}
+
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
 
+	p.nesting++
+	defer func() { p.nesting-- }()
+
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
@@ -138,6 +138,44 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+		literal  string
+	}{
+		{"1.5;", 1.5, "1.5"},
+		{"0.25", 0.25, "0.25"},
+		{"10.0", 10, "10.0"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+
+		if literal.TokenLiteral() != tt.literal {
+			t.Errorf("literal.TokenLiteral() not %s. got=%s", tt.literal, literal.TokenLiteral())
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input        string
@@ -197,6 +235,10 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"true && false", true, "&&", false},
+		{"false || true", false, "||", true},
 	}
 
 	for _, tt := range infixTests {
@@ -270,6 +312,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a + b * c + d / e - f",
 			"(((a + (b * c)) + (d / e)) - f)",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a == b && c <= d + 1 || !e",
+			"(((a == b) && (c <= (d + 1))) || (!e))",
+		},
+		{
+			"a >= b == c < d",
+			"((a >= b) == (c < d))",
+		},
 		{
 			"3 + 4; -5 * 5",
 			"(3 + 4)((-5) * 5)",
@@ -538,6 +592,73 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T\n", program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T\n", stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n", len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements does not contain %d statements. got=%d\n", 1, len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T", macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionLiteralWithName(t *testing.T) {
+	input := `let myFunction = fn() { };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+	}
+
+	if function.Name != "myFunction" {
+		t.Fatalf("function literal name wrong. want 'myFunction', got=%q\n", function.Name)
+	}
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -623,6 +744,32 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedString(t *testing.T) {
+	program := parseProgramString(t, "`hello ${name}, you are ${age + 1}`")
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+	}
+
+	if len(str.Parts) != 4 {
+		t.Fatalf("str.Parts has wrong length. got=%d", len(str.Parts))
+	}
+
+	text, ok := str.Parts[0].(*ast.StringLiteral)
+	if !ok || text.Value != "hello " {
+		t.Errorf("str.Parts[0] is not text %q. got=%+v", "hello ", str.Parts[0])
+	}
+	testIdentifier(t, str.Parts[1], "name")
+	testInfixExpression(t, str.Parts[3], "age", "+", 1)
+
+	expected := "`hello ${name}, you are ${(age + 1)}`"
+	if str.String() != expected {
+		t.Errorf("str.String() wrong. want=%q, got=%q", expected, str.String())
+	}
+}
+
 func TestParsingIndexExpression(t *testing.T) {
 	input := "myArray[1 + 1]"
 
@@ -669,6 +816,46 @@ func TestArrayLiteral(t *testing.T) {
 	testIntegerLiteral(t, array.Elements[0], 1)
 }
 
+func TestTrailingCommas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3,]", "[1, 2, 3]"},
+		{"[1,]", "[1]"},
+		{"[\n1,\n2,\n]", "[1, 2]"},
+		{"add(1, 2,)", "add(1, 2)"},
+		{`{"a": 1, "b": 2,}`, ""},
+	}
+
+	for _, tt := range tests {
+		program := parseProgramString(t, tt.input)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if hash, ok := stmt.Expression.(*ast.HashLiteral); ok {
+			if len(hash.Pairs) != 2 {
+				t.Errorf("%q: hash.Pairs has wrong length. got=%d", tt.input, len(hash.Pairs))
+			}
+			continue
+		}
+
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("%q: wrong expression. want=%q, got=%q",
+				tt.input, tt.expected, stmt.Expression.String())
+		}
+	}
+
+	for _, input := range []string{"[,]", "{,}", "[1,,]", `{"a": 1,,}`} {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -840,6 +1027,363 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestBlockExpression(t *testing.T) {
+	input := `let x = { let y = 2; y * 3 }`
+
+	program := parseProgramString(t, input)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.LetStatement)
+	block, ok := stmt.Value.(*ast.BlockExpression)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.BlockExpression. got=%T", stmt.Value)
+	}
+
+	if len(block.Block.Statements) != 2 {
+		t.Fatalf("block does not contain 2 statements. got=%d", len(block.Block.Statements))
+	}
+
+	if !testLetStatement(t, block.Block.Statements[0], "y") {
+		return
+	}
+
+	last, ok := block.Block.Statements[1].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("last statement is not ast.ExpressionStatement. got=%T", block.Block.Statements[1])
+	}
+
+	testInfixExpression(t, last.Expression, "y", "*", 3)
+}
+
+func TestBraceDisambiguation(t *testing.T) {
+	tests := []struct {
+		input   string
+		isBlock bool
+	}{
+		{`{}`, false},
+		{`{"a": 1}`, false},
+		{`{fn(x) { x }(1): {1: 2}}`, false},
+		{`{ 1 }`, true},
+		{`{ let a = 1; a }`, true},
+		{`{ f(1, 2) }`, true},
+		{`{ if (true) { 1 } else { 2 } }`, true},
+		{"{ a\n b }", true},
+	}
+
+	for _, tt := range tests {
+		program := parseProgramString(t, tt.input)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		_, isBlock := stmt.Expression.(*ast.BlockExpression)
+		if isBlock != tt.isBlock {
+			t.Errorf("%q: wrong brace expression. got=%T", tt.input, stmt.Expression)
+		}
+	}
+}
+
+func TestTupleLiteral(t *testing.T) {
+	program := parseProgramString(t, "(1, a, 2 * 3)")
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	tuple, ok := stmt.Expression.(*ast.TupleLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.TupleLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(tuple.Elements) != 3 {
+		t.Fatalf("len(tuple.Elements) not 3. got=%d", len(tuple.Elements))
+	}
+
+	testIntegerLiteral(t, tuple.Elements[0], 1)
+	testIdentifier(t, tuple.Elements[1], "a")
+	testInfixExpression(t, tuple.Elements[2], 2, "*", 3)
+
+	// A single parenthesized expression is still just grouping
+	program = parseProgramString(t, "(1)")
+	stmt = program.Statements[0].(*ast.ExpressionStatement)
+	testIntegerLiteral(t, stmt.Expression, 1)
+}
+
+func TestDestructuringLetStatement(t *testing.T) {
+	program := parseProgramString(t, "let (x, y) = f();")
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.DestructuringLetStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.DestructuringLetStatement. got=%T", program.Statements[0])
+	}
+
+	if len(stmt.Names) != 2 {
+		t.Fatalf("wrong number of names. want=2, got=%d", len(stmt.Names))
+	}
+
+	testIdentifier(t, stmt.Names[0], "x")
+	testIdentifier(t, stmt.Names[1], "y")
+
+	if stmt.String() != "let (x, y) = f();" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+
+	l := lexer.New("let (x, 1) = f();")
+	p := New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected parser error for non-identifier name")
+	}
+}
+
+func TestImportExpression(t *testing.T) {
+	program := parseProgramString(t, `let m = import("lib/math.monkey");`)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	imp, ok := stmt.Value.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.ImportExpression. got=%T", stmt.Value)
+	}
+
+	if imp.Path != "lib/math.monkey" {
+		t.Errorf("imp.Path wrong. want=%q, got=%q", "lib/math.monkey", imp.Path)
+	}
+	if imp.String() != `import("lib/math.monkey")` {
+		t.Errorf("imp.String() wrong. got=%q", imp.String())
+	}
+
+	for _, input := range []string{`import "a"`, `import(a)`, `import("a", "b")`} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%s: expected parser errors", input)
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	program := parseProgramString(t, "while (x < y) { x = x + 1; }")
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statements. got=%d", len(stmt.Body.Statements))
+	}
+
+	assign, ok := stmt.Body.Statements[0].(*ast.AssignStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.AssignStatement. got=%T", stmt.Body.Statements[0])
+	}
+
+	testIdentifier(t, assign.Name, "x")
+	testInfixExpression(t, assign.Value, "x", "+", 1)
+
+	if stmt.String() != "while(x < y) x = (x + 1);" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	program := parseProgramString(t, "try { xs[0] } catch (e) { e }")
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	try, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression not *ast.TryExpression. got=%T", stmt.Expression)
+	}
+
+	if len(try.Block.Statements) != 1 || len(try.Handler.Statements) != 1 {
+		t.Fatalf("wrong number of statements. block=%d, handler=%d",
+			len(try.Block.Statements), len(try.Handler.Statements))
+	}
+
+	testIdentifier(t, try.Param, "e")
+
+	if try.String() != "try (xs[0]) catch (e) e" {
+		t.Errorf("try.String() wrong. got=%q", try.String())
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []string{
+		"try { 1 }",
+		"try { 1 } catch { 2 }",
+		"try { 1 } catch (1) { 2 }",
+		"try 1 catch (e) { 2 }",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("no parser errors for %q", input)
+		}
+	}
+}
+
+func TestSwitchExpression(t *testing.T) {
+	input := `
+	switch (x) {
+		case 1, 2 { "small" }
+		// comments may sit between cases
+		case y { y }
+		default { x }
+	}`
+	program := parseProgramString(t, input)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	switchExp, ok := stmt.Expression.(*ast.SwitchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression not *ast.SwitchExpression. got=%T", stmt.Expression)
+	}
+
+	testIdentifier(t, switchExp.Value, "x")
+
+	if len(switchExp.Cases) != 2 {
+		t.Fatalf("wrong number of cases. want=2, got=%d", len(switchExp.Cases))
+	}
+	if len(switchExp.Cases[0].Values) != 2 || len(switchExp.Cases[1].Values) != 1 {
+		t.Fatalf("wrong case values. got=%d and %d",
+			len(switchExp.Cases[0].Values), len(switchExp.Cases[1].Values))
+	}
+	testLiteralExpression(t, switchExp.Cases[0].Values[0], 1)
+	testLiteralExpression(t, switchExp.Cases[0].Values[1], 2)
+	testIdentifier(t, switchExp.Cases[1].Values[0], "y")
+
+	if switchExp.Default == nil {
+		t.Fatalf("default case missing")
+	}
+
+	expected := "switchx { case 1, 2 small case y y default x }"
+	if switchExp.String() != expected {
+		t.Errorf("switchExp.String() wrong. want=%q, got=%q", expected, switchExp.String())
+	}
+}
+
+func TestSwitchExpressionErrors(t *testing.T) {
+	tests := []string{
+		"switch x { case 1 { 1 } }",
+		"switch (x) { case 1 1 }",
+		"switch (x) { 1 { 1 } }",
+		"switch (x) { default { 1 } default { 2 } }",
+		"switch (x) { case 1 { 1 }",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("no parser errors for %q", input)
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	program := parseProgramString(t, "throw err; throw x + 1")
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	expected := []string{"throw err;", "throw (x + 1);"}
+	for i, want := range expected {
+		stmt, ok := program.Statements[i].(*ast.ThrowStatement)
+		if !ok {
+			t.Fatalf("Statements[%d] not *ast.ThrowStatement. got=%T", i, program.Statements[i])
+		}
+		if stmt.String() != want {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", want, stmt.String())
+		}
+	}
+}
+
+func TestSpawnExpression(t *testing.T) {
+	program := parseProgramString(t, "spawn fn() { 1 }; spawn worker(n)")
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	expected := []string{"spawn fn() 1", "spawn worker(n)"}
+	for i, want := range expected {
+		stmt, ok := program.Statements[i].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("Statements[%d] not *ast.ExpressionStatement. got=%T", i, program.Statements[i])
+		}
+		if _, ok := stmt.Expression.(*ast.SpawnExpression); !ok {
+			t.Fatalf("Statements[%d] is not ast.SpawnExpression. got=%T", i, stmt.Expression)
+		}
+		if stmt.String() != want {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", want, stmt.String())
+		}
+	}
+
+	p := New(lexer.New("spawn"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("no parser errors for a spawn without a function")
+	}
+}
+
+func TestAssignStatement(t *testing.T) {
+	program := parseProgramString(t, "x = 5; x == 5;")
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.AssignStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.AssignStatement. got=%T", program.Statements[0])
+	}
+
+	testIdentifier(t, stmt.Name, "x")
+	testLiteralExpression(t, stmt.Value, 5)
+
+	if _, ok := program.Statements[1].(*ast.ExpressionStatement); !ok {
+		t.Errorf("comparison not parsed as ast.ExpressionStatement. got=%T", program.Statements[1])
+	}
+}
+
 func TestCommentLiteralExpression(t *testing.T) {
 	tests := []struct {
 		input              string
@@ -867,6 +1411,50 @@ func TestCommentLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestStatementSeparators(t *testing.T) {
+	tests := []struct {
+		newlines   string
+		semicolons string
+		statements int
+	}{
+		{"let a = 1\nlet b = 2", "let a = 1; let b = 2", 2},
+		{"let a = 1\n  let b = 2\n", "let a = 1; let b = 2;", 2},
+		{"a\n-1", "a; -1", 2},
+		{"return a\nb", "return a; b", 2},
+		{"let a = 1 +\n 2\na", "let a = 1 + 2; a", 2},
+		{"let a = (1\n + 2)\na", "let a = (1 + 2); a", 2},
+		{"add(1,\n 2)\n[1\n, 2]", "add(1, 2); [1, 2]", 2},
+		{"{\"a\": 1\n-1}\n{\"b\"\n: 2}", "{\"a\": 1 - 1}; {\"b\": 2}", 2},
+		{"if (x) {\n let a = 1\n a\n -1\n}", "if (x) { let a = 1; a; -1 }", 1},
+	}
+
+	for _, tt := range tests {
+		withNewlines := parseProgramString(t, tt.newlines)
+		withSemicolons := parseProgramString(t, tt.semicolons)
+
+		if len(withNewlines.Statements) != tt.statements {
+			t.Errorf("%q: wrong number of statements. want=%d, got=%d",
+				tt.newlines, tt.statements, len(withNewlines.Statements))
+		}
+
+		if withNewlines.String() != withSemicolons.String() {
+			t.Errorf("programs differ.\nnewlines=%q\nsemicolons=%q",
+				withNewlines.String(), withSemicolons.String())
+		}
+	}
+}
+
+func parseProgramString(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	return program
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
@@ -0,0 +1,139 @@
+package repl
+
+import (
+	"fmt"
+	"go-compiler/src/monkey/ast"
+	"go-compiler/src/monkey/lexer"
+	"go-compiler/src/monkey/parser"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// processAST parses the input and prints its AST without compiling or running it
+func processAST(input string, out io.Writer) {
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return
+	}
+
+	dumpAST(out, program, 0)
+}
+
+// dumpAST prints node and its children, one per line, indented by depth
+func dumpAST(out io.Writer, node ast.Node, depth int) {
+	name := strings.TrimPrefix(reflect.TypeOf(node).String(), "*ast.")
+	fmt.Fprintf(out, "%s%s %s\n", strings.Repeat("  ", depth), name, node.String())
+
+	for _, child := range astChildren(node) {
+		dumpAST(out, child, depth+1)
+	}
+}
+
+// astChildren returns the child nodes of node in source order
+func astChildren(node ast.Node) []ast.Node {
+	children := []ast.Node{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			children = append(children, s)
+		}
+	case *ast.LetStatement:
+		children = append(children, node.Name, node.Value)
+	case *ast.DestructuringLetStatement:
+		for _, name := range node.Names {
+			children = append(children, name)
+		}
+		children = append(children, node.Value)
+	case *ast.ReturnStatement:
+		children = append(children, node.ReturnValue)
+	case *ast.AssignStatement:
+		children = append(children, node.Name, node.Value)
+	case *ast.WhileStatement:
+		children = append(children, node.Condition, node.Body)
+	case *ast.ThrowStatement:
+		children = append(children, node.Value)
+	case *ast.ExpressionStatement:
+		children = append(children, node.Expression)
+	case *ast.PrefixExpression:
+		children = append(children, node.Right)
+	case *ast.InfixExpression:
+		children = append(children, node.Left, node.Right)
+	case *ast.IfExpression:
+		children = append(children, node.Condition, node.Consequence)
+		if node.Alternative != nil {
+			children = append(children, node.Alternative)
+		}
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			children = append(children, s)
+		}
+	case *ast.BlockExpression:
+		children = append(children, node.Block)
+	case *ast.TryExpression:
+		children = append(children, node.Block, node.Param, node.Handler)
+	case *ast.SwitchExpression:
+		children = append(children, node.Value)
+		for _, c := range node.Cases {
+			children = append(children, c)
+		}
+		if node.Default != nil {
+			children = append(children, node.Default)
+		}
+	case *ast.SwitchCase:
+		for _, v := range node.Values {
+			children = append(children, v)
+		}
+		children = append(children, node.Body)
+	case *ast.SpawnExpression:
+		children = append(children, node.Function)
+	case *ast.FunctionLiteral:
+		for _, param := range node.Parameters {
+			children = append(children, param)
+		}
+		children = append(children, node.Body)
+	case *ast.MacroLiteral:
+		for _, param := range node.Parameters {
+			children = append(children, param)
+		}
+		children = append(children, node.Body)
+	case *ast.CallExpression:
+		children = append(children, node.Function)
+		for _, arg := range node.Arguments {
+			children = append(children, arg)
+		}
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			children = append(children, part)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			children = append(children, el)
+		}
+	case *ast.TupleLiteral:
+		for _, el := range node.Elements {
+			children = append(children, el)
+		}
+	case *ast.IndexExpression:
+		children = append(children, node.Left, node.Index)
+	case *ast.HashLiteral:
+		// Order keys by their source text so the dump is stable
+		keys := []ast.Expression{}
+		for key := range node.Pairs {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+		for _, key := range keys {
+			children = append(children, key, node.Pairs[key])
+		}
+	}
+
+	return children
+}
@@ -0,0 +1,69 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProcessAST(t *testing.T) {
+	var out bytes.Buffer
+	processAST("1 + 2 * 3", &out)
+
+	expected := `Program (1 + (2 * 3))
+  ExpressionStatement (1 + (2 * 3))
+    InfixExpression (1 + (2 * 3))
+      IntegerLiteral 1
+      InfixExpression (2 * 3)
+        IntegerLiteral 2
+        IntegerLiteral 3
+`
+
+	if out.String() != expected {
+		t.Errorf("wrong AST dump.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestProcessASTNested(t *testing.T) {
+	var out bytes.Buffer
+	processAST(`let x = if (a) { [1] } else { {"k": f(2)} };`, &out)
+
+	expected := []string{
+		"Program ",
+		"  LetStatement let x = ",
+		"    Identifier x",
+		"    IfExpression ",
+		"      Identifier a",
+		"      BlockStatement [1]",
+		"        ExpressionStatement [1]",
+		"          ArrayLiteral [1]",
+		"            IntegerLiteral 1",
+		"      BlockStatement ",
+		"        ExpressionStatement ",
+		"          HashLiteral {k:f(2)}",
+		"            StringLiteral k",
+		"            CallExpression f(2)",
+		"              Identifier f",
+		"              IntegerLiteral 2",
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong number of lines. want=%d, got=%d\n%s", len(expected), len(lines), out.String())
+	}
+
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d wrong. want prefix %q, got=%q", i, prefix, lines[i])
+		}
+	}
+}
+
+func TestProcessASTParserErrors(t *testing.T) {
+	var out bytes.Buffer
+	processAST("let = 1", &out)
+
+	if !strings.Contains(out.String(), "parser errors:") {
+		t.Errorf("parser errors not reported. got=%q", out.String())
+	}
+}
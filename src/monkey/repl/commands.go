@@ -0,0 +1,192 @@
+package repl
+
+import (
+	"fmt"
+	"go-compiler/src/monkey/compiler"
+	"go-compiler/src/monkey/monkey"
+	"go-compiler/src/monkey/object"
+	"go-compiler/src/monkey/vm"
+	"io"
+	"os"
+	"strings"
+)
+
+// session is the state the REPL keeps between inputs
+type session struct {
+	// State of the VM engine
+	constants   []object.Object
+	globals     []object.Object
+	symbolTable *compiler.SymbolTable
+
+	// State of the evaluator engine, nil when running on the VM
+	env *object.Environment
+
+	// Macros defined so far, expanded in later inputs on either engine
+	macros *object.Environment
+
+	// history holds the inputs that compiled, in order, for the save command
+	history []string
+
+	// Base used to display integer results
+	base int
+
+	// Bytecode of the last compiled input, shown by the bytecode command
+	lastBytecode *compiler.Bytecode
+
+	evaluate bool // run on the evaluator rather than the VM
+	color    bool
+}
+
+func newSession(config Config) *session {
+	s := &session{
+		base:     10,
+		evaluate: config.Engine.Name() == monkey.Evaluator.Name(),
+		color:    config.Color,
+	}
+	s.reset()
+	return s
+}
+
+// reset forgets every definition, keeping the display base
+func (s *session) reset() {
+	s.history = nil
+	s.lastBytecode = nil
+	s.macros = object.NewEnvironment()
+
+	if s.evaluate {
+		s.env = object.NewEnvironment()
+		return
+	}
+
+	s.constants = []object.Object{}
+	s.globals = make([]object.Object, vm.GlobalsSize)
+	s.symbolTable = compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		s.symbolTable.DefineBuiltin(i, v.Name)
+	}
+}
+
+// A command is a REPL meta command, entered as :name or .name
+type command struct {
+	name  string
+	usage string
+	help  string
+	run   func(s *session, arg string, out io.Writer)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"load", ":load <file>", "run a file, keeping its definitions", loadFile},
+		{"save", ":save <file>", "write the inputs of this session to a file", saveHistory},
+		{"reset", ":reset", "forget every definition", func(s *session, _ string, _ io.Writer) { s.reset() }},
+		{"env", ":env", "list the globals that are defined", printEnv},
+		{"base", ":base [2|8|10|16]", "show or set the base integers are printed in", func(s *session, arg string, out io.Writer) {
+			s.base = setBase(out, arg, s.base)
+		}},
+		{"ast", ":ast <input>", "print the syntax tree of input", func(_ *session, arg string, out io.Writer) {
+			processAST(arg, out)
+		}},
+		{"bytecode", ":bytecode", "disassemble the last compiled input", func(s *session, _ string, out io.Writer) {
+			printBytecode(out, s.lastBytecode)
+		}},
+		{"help", ":help", "list the commands", printHelp},
+	}
+}
+
+// isCommand reports whether line is a meta command rather than Monkey input,
+// which can never start with either prefix
+func isCommand(line string) bool {
+	return strings.HasPrefix(line, ":") || strings.HasPrefix(line, ".")
+}
+
+// command runs the meta command in line
+func (s *session) command(line string, out io.Writer) {
+	name, arg, _ := strings.Cut(line[1:], " ")
+	arg = strings.TrimSpace(arg)
+
+	for _, c := range commands {
+		if c.name == name {
+			c.run(s, arg, out)
+			return
+		}
+	}
+
+	fmt.Fprintf(out, "unknown command %q, enter :help for commands\n", name)
+}
+
+func printHelp(_ *session, _ string, out io.Writer) {
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-20s %s\n", c.usage, c.help)
+	}
+	io.WriteString(out, "commands can also start with '.', and exit() leaves the REPL\n")
+}
+
+// loadFile handles `:load <file>`, running the file as a single input
+func loadFile(s *session, file string, out io.Writer) {
+	if file == "" {
+		io.WriteString(out, "usage: :load <file>\n")
+		return
+	}
+
+	src, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(out, "%s\n", err)
+		return
+	}
+
+	s.eval(string(src), out)
+}
+
+// saveHistory handles `:save <file>`, writing a file that :load can replay
+func saveHistory(s *session, file string, out io.Writer) {
+	if file == "" {
+		io.WriteString(out, "usage: :save <file>\n")
+		return
+	}
+
+	var src strings.Builder
+	for _, input := range s.history {
+		src.WriteString(strings.TrimRight(input, "\n"))
+		src.WriteString("\n")
+	}
+
+	err := os.WriteFile(file, []byte(src.String()), 0644)
+	if err != nil {
+		fmt.Fprintf(out, "%s\n", err)
+		return
+	}
+	fmt.Fprintf(out, "saved %d input(s) to %s\n", len(s.history), file)
+}
+
+// printEnv handles `:env`, listing the globals in the order they were
+// defined, or by name on the evaluator
+func printEnv(s *session, _ string, out io.Writer) {
+	names := []string{}
+	values := []object.Object{}
+
+	if s.evaluate {
+		for _, name := range s.env.Names() {
+			value, _ := s.env.Get(name)
+			names, values = append(names, name), append(values, value)
+		}
+	} else {
+		for _, symbol := range s.symbolTable.Globals() {
+			names, values = append(names, symbol.Name), append(values, s.globals[symbol.Index])
+		}
+	}
+
+	if len(names) == 0 {
+		io.WriteString(out, "no globals defined\n")
+		return
+	}
+
+	for i, name := range names {
+		value := "<unset>"
+		if values[i] != nil {
+			value = object.InspectInBase(values[i], s.base)
+		}
+		fmt.Fprintf(out, "%s = %s\n", name, value)
+	}
+}
@@ -0,0 +1,92 @@
+package repl
+
+import (
+	"bytes"
+	"go-compiler/src/monkey/monkey"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSessionKeepsDefinitions(t *testing.T) {
+	s := newTestSession(monkey.VM)
+
+	var out bytes.Buffer
+	s.eval(`let greet = fn(name) { "hello " + name };`, &out)
+	s.eval(`greet("monkey")`, &out)
+
+	if !strings.HasSuffix(out.String(), "hello monkey\n") {
+		t.Errorf("function defined by an earlier input failed. got=%q", out.String())
+	}
+}
+
+func TestSessionKeepsMacros(t *testing.T) {
+	for _, engine := range []monkey.Engine{monkey.VM, monkey.Evaluator} {
+		s := newTestSession(engine)
+
+		var out bytes.Buffer
+		s.eval(`let swap = macro(a, b) { quote([unquote(b), unquote(a)]) };`, &out)
+		s.eval(`swap(1, 2)`, &out)
+		s.eval(`swap(1)`, &out)
+
+		expected := "[2, 1]\nWhoops! Macro expansion failed: \n wrong number of arguments to macro swap: want=2, got=1\n"
+		if !strings.HasSuffix(out.String(), expected) {
+			t.Errorf("%s: macro not kept between inputs. got=%q", engine.Name(), out.String())
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "session.monkey")
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{":env", "no globals defined\n"},
+		{"let a = 10;", ""},
+		{"let double = fn(x) { x * 2 };", ""},
+		{"undefined", "undefined variable undefined"},
+		{".base 16", ""},
+		{":env", "a = 0xa\ndouble = Closure["},
+		{":save " + file, "saved 2 input(s) to " + file + "\n"},
+		{":reset", ""},
+		{":env", "no globals defined\n"},
+		{":base", "base 16\n"},
+		{":base 10", ""},
+		{":load " + file, ""},
+		{"double(a)", "20\n"},
+		{":load", "usage: :load <file>\n"},
+		{":ast 1 + 2", "InfixExpression"},
+		{":bytecode", "OpCall"},
+		{":bogus", "unknown command \"bogus\", enter :help for commands\n"},
+		{":help", "  :load <file>"},
+	}
+
+	s := newTestSession(monkey.VM)
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if isCommand(tt.line) {
+			s.command(tt.line, &out)
+		} else {
+			s.eval(tt.line, &out)
+		}
+
+		if tt.expected == "" {
+			continue
+		}
+		if !strings.Contains(out.String(), tt.expected) {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.line, tt.expected, out.String())
+		}
+	}
+
+	saved, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("session not saved: %s", err)
+	}
+	expected := "let a = 10;\nlet double = fn(x) { x * 2 };\n"
+	if string(saved) != expected {
+		t.Errorf("wrong saved session. want=%q, got=%q", expected, saved)
+	}
+}
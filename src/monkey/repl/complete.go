@@ -0,0 +1,79 @@
+package repl
+
+import (
+	"go-compiler/src/monkey/object"
+	"go-compiler/src/monkey/token"
+	"sort"
+	"strings"
+)
+
+// completer completes the word before the cursor from the keywords, the
+// builtins and the globals of a session, or a command name after ':' or '.'.
+// It reads the session on every completion, so new definitions are offered
+// as soon as they compile
+type completer struct {
+	session *session
+}
+
+// Do implements readline.AutoCompleter, returning the rest of each candidate
+// and the length of the word being completed
+func (c *completer) Do(line []rune, pos int) ([][]rune, int) {
+	start := pos
+	for start > 0 && isIdentifierRune(line[start-1]) {
+		start--
+	}
+	word := string(line[start:pos])
+
+	var candidates []string
+	if start == 1 && isCommand(string(line[:1])) {
+		for _, cmd := range commands {
+			candidates = append(candidates, cmd.name)
+		}
+	} else if word != "" {
+		candidates = c.names()
+	}
+
+	suffixes := [][]rune{}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) && candidate != word {
+			suffixes = append(suffixes, []rune(candidate[len(word):]))
+		}
+	}
+
+	return suffixes, len([]rune(word))
+}
+
+// names returns the keywords, builtins and session globals, sorted and unique
+func (c *completer) names() []string {
+	seen := map[string]bool{}
+	for _, word := range token.Keywords() {
+		seen[word] = true
+	}
+	for _, builtin := range object.Builtins {
+		seen[builtin.Name] = true
+	}
+
+	s := c.session
+	if s.evaluate {
+		for _, name := range s.env.Names() {
+			seen[name] = true
+		}
+	} else {
+		for _, symbol := range s.symbolTable.Globals() {
+			seen[symbol.Name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// isIdentifierRune matches the characters the lexer reads into identifiers
+func isIdentifierRune(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_'
+}
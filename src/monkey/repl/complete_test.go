@@ -0,0 +1,52 @@
+package repl
+
+import (
+	"bytes"
+	"go-compiler/src/monkey/monkey"
+	"reflect"
+	"testing"
+)
+
+func TestCompleter(t *testing.T) {
+	for _, engine := range []monkey.Engine{monkey.VM, monkey.Evaluator} {
+		s := newTestSession(engine)
+		c := &completer{session: s}
+
+		var out bytes.Buffer
+		s.eval("let lenient = 1; let first_name = \"monkey\";", &out)
+
+		tests := []struct {
+			line     string
+			pos      int
+			expected []string
+			length   int
+		}{
+			{"le", 2, []string{"n", "nient", "t"}, 2},
+			{"puts(fir", 8, []string{"st", "st_name"}, 3},
+			{"let x = wh", 10, []string{"ile"}, 2},
+			{"first_name", 10, []string{}, 10},
+			{"fn(", 3, []string{}, 0},
+			{":lo", 3, []string{"ad"}, 2},
+			{".b", 2, []string{"ase", "ytecode"}, 1},
+			{"wh + 1", 2, []string{"ile"}, 2},
+		}
+
+		for _, tt := range tests {
+			suffixes, length := c.Do([]rune(tt.line), tt.pos)
+
+			got := []string{}
+			for _, suffix := range suffixes {
+				got = append(got, string(suffix))
+			}
+			if !reflect.DeepEqual(got, tt.expected) || length != tt.length {
+				t.Errorf("%s: wrong completion of %q. want=%q (%d), got=%q (%d)",
+					engine.Name(), tt.line[:tt.pos], tt.expected, tt.length, got, length)
+			}
+		}
+
+		s.command(":reset", &out)
+		if suffixes, _ := c.Do([]rune("leni"), 4); len(suffixes) != 0 {
+			t.Errorf("%s: completed a definition forgotten by :reset", engine.Name())
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"go-compiler/src/monkey/compiler"
+	"go-compiler/src/monkey/object"
+	"go-compiler/src/monkey/vm"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DebugPrompt is shown while the debugger waits for a command
+const DebugPrompt = "(debug) "
+
+const debugHelp = `commands:
+  s, step              run one instruction
+  c, continue          run to the next breakpoint or the end of the program
+  b, break <line>      pause wherever the code of a source line starts
+  b, break *<offset>   pause at an instruction offset of the current function
+  clear                remove every breakpoint
+  l, list              disassemble the current function, marking the next instruction
+  stack                print the operand stack, top first
+  globals              print the globals that have been set
+  bt, frames           print the call stack
+  locals               print the locals of the current function
+  q, quit              stop debugging
+`
+
+// Debug runs bytecode on a VM under a vm.Debugger, reading commands from in
+// until the program ends, the input is exhausted or the user quits
+func Debug(bytecode *compiler.Bytecode, in io.Reader, out io.Writer) {
+	machine := vm.New(bytecode)
+	debugger := vm.NewDebugger(machine)
+	scanner := bufio.NewScanner(in)
+
+	io.WriteString(out, "paused before the first instruction, enter `help` for commands\n")
+	printPosition(out, debugger)
+
+	for !debugger.Done() {
+		io.WriteString(out, DebugPrompt)
+		if !scanner.Scan() {
+			return
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "s", "step":
+			debugger.Step()
+			printPosition(out, debugger)
+		case "c", "continue":
+			debugger.Continue()
+			printPosition(out, debugger)
+		case "b", "break":
+			setBreakpoint(out, debugger, fields[1:])
+		case "clear":
+			debugger.ClearBreakpoints()
+		case "l", "list":
+			printListing(out, debugger)
+		case "stack":
+			printStack(out, debugger)
+		case "globals":
+			printGlobals(out, debugger)
+		case "bt", "frames":
+			printFrames(out, debugger)
+		case "locals":
+			printLocals(out, debugger)
+		case "q", "quit":
+			return
+		case "h", "help":
+			io.WriteString(out, debugHelp)
+		default:
+			fmt.Fprintf(out, "unknown command %q, enter `help` for commands\n", fields[0])
+		}
+	}
+
+	if err := debugger.Err(); err != nil {
+		fmt.Fprintf(out, "program failed: %s\n", err)
+		return
+	}
+
+	result := "no value"
+	if value := machine.LastPoppedStackElem(); value != nil {
+		result = value.Inspect()
+	}
+	fmt.Fprintf(out, "program finished: %s\n", result)
+}
+
+// setBreakpoint handles `break <line>` and `break *<offset>`
+func setBreakpoint(out io.Writer, debugger *vm.Debugger, args []string) {
+	if len(args) != 1 {
+		io.WriteString(out, "usage: break <line> or break *<offset>\n")
+		return
+	}
+
+	if offset, ok := strings.CutPrefix(args[0], "*"); ok {
+		n, err := strconv.Atoi(offset)
+		if err != nil {
+			fmt.Fprintf(out, "invalid offset %q\n", offset)
+			return
+		}
+
+		frames := debugger.Frames()
+		err = debugger.SetBreakpoint(frames[len(frames)-1].Function, n)
+		if err != nil {
+			fmt.Fprintf(out, "%s\n", err)
+			return
+		}
+		fmt.Fprintf(out, "breakpoint at %04d\n", n)
+		return
+	}
+
+	line, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Fprintf(out, "invalid line %q\n", args[0])
+		return
+	}
+
+	set, err := debugger.SetLineBreakpoint(line)
+	if err != nil {
+		fmt.Fprintf(out, "%s\n", err)
+		return
+	}
+	fmt.Fprintf(out, "%d breakpoint(s) on line %d\n", set, line)
+}
+
+// printPosition shows the instruction the debugger is paused before
+func printPosition(out io.Writer, debugger *vm.Debugger) {
+	if debugger.Done() {
+		return
+	}
+
+	frames := debugger.Frames()
+	printFrame(out, frames[len(frames)-1])
+}
+
+func printFrame(out io.Writer, frame vm.FrameInfo) {
+	name := "main"
+	if frame.Function >= 0 {
+		name = fmt.Sprintf("fn %d", frame.Function)
+	}
+
+	instruction := "end of instructions"
+	if frame.Offset < len(frame.Instructions) {
+		instruction = frame.Instructions.InstructionString(frame.Offset)
+	}
+
+	if frame.Position.Line == 0 {
+		fmt.Fprintf(out, "%s: %s\n", name, instruction)
+		return
+	}
+	fmt.Fprintf(out, "%s: %s (%s)\n", name, instruction, frame.Position)
+}
+
+// printListing disassembles the current function with an arrow at the next instruction
+func printListing(out io.Writer, debugger *vm.Debugger) {
+	frames := debugger.Frames()
+	frame := frames[len(frames)-1]
+	next := fmt.Sprintf("%04d ", frame.Offset)
+
+	for _, line := range strings.SplitAfter(frame.Instructions.String(), "\n") {
+		if line == "" {
+			continue
+		}
+
+		marker := "   "
+		if strings.HasPrefix(line, next) {
+			marker = "-> "
+		}
+		io.WriteString(out, marker+line)
+	}
+}
+
+func printStack(out io.Writer, debugger *vm.Debugger) {
+	stack := debugger.Stack()
+	if len(stack) == 0 {
+		io.WriteString(out, "stack is empty\n")
+		return
+	}
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		fmt.Fprintf(out, "%4d %s\n", i, inspect(stack[i]))
+	}
+}
+
+func printGlobals(out io.Writer, debugger *vm.Debugger) {
+	globals := debugger.Globals()
+	if len(globals) == 0 {
+		io.WriteString(out, "no globals set\n")
+		return
+	}
+
+	names := make([]string, 0, len(globals))
+	for name := range globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(out, "%s = %s\n", name, globals[name].Inspect())
+	}
+}
+
+func printFrames(out io.Writer, debugger *vm.Debugger) {
+	frames := debugger.Frames()
+	for i := len(frames) - 1; i >= 0; i-- {
+		fmt.Fprintf(out, "#%d ", len(frames)-1-i)
+		printFrame(out, frames[i])
+	}
+}
+
+func printLocals(out io.Writer, debugger *vm.Debugger) {
+	frames := debugger.Frames()
+	locals := frames[len(frames)-1].Locals
+	if len(locals) == 0 {
+		io.WriteString(out, "no locals\n")
+		return
+	}
+
+	for i, local := range locals {
+		fmt.Fprintf(out, "%4d %s\n", i, inspect(local))
+	}
+}
+
+// inspect shows slots that have not been assigned yet as unset
+func inspect(value object.Object) string {
+	if value == nil {
+		return "<unset>"
+	}
+	return value.Inspect()
+}
@@ -3,118 +3,304 @@ package repl
 
 import (
 	"fmt"
+	"go-compiler/src/monkey/ast"
 	"go-compiler/src/monkey/compiler"
+	"go-compiler/src/monkey/evaluator"
 	"go-compiler/src/monkey/lexer"
+	"go-compiler/src/monkey/monkey"
 	"go-compiler/src/monkey/object"
 	"go-compiler/src/monkey/parser"
 	"go-compiler/src/monkey/vm"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/chzyer/readline"
 )
 
-// Constants used in REPL
+// Defaults used by DefaultConfig, and input that ends the REPL
 const (
 	Prompt          = ">> "
 	MultilinePrompt = "... "
 	Exit            = "exit()"
 	Interrupt       = "^C"
+)
 
-	HistoryPath = "/Users/anirudhlakkaraju/Programming/go-compiler/src/monkey/repl_history.txt"
+// ANSI escapes used when Config.Color is set
+const (
+	colorRed   = "\x1b[31m"
+	colorReset = "\x1b[0m"
 )
 
-// REPL starts the input output loop
-func REPL(_ io.Reader, out io.Writer) {
-	// reader := bufio.NewReader(in)
-	// env := object.NewEnvironment()
+// Config configures a REPL
+type Config struct {
+	// HistoryFile keeps input between sessions. Empty keeps history in memory
+	HistoryFile string
 
-	// Configure readline
-	rl, err := readline.NewEx(&readline.Config{
-		HistoryFile:     HistoryPath,
-		InterruptPrompt: Interrupt,
+	Prompt          string
+	MultilinePrompt string
+
+	// Color highlights errors with ANSI escapes
+	Color bool
+
+	// Engine runs each input, keeping its definitions for the next one.
+	// It must be monkey.VM or monkey.Evaluator
+	Engine monkey.Engine
+
+	In  io.Reader
+	Out io.Writer
+}
+
+// DefaultConfig returns a Config for an interactive session on the terminal
+func DefaultConfig() Config {
+	return Config{
+		HistoryFile:     DefaultHistoryFile(),
 		Prompt:          Prompt,
-	})
-	check(err)
-	defer rl.Close()
+		MultilinePrompt: MultilinePrompt,
+		Engine:          monkey.VM,
+		In:              os.Stdin,
+		Out:             os.Stdout,
+	}
+}
+
+// DefaultHistoryFile returns monkey/history under $XDG_DATA_HOME if it is set,
+// and ~/.monkey_history otherwise. It is empty if neither can be found
+func DefaultHistoryFile() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "monkey", "history")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+// REPL is an interactive Read-Eval-Print Loop
+type REPL struct {
+	config  Config
+	session *session
+}
+
+// New returns a REPL for config. A nil Engine runs on the VM, and a nil In or
+// Out uses the process's standard input or output
+func New(config Config) (*REPL, error) {
+	if config.Engine == nil {
+		config.Engine = monkey.VM
+	}
+	if name := config.Engine.Name(); name != monkey.VM.Name() && name != monkey.Evaluator.Name() {
+		return nil, fmt.Errorf("the REPL cannot run on engine %q", name)
+	}
+
+	if config.In == nil {
+		config.In = os.Stdin
+	}
+	if config.Out == nil {
+		config.Out = os.Stdout
+	}
 
-	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalsSize)
-	symbolTable := compiler.NewSymbolTable()
+	return &REPL{config: config, session: newSession(config)}, nil
+}
+
+// Run reads and runs input until exit(), CTRL-c or the end of the input
+func (r *REPL) Run() error {
+	out := r.config.Out
+
+	rlConfig := newReadlineConfig(r.config)
+	rlConfig.AutoComplete = &completer{session: r.session}
 
-	// History buffer
-	history := make([]string, 0)
+	rl, err := readline.NewEx(rlConfig)
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
 
 	for {
 		// Read Input
 		line, err := rl.Readline()
-		check(err)
+		if err == readline.ErrInterrupt || err == io.EOF {
+			io.WriteString(out, "Goodbye!\n")
+			return nil
+		} else if err != nil {
+			return err
+		}
 
 		line = strings.TrimSpace(line)
 		if line == Exit {
-			fmt.Println("Goodbye!")
-			return
+			io.WriteString(out, "Goodbye!\n")
+			return nil
+		}
+
+		if isCommand(line) {
+			r.session.command(line, out)
+			continue
 		}
 
 		// Allow multiline input for block statements
 		if isMultilineStart(line) {
-			line, err = acceptUntil(rl, line, "\n\n")
-			check(err)
+			line, err = r.acceptUntil(rl, line, "\n\n")
+			if err != nil {
+				return err
+			}
 		}
 
-		history = append(history, line)
-		processInput(line, constants, globals, symbolTable, out)
+		r.session.eval(line, out)
+	}
+}
+
+// newReadlineConfig returns the readline configuration, falling back to in-memory
+// history with a warning when the history file cannot be opened
+func newReadlineConfig(config Config) *readline.Config {
+	stdin, ok := config.In.(io.ReadCloser)
+	if !ok {
+		stdin = io.NopCloser(config.In)
+	}
+
+	rlConfig := &readline.Config{
+		HistoryFile:     config.HistoryFile,
+		InterruptPrompt: Interrupt,
+		Prompt:          config.Prompt,
+		Stdin:           stdin,
+		Stdout:          config.Out,
+	}
+	if config.HistoryFile == "" {
+		return rlConfig
+	}
+
+	err := os.MkdirAll(filepath.Dir(config.HistoryFile), 0755)
+	if err == nil {
+		var f *os.File
+		f, err = os.OpenFile(config.HistoryFile, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
+		if err == nil {
+			f.Close()
+		}
 	}
+	if err != nil {
+		fmt.Fprintf(config.Out, "warning: history disabled: %s\n", err)
+		rlConfig.HistoryFile = ""
+	}
+
+	return rlConfig
 }
 
-func check(err error) {
-	if err == readline.ErrInterrupt {
-		fmt.Println("Goodbye!")
-		os.Exit(0)
-	} else if err != nil {
-		fmt.Println(err)
-		os.Exit(0)
+// setBase handles the `:base <n>` command, returning the base to display integers in
+func setBase(out io.Writer, arg string, current int) int {
+	if arg == "" {
+		fmt.Fprintf(out, "base %d\n", current)
+		return current
+	}
+
+	base, err := strconv.Atoi(arg)
+	if err != nil || !object.IsSupportedBase(base) {
+		fmt.Fprintf(out, "unsupported base %q, use one of 2, 8, 10 or 16\n", arg)
+		return current
 	}
+
+	return base
 }
 
-// processInput parses and executes Monkey Program
-func processInput(input string, constants []object.Object, globals []object.Object, symbolTable *compiler.SymbolTable, out io.Writer) {
+// eval parses input and runs it on the session's engine, printing integers in
+// the session's base
+func (s *session) eval(input string, out io.Writer) {
 	l := lexer.New(input)
 	p := parser.New(l)
 
 	program := p.ParseProgram()
 	if len(p.Errors()) != 0 {
+		s.startError(out)
 		printParserErrors(out, p.Errors())
+		s.endError(out)
+		return
+	}
+
+	evaluator.DefineMacros(program, s.macros)
+	expanded, err := evaluator.ExpandMacros(program, s.macros)
+	if err != nil {
+		s.failed(out, "Whoops! Macro expansion failed: \n %s\n", err)
 		return
 	}
+	program = expanded.(*ast.Program)
 
-	comp := compiler.NewWithState(symbolTable, constants)
-	err := comp.Compile(program)
+	if s.evaluate {
+		s.evaluateProgram(program, input, out)
+		return
+	}
+
+	comp := compiler.NewWithState(s.symbolTable, s.constants)
+	err = comp.Compile(program)
 	if err != nil {
-		fmt.Fprintf(out, "Whoops! Compilation failed: \n %s\n", err)
+		s.failed(out, "Whoops! Compilation failed: \n %s\n", err)
 		return
 	}
 
 	code := comp.Bytecode()
-	constants = code.Constants
+	s.constants = code.Constants
+	s.lastBytecode = code
+	s.history = append(s.history, input)
 
-	machine := vm.NewWithGlobalsStore(code, globals)
-	err = machine.Run()
+	machine := vm.NewWithGlobalsStore(code, s.globals)
+	err = machine.SafeRun()
 	if err != nil {
-		fmt.Fprintf(out, "Whoops! Executing bytecode failed: \n %s\n", err)
+		s.failed(out, "Whoops! Executing bytecode failed: \n %s\n", err)
 		return
 	}
 
+	// Input without expressions, like a macro definition, leaves no value
 	stackTop := machine.LastPoppedStackElem()
-	io.WriteString(out, stackTop.Inspect())
+	if stackTop == nil {
+		return
+	}
+
+	io.WriteString(out, object.InspectInBase(stackTop, s.base))
 	io.WriteString(out, "\n")
+}
+
+// evaluateProgram runs program with the evaluator in the session's environment
+func (s *session) evaluateProgram(program *ast.Program, input string, out io.Writer) {
+	s.history = append(s.history, input)
+
+	evaluated := evaluator.Eval(program, s.env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		s.failed(out, "Whoops! Evaluation failed: \n %s\n", errObj.Message)
+		return
+	}
+
+	if evaluated != nil {
+		io.WriteString(out, object.InspectInBase(evaluated, s.base))
+		io.WriteString(out, "\n")
+	}
+}
+
+// failed prints an error message, in red when color is enabled
+func (s *session) failed(out io.Writer, format string, a ...interface{}) {
+	s.startError(out)
+	fmt.Fprintf(out, format, a...)
+	s.endError(out)
+}
+
+func (s *session) startError(out io.Writer) {
+	if s.color {
+		io.WriteString(out, colorRed)
+	}
+}
+
+func (s *session) endError(out io.Writer) {
+	if s.color {
+		io.WriteString(out, colorReset)
+	}
+}
+
+// printBytecode handles the `:bytecode` command, disassembling the last compiled input
+func printBytecode(out io.Writer, bytecode *compiler.Bytecode) {
+	if bytecode == nil {
+		io.WriteString(out, "no input compiled yet\n")
+		return
+	}
 
-	// evaluated := evaluator.Eval(program, env)
-	// if evaluated != nil {
-	// 	io.WriteString(out, evaluated.Inspect())
-	// 	io.WriteString(out, "\n")
-	// }
+	io.WriteString(out, bytecode.String())
 }
 
 // isMultilineStart checks if the line ends with an unclosed bracket
@@ -148,12 +334,12 @@ func isMultilineStart(line string) bool {
 }
 
 // acceptUntil accepts multiline input until end encountered
-func acceptUntil(rl *readline.Instance, start, end string) (string, error) {
+func (r *REPL) acceptUntil(rl *readline.Instance, start, end string) (string, error) {
 	var buf strings.Builder
 
 	buf.WriteString(start)
 	buf.WriteRune('\n')
-	rl.SetPrompt(MultilinePrompt)
+	rl.SetPrompt(r.config.MultilinePrompt)
 
 	for {
 		line, err := rl.Readline()
@@ -170,7 +356,7 @@ func acceptUntil(rl *readline.Instance, start, end string) (string, error) {
 		}
 	}
 
-	rl.SetPrompt(Prompt)
+	rl.SetPrompt(r.config.Prompt)
 
 	return buf.String(), nil
 }
@@ -0,0 +1,222 @@
+package repl
+
+import (
+	"bytes"
+	"go-compiler/src/monkey/compiler"
+	"go-compiler/src/monkey/lexer"
+	"go-compiler/src/monkey/monkey"
+	"go-compiler/src/monkey/parser"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestSession returns a session on engine with the default configuration
+func newTestSession(engine monkey.Engine) *session {
+	return newSession(Config{Engine: engine})
+}
+
+func TestNewReadlineConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	var out bytes.Buffer
+	path := filepath.Join(dir, "monkey", "history.txt")
+	config := newReadlineConfig(Config{HistoryFile: path, Prompt: Prompt, Out: &out, In: strings.NewReader("")})
+	if config.HistoryFile != path {
+		t.Errorf("wrong HistoryFile. want=%q, got=%q", path, config.HistoryFile)
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected warning: %q", out.String())
+	}
+
+	// A directory can't be opened as the history file
+	out.Reset()
+	config = newReadlineConfig(Config{HistoryFile: dir, Prompt: Prompt, Out: &out, In: strings.NewReader("")})
+	if config.HistoryFile != "" {
+		t.Errorf("expected in-memory history, got HistoryFile=%q", config.HistoryFile)
+	}
+	if config.Prompt != Prompt || config.InterruptPrompt != Interrupt {
+		t.Errorf("prompts not configured: %+v", config)
+	}
+	if !strings.HasPrefix(out.String(), "warning: history disabled") {
+		t.Errorf("missing warning. got=%q", out.String())
+	}
+}
+
+func TestDefaultHistoryFile(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/data")
+	if got := DefaultHistoryFile(); got != filepath.Join("/data", "monkey", "history") {
+		t.Errorf("wrong history file with XDG_DATA_HOME. got=%q", got)
+	}
+
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("HOME", "/home/monkey")
+	if got := DefaultHistoryFile(); got != filepath.Join("/home/monkey", ".monkey_history") {
+		t.Errorf("wrong history file in home. got=%q", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	r, err := New(Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if r.config.Engine.Name() != monkey.VM.Name() || r.config.In == nil || r.config.Out == nil {
+		t.Errorf("defaults not applied: %+v", r.config)
+	}
+
+	_, err = New(Config{Engine: unknownEngine{}})
+	if err == nil || err.Error() != `the REPL cannot run on engine "unknown"` {
+		t.Errorf("wrong error for an unknown engine. got=%v", err)
+	}
+}
+
+type unknownEngine struct{}
+
+func (unknownEngine) Name() string             { return "unknown" }
+func (unknownEngine) Run(string) monkey.Result { return monkey.Result{} }
+
+func TestEvaluatorSession(t *testing.T) {
+	s := newTestSession(monkey.Evaluator)
+
+	var out bytes.Buffer
+	s.eval("let double = fn(x) { x * 2 };", &out)
+	s.eval("double(21)", &out)
+	s.command(":env", &out)
+	s.eval("double(true)", &out)
+
+	expected := "42\ndouble = fn(x) {\n(x * 2)\n}\nWhoops! Evaluation failed: \n type mismatch: BOOLEAN * INTEGER\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestColoredErrors(t *testing.T) {
+	s := newSession(Config{Engine: monkey.VM, Color: true})
+
+	var out bytes.Buffer
+	s.eval("1 +", &out)
+	if !strings.HasPrefix(out.String(), colorRed) || !strings.HasSuffix(out.String(), colorReset) {
+		t.Errorf("parser errors not colored. got=%q", out.String())
+	}
+
+	out.Reset()
+	s.eval("1", &out)
+	if out.String() != "1\n" {
+		t.Errorf("results should not be colored. got=%q", out.String())
+	}
+}
+
+func TestEvalInBase(t *testing.T) {
+	tests := []struct {
+		input    string
+		base     int
+		expected string
+	}{
+		{"255", 10, "255\n"},
+		{"255", 16, "0xff\n"},
+		{"let a = 10; a * 2 + 235", 16, "0xff\n"},
+		{"[1, 10, 16]", 16, "[0x1, 0xa, 0x10]\n"},
+		{"5", 2, "0b101\n"},
+	}
+
+	for _, tt := range tests {
+		s := newTestSession(monkey.VM)
+		s.base = tt.base
+
+		var out bytes.Buffer
+		s.eval(tt.input, &out)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q in base %d. want=%q, got=%q",
+				tt.input, tt.base, tt.expected, out.String())
+		}
+	}
+}
+
+func TestSetBase(t *testing.T) {
+	tests := []struct {
+		arg      string
+		expected int
+	}{
+		{"16", 16},
+		{"2", 2},
+		{"10", 10},
+		{"7", 8},
+		{"hex", 8},
+		{"", 8},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		base := setBase(&out, tt.arg, 8)
+
+		if base != tt.expected {
+			t.Errorf("wrong base for %q. want=%d, got=%d", tt.arg, tt.expected, base)
+		}
+	}
+}
+
+func TestPrintBytecode(t *testing.T) {
+	var out bytes.Buffer
+	printBytecode(&out, nil)
+	if out.String() != "no input compiled yet\n" {
+		t.Errorf("wrong output without input. got=%q", out.String())
+	}
+
+	s := newTestSession(monkey.VM)
+
+	out.Reset()
+	s.eval(`"a" + "b"`, &out)
+	bytecode := s.lastBytecode
+	if bytecode == nil {
+		t.Fatalf("no bytecode kept. output=%q", out.String())
+	}
+
+	out.Reset()
+	printBytecode(&out, bytecode)
+	if !strings.Contains(out.String(), "0006 OpAdd\n") ||
+		!strings.Contains(out.String(), "0001 STRING \"b\"\n") {
+		t.Errorf("bytecode not disassembled. got=%q", out.String())
+	}
+
+	out.Reset()
+	s.eval("undefined", &out)
+	if s.lastBytecode != bytecode {
+		t.Errorf("bytecode kept for input that failed to compile")
+	}
+}
+
+func TestDebug(t *testing.T) {
+	program := parser.New(lexer.New("let double = fn(x) {\n  x * 2\n};\nlet a = double(4);\na + 1")).ParseProgram()
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	in := strings.NewReader("b 2\nc\nbt\nlocals\nstack\nglobals\ns\nbogus\nc\n")
+	var out bytes.Buffer
+	Debug(comp.Bytecode(), in, &out)
+
+	expected := []string{
+		"main: 0000 OpClosure 1 0 (line 1, col 14)",
+		"1 breakpoint(s) on line 2",
+		"fn 1: 0000 OpGetLocal 0 (line 2, col 3)",
+		"#0 fn 1: 0000 OpGetLocal 0 (line 2, col 3)\n#1 main: 0015 OpSetGlobal 1 (line 4, col 1)",
+		"   0 4\n",
+		"   1 4\n   0 Closure[",
+		"double = Closure[",
+		"fn 1: 0002 OpConstant 0 (line 2, col 7)",
+		`unknown command "bogus"`,
+		"program finished: 9",
+	}
+
+	output := out.String()
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("output is missing %q. got=\n%s", want, output)
+		}
+	}
+}
@@ -1,11 +1,20 @@
 package token
 
+import "sort"
+
 type TokenType string
 
 // A Token is made up of a TokenType and a Literal which is the actual value of that token
 type Token struct {
 	Type    TokenType
 	Literal string
+
+	// AfterNewline is true when a line break separates the token from the one before it
+	AfterNewline bool
+
+	// Line and Column locate the token's first character in the input, starting at 1
+	Line   int
+	Column int
 }
 
 // Constant variables to define Keywords and Operaters of Monkey Language
@@ -16,6 +25,7 @@ const (
 	// Identifiers + literals
 	IDENT = "IDENT" // Identifier string for - add, foo, bar, x, y, ...
 	INT   = "INT"   // 12345
+	FLOAT = "FLOAT" // 1.5
 
 	// Operaters
 	ASSIGN   = "="
@@ -28,6 +38,10 @@ const (
 	SLASH    = "/"
 	LT       = "<"
 	GT       = ">"
+	LT_EQ    = "<="
+	GT_EQ    = ">="
+	AND      = "&&"
+	OR       = "||"
 
 	// Delimiters
 	COMMA     = ","
@@ -49,20 +63,58 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	IMPORT   = "IMPORT"
+	MACRO    = "MACRO"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	THROW    = "THROW"
+	SWITCH   = "SWITCH"
+	CASE     = "CASE"
+	DEFAULT  = "DEFAULT"
+	SPAWN    = "SPAWN"
 
 	STRING  = "STRING"
 	COMMENT = "COMMENT"
+
+	// Interpolated strings. Eg: `hello ${name}`
+	TEMPLATE_START = "TEMPLATE_START" // opening '`'
+	TEMPLATE_TEXT  = "TEMPLATE_TEXT"  // literal text between interpolations
+	TEMPLATE_END   = "TEMPLATE_END"   // closing '`'
+	INTERP_START   = "${"
+	INTERP_END     = "INTERP_END" // '}' closing an interpolation
 )
 
 // Map to store language specific keywords
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"while":   WHILE,
+	"import":  IMPORT,
+	"macro":   MACRO,
+	"try":     TRY,
+	"catch":   CATCH,
+	"throw":   THROW,
+	"switch":  SWITCH,
+	"case":    CASE,
+	"default": DEFAULT,
+	"spawn":   SPAWN,
+}
+
+// Keywords returns the language's keywords, sorted
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	return words
 }
 
 // Returns TokenType given ident string - keyword if present in map else IDENT to indicate user-defined identifier
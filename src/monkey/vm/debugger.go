@@ -0,0 +1,217 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"go-compiler/src/monkey/code"
+	"go-compiler/src/monkey/object"
+)
+
+// errPaused stops execute before an instruction the debugger pauses at
+var errPaused = errors.New("paused")
+
+// Debugger runs a VM an instruction at a time, pausing at breakpoints so the
+// stack, globals and call frames can be inspected in between
+type Debugger struct {
+	vm *VM
+
+	// functions maps every function of the bytecode, including the main
+	// program and module bodies, to its constant index or -1
+	functions   map[*object.CompiledFunction]int
+	breakpoints map[location]bool
+
+	stepping bool
+	paused   bool // the VM stopped before an instruction that has not run yet
+	resuming bool // run the paused instruction before checking for a pause again
+	err      error
+}
+
+// location is an instruction offset within a function
+type location struct {
+	fn     *object.CompiledFunction
+	offset int
+}
+
+// FrameInfo describes a frame of the call stack
+type FrameInfo struct {
+	Function     int // constant index of the function, or -1 for the main program
+	Instructions code.Instructions
+
+	// Offset is the instruction the frame runs next and Position its source.
+	// Callers resume after the call in progress
+	Offset   int
+	Position code.Position
+
+	Locals []object.Object
+}
+
+// NewDebugger attaches a Debugger to vm, which must not have started running
+func NewDebugger(vm *VM) *Debugger {
+	return &Debugger{
+		vm:          vm,
+		functions:   vm.functionIndexes(),
+		breakpoints: map[location]bool{},
+	}
+}
+
+// SetBreakpoint pauses execution before the instruction at offset of the
+// function at constant index function, or of the main program for -1
+func (d *Debugger) SetBreakpoint(function, offset int) error {
+	fn := d.function(function)
+	if fn == nil {
+		return fmt.Errorf("no function at constant %d", function)
+	}
+
+	for i := 0; i < len(fn.Instructions); {
+		if i == offset {
+			d.breakpoints[location{fn, offset}] = true
+			return nil
+		}
+		_, read := code.ReadOperandsOf(code.Opcode(fn.Instructions[i]), fn.Instructions[i+1:])
+		i += 1 + read
+	}
+
+	return fmt.Errorf("no instruction at offset %d", offset)
+}
+
+// SetLineBreakpoint pauses execution wherever the code of a source line
+// starts, returning the number of breakpoints set
+func (d *Debugger) SetLineBreakpoint(line int) (int, error) {
+	set := 0
+	for fn := range d.functions {
+		for i, entry := range fn.Lines {
+			// Only the first of consecutive entries on the line starts it
+			if entry.Position.Line == line && (i == 0 || fn.Lines[i-1].Position.Line != line) {
+				d.breakpoints[location{fn, entry.Offset}] = true
+				set++
+			}
+		}
+	}
+
+	if set == 0 {
+		return 0, fmt.Errorf("no code on line %d", line)
+	}
+	return set, nil
+}
+
+// ClearBreakpoints removes every breakpoint
+func (d *Debugger) ClearBreakpoints() {
+	d.breakpoints = map[location]bool{}
+}
+
+// Step executes a single instruction
+func (d *Debugger) Step() error {
+	return d.resume(true)
+}
+
+// Continue executes until a breakpoint is reached or the program ends
+func (d *Debugger) Continue() error {
+	return d.resume(false)
+}
+
+// Done reports whether the program ended or failed
+func (d *Debugger) Done() bool {
+	frame := d.vm.currentFrame()
+	return d.err != nil || (d.vm.framesIndex == 1 && frame.ip >= len(frame.Instructions())-1)
+}
+
+// Err returns the runtime error that ended the program, if any
+func (d *Debugger) Err() error {
+	return d.err
+}
+
+// Stack returns the operand stack, bottom first
+func (d *Debugger) Stack() []object.Object {
+	stack := make([]object.Object, d.vm.sp)
+	copy(stack, d.vm.stack[:d.vm.sp])
+	return stack
+}
+
+// Globals returns the value of every global of the main program that has been set
+func (d *Debugger) Globals() map[string]object.Object {
+	globals := map[string]object.Object{}
+	if d.vm.symbolTable == nil {
+		return globals
+	}
+
+	for _, symbol := range d.vm.symbolTable.Globals() {
+		if value := d.vm.getGlobal(symbol.Index); value != nil {
+			globals[symbol.Name] = value
+		}
+	}
+	return globals
+}
+
+// Frames returns the call stack, starting with the main program
+func (d *Debugger) Frames() []FrameInfo {
+	frames := make([]FrameInfo, d.vm.framesIndex)
+
+	for i := range frames {
+		frame := d.vm.frames[i]
+		fn := frame.cl.Fn
+
+		info := FrameInfo{
+			Function:     d.functions[fn],
+			Instructions: fn.Instructions,
+			Offset:       frame.ip + 1,
+		}
+		info.Position, _ = fn.Lines.Lookup(info.Offset)
+
+		if i > 0 {
+			info.Locals = make([]object.Object, fn.NumLocals)
+			copy(info.Locals, d.vm.stack[frame.basePointer:frame.basePointer+fn.NumLocals])
+		}
+
+		frames[i] = info
+	}
+
+	return frames
+}
+
+// function returns the function at constant index function, or the main
+// program for -1
+func (d *Debugger) function(function int) *object.CompiledFunction {
+	for fn, i := range d.functions {
+		if i == function {
+			return fn
+		}
+	}
+	return nil
+}
+
+// resume runs the VM until it pauses, stepping over the instruction it is
+// paused at first
+func (d *Debugger) resume(stepping bool) error {
+	if d.Done() {
+		return d.err
+	}
+
+	// A breakpoint at the very first instruction still pauses Continue
+	d.stepping = stepping
+	d.resuming = stepping || d.paused
+	d.paused = false
+
+	d.vm.debugger = d
+	err := d.vm.execute(0)
+	d.vm.debugger = nil
+
+	if err != nil && err != errPaused {
+		d.err = d.vm.locate(err)
+	}
+	return d.err
+}
+
+// pause is called by execute before every instruction, reporting whether
+// to stop before the next instruction of frame
+func (d *Debugger) pause(frame *Frame) bool {
+	if d.resuming {
+		d.resuming = false
+		return false
+	}
+
+	if d.stepping || d.breakpoints[location{frame.cl.Fn, frame.ip + 1}] {
+		d.paused = true
+		return true
+	}
+	return false
+}
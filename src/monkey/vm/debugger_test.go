@@ -0,0 +1,162 @@
+package vm
+
+import (
+	"go-compiler/src/monkey/compiler"
+	"go-compiler/src/monkey/object"
+	"strings"
+	"testing"
+)
+
+func newDebugger(t *testing.T, input string) (*VM, *Debugger) {
+	t.Helper()
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	return vm, NewDebugger(vm)
+}
+
+func TestDebuggerStep(t *testing.T) {
+	vm, debugger := newDebugger(t, "let a = 1; let b = a + 2; b")
+
+	// Every instruction of the main program runs once, in order
+	expected := []int{3, 6, 9, 12, 13, 16, 19, 20}
+	for i, offset := range expected {
+		err := debugger.Step()
+		if err != nil {
+			t.Fatalf("step %d: unexpected error: %s", i, err)
+		}
+
+		frames := debugger.Frames()
+		if len(frames) != 1 || frames[0].Function != -1 || frames[0].Offset != offset {
+			t.Fatalf("step %d: wrong frames. want main at %d, got=%+v", i, offset, frames)
+		}
+	}
+
+	if !debugger.Done() {
+		t.Fatalf("program not done after stepping through it")
+	}
+	testIntegerObject(3, vm.LastPoppedStackElem())
+
+	globals := debugger.Globals()
+	if len(globals) != 2 {
+		t.Fatalf("wrong number of globals. want=2, got=%d", len(globals))
+	}
+	testIntegerObject(1, globals["a"])
+	testIntegerObject(3, globals["b"])
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	vm, debugger := newDebugger(t, `let add = fn(a, b) {
+	let c = a + b;
+	c
+};
+add(1, 2);
+add(3, 4) * 2;`)
+
+	set, err := debugger.SetLineBreakpoint(3)
+	if err != nil || set != 1 {
+		t.Fatalf("wrong line breakpoints. want 1, got=%d (%v)", set, err)
+	}
+
+	for _, want := range [][]int64{{1, 2, 3}, {3, 4, 7}} {
+		err := debugger.Continue()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		frames := debugger.Frames()
+		if len(frames) != 2 {
+			t.Fatalf("wrong number of frames. want=2, got=%d", len(frames))
+		}
+
+		frame := frames[1]
+		if frame.Function != 0 || frame.Position.Line != 3 {
+			t.Fatalf("paused in the wrong place. got=%+v", frame)
+		}
+		for i, local := range frame.Locals {
+			if err := testIntegerObject(want[i], local); err != nil {
+				t.Errorf("local %d: %s", i, err)
+			}
+		}
+
+		// The callee sits below its locals on the stack
+		stack := debugger.Stack()
+		if _, ok := stack[len(stack)-4].(*object.Closure); !ok {
+			t.Errorf("callee is not on the stack. got=%v", stack)
+		}
+	}
+
+	err = debugger.Continue()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !debugger.Done() {
+		t.Fatalf("program not done after the last breakpoint")
+	}
+	testIntegerObject(14, vm.LastPoppedStackElem())
+}
+
+func TestDebuggerOffsetBreakpoints(t *testing.T) {
+	_, debugger := newDebugger(t, "let a = 1; a + 2")
+
+	for _, tt := range []struct {
+		function int
+		offset   int
+		expected string
+	}{
+		{-1, 1, "no instruction at offset 1"},
+		{-1, 99, "no instruction at offset 99"},
+		{5, 0, "no function at constant 5"},
+	} {
+		err := debugger.SetBreakpoint(tt.function, tt.offset)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+
+	for _, offset := range []int{0, 6} {
+		err := debugger.SetBreakpoint(-1, offset)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	debugger.Continue()
+	if frames := debugger.Frames(); frames[0].Offset != 0 {
+		t.Fatalf("paused at the wrong offset. want=0, got=%d", frames[0].Offset)
+	}
+
+	debugger.Continue()
+	if frames := debugger.Frames(); frames[0].Offset != 6 {
+		t.Fatalf("paused at the wrong offset. want=6, got=%d", frames[0].Offset)
+	}
+
+	// Resuming runs the instruction paused at instead of pausing again
+	debugger.Continue()
+	if !debugger.Done() {
+		t.Fatalf("program not done")
+	}
+
+	debugger.ClearBreakpoints()
+}
+
+func TestDebuggerRuntimeError(t *testing.T) {
+	_, debugger := newDebugger(t, "let f = fn() { 1 + true }; f()")
+
+	err := debugger.Continue()
+	if err == nil || !strings.Contains(err.Error(), "runtime error at line 1, col 18") {
+		t.Fatalf("expected located runtime error, got=%v", err)
+	}
+
+	if !debugger.Done() || debugger.Err() != err {
+		t.Errorf("debugger does not report the failure")
+	}
+	if debugger.Step() != err {
+		t.Errorf("stepping a failed program does not return its error")
+	}
+}
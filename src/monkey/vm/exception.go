@@ -0,0 +1,67 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"go-compiler/src/monkey/object"
+)
+
+// ThrownError is raised by a throw statement that no try expression catches
+type ThrownError struct {
+	Value object.Object
+}
+
+func (e *ThrownError) Error() string {
+	return fmt.Sprintf("uncaught exception: %s", e.Value.Inspect())
+}
+
+// handler is a catch block installed by OpTry, with the stack pointer to
+// unwind the operand stack to before jumping to it
+type handler struct {
+	ip int
+	sp int
+}
+
+// catch unwinds the frames and the operand stack to the innermost handler of
+// the frames above depth and pushes the exception for it, reporting whether
+// there was a handler. Exceeded limits and debugger pauses are never caught
+func (vm *VM) catch(err error, depth int) bool {
+	var limit *LimitError
+	if err == errPaused || errors.As(err, &limit) {
+		return false
+	}
+
+	for i := vm.framesIndex - 1; i >= depth; i-- {
+		frame := vm.frames[i]
+		n := len(frame.handlers)
+		if n == 0 {
+			continue
+		}
+
+		h := frame.handlers[n-1]
+		frame.handlers = frame.handlers[:n-1]
+
+		vm.framesIndex = i + 1
+		vm.sp = h.sp
+		frame.ip = h.ip - 1
+
+		return vm.push(exception(err)) == nil
+	}
+
+	return false
+}
+
+// exception is the value a catch block receives for err: the thrown value, or
+// the message of a runtime error as a string
+func exception(err error) object.Object {
+	var thrown *ThrownError
+	if errors.As(err, &thrown) {
+		return thrown.Value
+	}
+
+	var located *RuntimeError
+	if errors.As(err, &located) {
+		err = located.Err
+	}
+	return &object.String{Value: err.Error()}
+}
@@ -0,0 +1,27 @@
+package vm
+
+import (
+	"go-compiler/src/monkey/code"
+	"go-compiler/src/monkey/object"
+)
+
+// Frame holds the execution state of a single function call
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int       // stack pointer before the call; locals live from here upwards
+	handlers    []handler // try blocks being run by the frame, innermost last
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{
+		cl:          cl,
+		ip:          -1,
+		basePointer: basePointer,
+	}
+}
+
+// Instructions returns the instructions of the function being executed
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
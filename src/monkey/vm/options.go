@@ -0,0 +1,131 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"go-compiler/src/monkey/compiler"
+	"sync/atomic"
+)
+
+// contextCheckInterval is how many instructions run between checks of the
+// Options context, keeping the check off the hot path of every instruction
+const contextCheckInterval = 1024
+
+// Options limits the resources a VM may use while running untrusted code.
+// A zero field leaves that resource at its default limit, if it has one
+type Options struct {
+	// MaxInstructions is the number of instructions the VM may execute over
+	// its lifetime, including those run by Call and CallFunction and by the
+	// tasks it spawns
+	MaxInstructions int
+
+	// MaxStack caps the number of values on the stack, StackSize by default
+	MaxStack int
+
+	// MaxFrames caps the depth of nested calls, MaxFrames by default
+	MaxFrames int
+
+	// Context stops execution once it is cancelled or its deadline passes
+	Context context.Context
+}
+
+// Limit identifies the resource whose limit stopped execution
+type Limit int
+
+const (
+	InstructionLimit Limit = iota + 1
+	StackLimit
+	FrameLimit
+	Cancelled
+)
+
+// LimitError is returned by Run when execution is stopped by a limit, so
+// embedders can tell it apart from errors raised by the program itself
+type LimitError struct {
+	Limit Limit
+	Max   int   // the limit that was exceeded, unset for Cancelled
+	Err   error // the context's error for Cancelled
+
+	// Where a StackLimit or FrameLimit was exceeded: the constant index of the
+	// running function, or -1 for the main program, the global naming it if
+	// any, the offset of the instruction and the depth of both stacks
+	Function int
+	Name     string
+	Offset   int
+	Stack    int
+	Frames   int
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case InstructionLimit:
+		return fmt.Sprintf("instruction limit exceeded: more than %d instructions", e.Max)
+	case StackLimit:
+		return fmt.Sprintf("stack overflow: more than %d values (%s)", e.Max, e.where())
+	case FrameLimit:
+		return fmt.Sprintf("call depth exceeded: more than %d frames (%s)", e.Max, e.where())
+	default:
+		return fmt.Sprintf("execution cancelled: %s", e.Err)
+	}
+}
+
+// where describes the location and stack depths of a stack or frame overflow
+func (e *LimitError) where() string {
+	function := "main"
+	switch {
+	case e.Function >= 0 && e.Name != "":
+		function = fmt.Sprintf("%s (fn %d)", e.Name, e.Function)
+	case e.Function >= 0:
+		function = fmt.Sprintf("fn %d", e.Function)
+	}
+
+	return fmt.Sprintf("at %04d in %s, %d values on the stack in %d frames", e.Offset, function, e.Stack, e.Frames)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// NewWithOptions creates a VM for the bytecode that stops with a LimitError
+// when it exceeds one of the options' limits
+func NewWithOptions(bytecode *compiler.Bytecode, options Options) *VM {
+	vm := New(bytecode)
+
+	if options.MaxStack > 0 {
+		vm.maxStack = options.MaxStack
+		if len(vm.stack) > vm.maxStack {
+			vm.stack = vm.stack[:vm.maxStack]
+		}
+	}
+	if options.MaxFrames > 0 {
+		vm.maxFrames = options.MaxFrames
+		if len(vm.frames) > vm.maxFrames {
+			vm.frames = vm.frames[:vm.maxFrames]
+		}
+	}
+	vm.maxInstructions = options.MaxInstructions
+	vm.ctx = options.Context
+	if vm.maxInstructions > 0 {
+		vm.spent = new(int64)
+	}
+
+	return vm
+}
+
+// checkLimits is called before every instruction, failing once the
+// instruction budget is spent or the context is done
+func (vm *VM) checkLimits() error {
+	vm.executed++
+
+	if vm.maxInstructions > 0 && atomic.AddInt64(vm.spent, 1) > int64(vm.maxInstructions) {
+		return &LimitError{Limit: InstructionLimit, Max: vm.maxInstructions}
+	}
+
+	if vm.ctx != nil && vm.executed%contextCheckInterval == 1 {
+		if err := vm.ctx.Err(); err != nil {
+			return &LimitError{Limit: Cancelled, Err: err}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package vm
+
+import (
+	"fmt"
+	"go-compiler/src/monkey/code"
+	"go-compiler/src/monkey/object"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Profile reports where a profiled VM spent its time. Each instruction is
+// charged the time until the next one starts, so an OpCall includes the
+// builtin it calls but not the frames it pushes
+type Profile struct {
+	Opcodes   []OpcodeProfile   // opcodes that ran, most time first
+	Functions []FunctionProfile // functions that ran, most self time first
+}
+
+// OpcodeProfile is how often an opcode ran and the total time it took
+type OpcodeProfile struct {
+	Opcode code.Opcode
+	Count  int
+	Time   time.Duration
+}
+
+// FunctionProfile covers a function's calls and the instructions run in its
+// own frames, excluding the functions it calls
+type FunctionProfile struct {
+	// Function is the function's constant index, or -1 for the main program.
+	// Name is the first global holding a closure of it, if any
+	Function int
+	Name     string
+
+	Calls        int
+	Instructions int
+	SelfTime     time.Duration
+}
+
+// profiler accumulates a Profile while the VM runs
+type profiler struct {
+	counts [256]int
+	times  [256]time.Duration
+
+	functions map[*object.CompiledFunction]*FunctionProfile
+
+	// the instruction being timed, charged once the next one starts
+	running bool
+	lastOp  code.Opcode
+	lastFn  *FunctionProfile
+	started time.Time
+}
+
+// EnableProfiling records opcode counts and times, and the calls and self time
+// of every function, during Run. The results are read with Profile
+func (vm *VM) EnableProfiling() {
+	p := &profiler{functions: map[*object.CompiledFunction]*FunctionProfile{}}
+
+	for fn, i := range vm.functionIndexes() {
+		p.functions[fn] = &FunctionProfile{Function: i}
+	}
+	p.functions[vm.frames[0].cl.Fn].Calls = 1
+
+	vm.profile = p
+}
+
+// Profile returns what has been recorded since EnableProfiling, or nil if
+// profiling is disabled
+func (vm *VM) Profile() *Profile {
+	p := vm.profile
+	if p == nil {
+		return nil
+	}
+
+	profile := &Profile{}
+
+	for op, count := range p.counts {
+		if count > 0 {
+			profile.Opcodes = append(profile.Opcodes,
+				OpcodeProfile{Opcode: code.Opcode(op), Count: count, Time: p.times[op]})
+		}
+	}
+	sort.SliceStable(profile.Opcodes, func(i, j int) bool {
+		return profile.Opcodes[i].Time > profile.Opcodes[j].Time
+	})
+
+	names := vm.functionNames()
+	for fn, f := range p.functions {
+		if f.Calls == 0 && f.Instructions == 0 {
+			continue
+		}
+		function := *f
+		function.Name = names[fn]
+		profile.Functions = append(profile.Functions, function)
+	}
+	sort.Slice(profile.Functions, func(i, j int) bool {
+		a, b := profile.Functions[i], profile.Functions[j]
+		if a.SelfTime != b.SelfTime {
+			return a.SelfTime > b.SelfTime
+		}
+		return a.Function < b.Function
+	})
+
+	return profile
+}
+
+// functionNames names functions after the globals holding their closures
+func (vm *VM) functionNames() map[*object.CompiledFunction]string {
+	names := map[*object.CompiledFunction]string{vm.frames[0].cl.Fn: "main"}
+	if vm.symbolTable == nil {
+		return names
+	}
+
+	for _, sym := range vm.symbolTable.Globals() {
+		cl, ok := vm.getGlobal(sym.Index).(*object.Closure)
+		if !ok {
+			continue
+		}
+		if _, named := names[cl.Fn]; !named {
+			names[cl.Fn] = sym.Name
+		}
+	}
+	return names
+}
+
+// record charges the previous instruction and starts timing op, run in fn
+func (p *profiler) record(op code.Opcode, fn *object.CompiledFunction) {
+	now := time.Now()
+	p.stop(now)
+
+	f := p.functions[fn]
+	p.counts[op]++
+	f.Instructions++
+
+	p.running, p.lastOp, p.lastFn, p.started = true, op, f, now
+}
+
+// call counts a call of fn
+func (p *profiler) call(fn *object.CompiledFunction) {
+	p.functions[fn].Calls++
+}
+
+// stop charges the instruction being timed, if any
+func (p *profiler) stop(now time.Time) {
+	if !p.running {
+		return
+	}
+
+	elapsed := now.Sub(p.started)
+	p.times[p.lastOp] += elapsed
+	p.lastFn.SelfTime += elapsed
+	p.running = false
+}
+
+// String formats the profile as two tables, opcodes and then functions
+func (p *Profile) String() string {
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "%-24s %12s %14s\n", "opcode", "count", "time")
+	for _, op := range p.Opcodes {
+		name := fmt.Sprintf("opcode %d", op.Opcode)
+		if def, err := code.Lookup(byte(op.Opcode)); err == nil {
+			name = def.Name
+		}
+		fmt.Fprintf(&out, "%-24s %12d %14s\n", name, op.Count, op.Time)
+	}
+
+	fmt.Fprintf(&out, "\n%-24s %12s %12s %14s\n", "function", "calls", "instructions", "self time")
+	for _, fn := range p.Functions {
+		name := fn.Name
+		switch {
+		case name == "":
+			name = fmt.Sprintf("fn %d", fn.Function)
+		case fn.Function >= 0:
+			name = fmt.Sprintf("%s (fn %d)", name, fn.Function)
+		}
+		fmt.Fprintf(&out, "%-24s %12d %12d %14s\n", name, fn.Calls, fn.Instructions, fn.SelfTime)
+	}
+
+	return out.String()
+}
@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"go-compiler/src/monkey/code"
+	"go-compiler/src/monkey/compiler"
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	input := `
+	let add = fn(a, b) { a + b };
+	let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } };
+	add(1, 2);
+	add(3, 4);
+	count(3);
+	`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if vm.Profile() != nil {
+		t.Fatalf("profile recorded without being enabled")
+	}
+
+	vm.EnableProfiling()
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	profile := vm.Profile()
+
+	opcodes := map[code.Opcode]int{}
+	for _, op := range profile.Opcodes {
+		opcodes[op.Opcode] = op.Count
+	}
+	expectedOpcodes := map[code.Opcode]int{
+		code.OpAdd:      2,
+		code.OpCall:     3,
+		code.OpTailCall: 3,
+		code.OpEqual:    4,
+		code.OpSub:      3,
+	}
+	for op, want := range expectedOpcodes {
+		if opcodes[op] != want {
+			t.Errorf("wrong count for opcode %d. want=%d, got=%d", op, want, opcodes[op])
+		}
+	}
+
+	type calls struct {
+		calls        int
+		instructions int
+	}
+	functions := map[string]calls{}
+	for _, fn := range profile.Functions {
+		functions[fn.Name] = calls{fn.Calls, fn.Instructions}
+	}
+
+	// add runs OpGetLocal, OpGetLocal, OpAdd, OpReturnValue per call. Each
+	// count runs four instructions to test n, then five to tail call itself
+	// or three to return 0
+	expected := map[string]calls{
+		"add":   {calls: 2, instructions: 8},
+		"count": {calls: 4, instructions: 3*(4+5) + 4 + 3},
+	}
+	for name, want := range expected {
+		if functions[name] != want {
+			t.Errorf("wrong profile for %s. want=%+v, got=%+v", name, want, functions[name])
+		}
+	}
+	if functions["main"].calls != 1 {
+		t.Errorf("wrong calls for main. want=1, got=%d", functions["main"].calls)
+	}
+
+	report := profile.String()
+	for _, want := range []string{"OpAdd", "add (fn ", "count (fn ", "main"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report does not mention %q:\n%s", want, report)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"go-compiler/src/monkey/object"
+	"sync"
+)
+
+// spawn starts fn on a goroutine of its own, running on a task VM, and
+// returns a channel that receives its result, or an error if it fails
+func (vm *VM) spawn(fn object.Object) (*object.Channel, error) {
+	cl, ok := fn.(*object.Closure)
+	if !ok {
+		return nil, fmt.Errorf("cannot spawn %s", fn.Type())
+	}
+	if cl.Fn.NumParameters != 0 {
+		return nil, fmt.Errorf("spawned function must take no arguments, takes %d", cl.Fn.NumParameters)
+	}
+
+	result := object.NewChannel(1)
+	task := vm.task()
+
+	go func() {
+		// A task runs outside of SafeRun, and a panic on its goroutine would
+		// end the host process, so it fails the task like it fails SafeRun
+		defer func() {
+			if r := recover(); r != nil {
+				err := task.locate(fmt.Errorf("vm panic: %v", r))
+				result.Send(context.Background(), &object.Error{Message: err.Error()})
+			}
+		}()
+
+		value, err := task.CallFunction(cl)
+		if err != nil {
+			value = &object.Error{Message: err.Error()}
+		}
+		// The buffered result never blocks the send
+		result.Send(context.Background(), value)
+	}()
+
+	return result, nil
+}
+
+// task returns a VM for running a spawned closure. It shares the constants,
+// globals, builtins and limits of vm, charging its instructions to the same
+// budget, but has stacks of its own, and it is neither profiled nor debugged.
+// From the first spawn on, vm and its tasks lock the globals they share
+func (vm *VM) task() *VM {
+	if vm.globalsMu == nil {
+		vm.globalsMu = &sync.RWMutex{}
+	}
+
+	mainClosure := &object.Closure{Fn: &object.CompiledFunction{}}
+
+	frames := make([]*Frame, initialFrames)
+	frames[0] = NewFrame(mainClosure, 0)
+
+	return &VM{
+		constants:       vm.constants,
+		stack:           make([]object.Object, initialStackSize),
+		globals:         vm.globals,
+		globalsMu:       vm.globalsMu,
+		symbolTable:     vm.symbolTable,
+		builtins:        vm.builtins,
+		frames:          frames,
+		framesIndex:     1,
+		maxStack:        vm.maxStack,
+		maxFrames:       vm.maxFrames,
+		maxInstructions: vm.maxInstructions,
+		ctx:             vm.ctx,
+		spent:           vm.spent,
+	}
+}
@@ -0,0 +1,137 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"go-compiler/src/monkey/compiler"
+	"go-compiler/src/monkey/object"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpawn(t *testing.T) {
+	tests := []vmTestCase{
+		{`receive(spawn fn() { 40 + 2 })`, 42},
+		{`receive(spawn fn() { })`, Null},
+		{`let x = 10; receive(spawn fn() { x * 2 })`, 20},
+		{`
+		let results = chan();
+		let square = fn(n) { fn() { send(results, n * n) } };
+		spawn square(2);
+		spawn square(3);
+		receive(results) + receive(results)
+		`, 13},
+		{`
+		let ping = chan();
+		let pong = chan();
+		spawn fn() { send(pong, receive(ping) + 1) };
+		send(ping, 1);
+		receive(pong)
+		`, 2},
+		{`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+		let tasks = [spawn fn() { fib(15) }, spawn fn() { fib(16) }];
+		receive(tasks[0]) + receive(tasks[1])`, 1597},
+		{`let c = chan(2); send(c, 1); send(c, 2); [receive(c), receive(c)]`, []int{1, 2}},
+		{`send(chan(1), 1)`, Null},
+		// A task that fails sends its error, raised where it is received
+		{`try { receive(spawn fn() { 1 + true }) } catch (e) { e }`,
+			"runtime error at line 1, col 30: unsupported types for binary operation: INTEGER BOOLEAN"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSpawnErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"spawn 1", "runtime error at line 1, col 1: cannot spawn INTEGER"},
+		{"spawn fn(x) { x }", "runtime error at line 1, col 1: spawned function must take no arguments, takes 1"},
+		{`chan(1, 2)`, "runtime error at line 1, col 5: wrong number of arguments. got=2, want=0 or 1"},
+		{`chan("a")`, "runtime error at line 1, col 5: argument to `chan` must be INTEGER, got STRING"},
+		{`chan(-1)`, "runtime error at line 1, col 5: channel size must not be negative, got -1"},
+		{`send(1, 1)`, "runtime error at line 1, col 5: argument to `send` must be CHANNEL, got INTEGER"},
+		{`receive(1)`, "runtime error at line 1, col 8: argument to `receive` must be CHANNEL, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		err := runWithOptions(t, tt.input, Options{})
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestSpawnedTasksShareLimits(t *testing.T) {
+	input := "let f = fn() { f() + 1 }; receive(spawn f)"
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = NewWithOptions(comp.Bytecode(), Options{MaxFrames: 10}).Run()
+	if err == nil || !strings.Contains(err.Error(), "call depth exceeded: more than 10 frames") {
+		t.Errorf("task did not run within the limits of its VM. got=%v", err)
+	}
+
+	// Tasks spend the instruction budget of the VM that spawned them
+	input = "let work = fn() { while (true) { } }; spawn work; spawn work; receive(spawn work)"
+	err = runWithOptions(t, input, Options{MaxInstructions: 10000})
+	if err == nil || !strings.Contains(err.Error(), "instruction limit exceeded: more than 10000 instructions") {
+		t.Errorf("tasks escaped the instruction limit. got=%v", err)
+	}
+}
+
+func TestSpawnedTaskPanics(t *testing.T) {
+	// A task that panics fails like SafeRun instead of ending the process
+	input := "let f = fn() { if (false) { let y = 1 }; y + 1 }; receive(spawn f)"
+
+	err := runWithOptions(t, input, Options{})
+	if err == nil || !strings.Contains(err.Error(), "vm panic: ") {
+		t.Errorf("task panic not reported. got=%v", err)
+	}
+}
+
+func TestChannelsStopWithTheContext(t *testing.T) {
+	for _, input := range []string{"receive(chan())", "send(chan(), 1)", "let c = chan(); spawn fn() { receive(c) }; receive(c)"} {
+		ctx, stop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+
+		err := runWithOptions(t, input, Options{Context: ctx})
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != Cancelled || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%q did not stop at the deadline. got=%v", input, err)
+		}
+		stop()
+	}
+}
+
+func TestSpawnedTasksShareGlobals(t *testing.T) {
+	input := `
+	let x = 0;
+	let count = fn() { let i = 0; while (i < 20000) { x = x + 1; i = i + 1 } };
+	let tasks = [spawn count, spawn count];
+	receive(tasks[0]);
+	receive(tasks[1]);
+	x`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// Unsynchronized increments may be lost, but the globals stay intact
+	x, ok := vm.LastPoppedStackElem().(*object.Integer)
+	if !ok || x.Value < 20000 || x.Value > 40000 {
+		t.Errorf("wrong count. got=%v", vm.LastPoppedStackElem())
+	}
+}
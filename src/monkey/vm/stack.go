@@ -0,0 +1,58 @@
+package vm
+
+import "go-compiler/src/monkey/object"
+
+// growStack makes room for n values on the operand stack, doubling its size
+// until they fit, and fails once n is more than maxStack
+func (vm *VM) growStack(n int) error {
+	if n <= len(vm.stack) {
+		return nil
+	}
+	if n > vm.maxStack {
+		return vm.overflow(StackLimit, vm.maxStack)
+	}
+
+	size := len(vm.stack) * 2
+	for size < n {
+		size *= 2
+	}
+	if size > vm.maxStack {
+		size = vm.maxStack
+	}
+
+	// Everything is copied, as the value above sp is the last one popped
+	stack := make([]object.Object, size)
+	copy(stack, vm.stack)
+	vm.stack = stack
+
+	return nil
+}
+
+// growFrames doubles the frame stack, up to maxFrames
+func (vm *VM) growFrames() {
+	size := len(vm.frames) * 2
+	if size > vm.maxFrames {
+		size = vm.maxFrames
+	}
+
+	frames := make([]*Frame, size)
+	copy(frames, vm.frames)
+	vm.frames = frames
+}
+
+// overflow reports that limit was exceeded by the instruction being executed,
+// recording where it happened and how deep the stacks were
+func (vm *VM) overflow(limit Limit, max int) *LimitError {
+	frame := vm.currentFrame()
+	fn := frame.cl.Fn
+
+	return &LimitError{
+		Limit:    limit,
+		Max:      max,
+		Function: vm.functionIndexes()[fn],
+		Name:     vm.functionNames()[fn],
+		Offset:   fn.Instructions.InstructionStart(frame.ip),
+		Stack:    vm.sp,
+		Frames:   vm.framesIndex,
+	}
+}
@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"errors"
+	"go-compiler/src/monkey/compiler"
+	"testing"
+)
+
+func TestStacksGrow(t *testing.T) {
+	input := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(500)"
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if len(vm.stack) != initialStackSize || len(vm.frames) != initialFrames {
+		t.Fatalf("stacks do not start small. got=%d values, %d frames", len(vm.stack), len(vm.frames))
+	}
+
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 500, vm.LastPoppedStackElem())
+
+	if len(vm.frames) <= 500 || len(vm.frames) > MaxFrames {
+		t.Errorf("frames did not grow to fit the calls. got=%d", len(vm.frames))
+	}
+	if len(vm.stack) <= 500 || len(vm.stack) > StackSize {
+		t.Errorf("stack did not grow to fit the calls. got=%d", len(vm.stack))
+	}
+}
+
+func TestOptionsRaiseStackLimits(t *testing.T) {
+	input := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(3000)"
+
+	var limitErr *LimitError
+	if err := runWithOptions(t, input, Options{}); !errors.As(err, &limitErr) {
+		t.Fatalf("expected the default limits to be exceeded. got=%v", err)
+	}
+
+	err := runWithOptions(t, input, Options{MaxStack: 1 << 16, MaxFrames: 4096})
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+}
+
+func TestOverflowDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		options  Options
+		expected LimitError
+		message  string
+	}{
+		{
+			"[1, 2, 3, 4, 5]",
+			Options{MaxStack: 4},
+			LimitError{Limit: StackLimit, Max: 4, Function: -1, Name: "main", Offset: 12, Stack: 4, Frames: 1},
+			"runtime error at line 1, col 14: stack overflow: more than 4 values (at 0012 in main, 4 values on the stack in 1 frames)",
+		},
+		{
+			"let f = fn(n) { 1 + f(n + 1) }; f(0)",
+			Options{MaxFrames: 10},
+			LimitError{Limit: FrameLimit, Max: 10, Function: 1, Name: "f", Offset: 10, Stack: 29, Frames: 10},
+			"runtime error at line 1, col 22: call depth exceeded: more than 10 frames (at 0010 in f (fn 1), 29 values on the stack in 10 frames)",
+		},
+	}
+
+	for _, tt := range tests {
+		err := runWithOptions(t, tt.input, tt.options)
+
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("%s: expected LimitError, got=%v", tt.input, err)
+		}
+		if *limitErr != tt.expected {
+			t.Errorf("%s: wrong limit error. want=%+v, got=%+v", tt.input, tt.expected, *limitErr)
+		}
+		if err.Error() != tt.message {
+			t.Errorf("%s: wrong message.\nwant=%q\ngot=%q", tt.input, tt.message, err)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package vm
+
+import (
+	"fmt"
+	"go-compiler/src/monkey/code"
+	"go-compiler/src/monkey/compiler"
+	"go-compiler/src/monkey/object"
+)
+
+// VerifyError locates an instruction that Verify rejected
+type VerifyError struct {
+	Function int // constant index of the function, or -1 for the main instructions
+	Offset   int
+	Err      error
+}
+
+func (e *VerifyError) Error() string {
+	if e.Function < 0 {
+		return fmt.Sprintf("invalid bytecode at %04d: %s", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("invalid bytecode in function %d at %04d: %s", e.Function, e.Offset, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// Verify checks that every instruction of the bytecode can be executed
+// without reading out of bounds, so bytecode loaded from outside the compiler
+// is rejected before Run rather than failing part way through it.
+//
+// Opcodes must be defined and their operands complete. Constant, global,
+// local, free and builtin indices must be in range, jumps must land on an
+// instruction of the same function, and functions must end with a return.
+// Along every path through a function no instruction may pop more values
+// than the path has pushed, no OpEndTry may end a try block the path has not
+// entered, and paths that meet must agree on both. Only functions may return.
+func Verify(bytecode *compiler.Bytecode) error {
+	v := &verifier{
+		constants: bytecode.Constants,
+		globals:   GlobalsSize,
+		builtins:  len(object.Builtins),
+		free:      map[int]int{},
+	}
+	if bytecode.SymbolTable != nil {
+		v.globals = bytecode.SymbolTable.NumDefinitions()
+	}
+	if bytecode.Builtins != nil {
+		v.builtins = len(bytecode.Builtins)
+	}
+
+	// A module's top level is checked like a function at its constant index
+	functions := map[int]*object.CompiledFunction{}
+	for i, c := range v.constants {
+		switch c := c.(type) {
+		case *object.CompiledFunction:
+			functions[i] = c
+		case *object.CompiledModule:
+			if c.Fn == nil {
+				err := fmt.Errorf("module %q has no function", c.Path)
+				return &VerifyError{Function: i, Offset: 0, Err: err}
+			}
+			if c.Slot >= v.globals {
+				err := fmt.Errorf("module %q global slot %d out of range, have %d globals", c.Path, c.Slot, v.globals)
+				return &VerifyError{Function: i, Offset: 0, Err: err}
+			}
+			functions[i] = c.Fn
+		}
+	}
+
+	// Closures may be created anywhere, so record how many free variables
+	// each function is given before checking any body
+	err := v.collectFree(-1, bytecode.Instructions)
+	if err != nil {
+		return err
+	}
+	for i := range v.constants {
+		if fn, ok := functions[i]; ok {
+			err = v.collectFree(i, fn.Instructions)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = v.verify(-1, bytecode.Instructions, nil)
+	if err != nil {
+		return err
+	}
+	for i := range v.constants {
+		if fn, ok := functions[i]; ok {
+			err = v.verify(i, fn.Instructions, fn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type verifier struct {
+	constants []object.Object
+	globals   int
+	builtins  int
+
+	// free maps function constants to the fewest free variables any
+	// OpClosure gives them
+	free map[int]int
+}
+
+// collectFree decodes ins, recording the free variable counts of its
+// OpClosure instructions
+func (v *verifier) collectFree(function int, ins code.Instructions) error {
+	decoded, err := decode(function, ins)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range decoded {
+		if d.op != code.OpClosure {
+			continue
+		}
+
+		index, numFree := d.operands[0], d.operands[1]
+		if index >= len(v.constants) {
+			err := fmt.Errorf("constant index %d out of range, have %d constants", index, len(v.constants))
+			return &VerifyError{Function: function, Offset: d.offset, Err: err}
+		}
+		if _, ok := v.constants[index].(*object.CompiledFunction); !ok {
+			err := fmt.Errorf("closure over constant %d of type %s", index, v.constants[index].Type())
+			return &VerifyError{Function: function, Offset: d.offset, Err: err}
+		}
+
+		if n, ok := v.free[index]; !ok || numFree < n {
+			v.free[index] = numFree
+		}
+	}
+
+	return nil
+}
+
+// verify checks the operands of the instructions of the main program, when fn
+// is nil, or of the function at constant index function
+func (v *verifier) verify(function int, ins code.Instructions, fn *object.CompiledFunction) error {
+	decoded, err := decode(function, ins)
+	if err != nil {
+		return err
+	}
+
+	starts := map[int]bool{}
+	for _, d := range decoded {
+		starts[d.offset] = true
+	}
+
+	if fn != nil {
+		if fn.NumParameters > fn.NumLocals {
+			err := fmt.Errorf("%d parameters but only %d locals", fn.NumParameters, fn.NumLocals)
+			return &VerifyError{Function: function, Offset: 0, Err: err}
+		}
+
+		// Running past the end of a function would return to the caller's
+		// loop without popping its frame
+		if n := len(decoded); n == 0 || (decoded[n-1].op != code.OpReturnValue && decoded[n-1].op != code.OpReturn) {
+			err := fmt.Errorf("function does not end with a return")
+			return &VerifyError{Function: function, Offset: len(ins), Err: err}
+		}
+	}
+
+	for i, d := range decoded {
+		err := v.checkOperands(function, fn, ins, d, starts)
+		if err != nil {
+			return &VerifyError{Function: function, Offset: d.offset, Err: err}
+		}
+
+		if d.op == code.OpJumpTable {
+			err := checkJumpTable(decoded[i+1:], d.operands[1])
+			if err != nil {
+				return &VerifyError{Function: function, Offset: d.offset, Err: err}
+			}
+		}
+	}
+
+	offset, err := checkStack(decoded, len(ins))
+	if err != nil {
+		return &VerifyError{Function: function, Offset: offset, Err: err}
+	}
+
+	return nil
+}
+
+// checkOperands checks the operands of d against the bytecode's sizes.
+// starts holds the offsets of the instructions in ins
+func (v *verifier) checkOperands(function int, fn *object.CompiledFunction, ins code.Instructions,
+	d decodedInstruction, starts map[int]bool) error {
+	switch d.op {
+	case code.OpConstant:
+		if d.operands[0] >= len(v.constants) {
+			return fmt.Errorf("constant index %d out of range, have %d constants", d.operands[0], len(v.constants))
+		}
+
+	case code.OpTry:
+		if !starts[d.operands[0]] {
+			return fmt.Errorf("handler %d is not an instruction", d.operands[0])
+		}
+
+	case code.OpJump, code.OpJumpNotTruthy:
+		target := d.operands[0]
+		// Only the main instructions may jump to their end to finish
+		if !starts[target] && (fn != nil || target != len(ins)) {
+			return fmt.Errorf("jump target %d is not an instruction", target)
+		}
+
+	case code.OpImport:
+		if d.operands[0] >= len(v.constants) {
+			return fmt.Errorf("constant index %d out of range, have %d constants", d.operands[0], len(v.constants))
+		}
+		if _, ok := v.constants[d.operands[0]].(*object.CompiledModule); !ok {
+			return fmt.Errorf("import of constant %d of type %s", d.operands[0], v.constants[d.operands[0]].Type())
+		}
+
+	case code.OpGetGlobal, code.OpSetGlobal:
+		if d.operands[0] >= v.globals {
+			return fmt.Errorf("global index %d out of range, have %d globals", d.operands[0], v.globals)
+		}
+
+	case code.OpGetLocal, code.OpSetLocal:
+		if fn == nil {
+			return fmt.Errorf("%s outside of a function", opName(d.op))
+		}
+		if d.operands[0] >= fn.NumLocals {
+			return fmt.Errorf("local index %d out of range, have %d locals", d.operands[0], fn.NumLocals)
+		}
+
+	case code.OpCurrentClosure, code.OpTailCall, code.OpReturnValue, code.OpReturn:
+		if fn == nil {
+			return fmt.Errorf("%s outside of a function", opName(d.op))
+		}
+
+	case code.OpGetFree:
+		if fn == nil {
+			return fmt.Errorf("%s outside of a function", opName(d.op))
+		}
+		if numFree := v.free[function]; d.operands[0] >= numFree {
+			return fmt.Errorf("free index %d out of range, have %d free variables", d.operands[0], numFree)
+		}
+
+	case code.OpGetBuiltin:
+		if d.operands[0] >= v.builtins {
+			return fmt.Errorf("builtin index %d out of range, have %d builtins", d.operands[0], v.builtins)
+		}
+
+	case code.OpHash:
+		if d.operands[0]%2 != 0 {
+			return fmt.Errorf("hash of %d values is not made of key and value pairs", d.operands[0])
+		}
+	}
+
+	return nil
+}
+
+// checkJumpTable checks that the size entries of a jump table, which the VM
+// finds by position, are the OpJump instructions following it
+func checkJumpTable(following []decodedInstruction, size int) error {
+	if len(following) < size {
+		return fmt.Errorf("jump table of %d entries has only %d instructions after it", size, len(following))
+	}
+
+	for _, entry := range following[:size] {
+		if entry.op != code.OpJump {
+			return fmt.Errorf("jump table entry at %04d is %s, not OpJump", entry.offset, opName(entry.op))
+		}
+	}
+	return nil
+}
+
+// checkStack follows every path through the instructions from the first,
+// tracking how many values each leaves on the stack above the frame's locals
+// and how many try blocks it is inside. It returns the offset of an
+// instruction that would pop a value the path has not pushed or end a try
+// block it has not entered, or where paths that disagree on either meet.
+// Checked jumps and jump tables are assumed
+func checkStack(decoded []decodedInstruction, end int) (int, error) {
+	index := make(map[int]int, len(decoded))
+	for i, d := range decoded {
+		index[d.offset] = i
+	}
+
+	type state struct{ i, height, tries int }
+	arrivals := make([]state, len(decoded))
+	seen := make([]bool, len(decoded))
+	work := []state{{0, 0, 0}}
+
+	var failedAt int
+	var failure error
+
+	// reach records the height and try depth on arriving at decoded[i],
+	// failing if another path arrived with different ones
+	reach := func(i, height, tries int) bool {
+		if i >= len(decoded) {
+			return true
+		}
+		if seen[i] {
+			switch arrived := arrivals[i]; {
+			case arrived.height != height:
+				failedAt = decoded[i].offset
+				failure = fmt.Errorf("paths meet with %d and %d values on the stack", arrived.height, height)
+				return false
+			case arrived.tries != tries:
+				failedAt = decoded[i].offset
+				failure = fmt.Errorf("paths meet inside %d and %d try blocks", arrived.tries, tries)
+				return false
+			}
+			return true
+		}
+		seen[i], arrivals[i] = true, state{i, height, tries}
+		work = append(work, arrivals[i])
+		return true
+	}
+
+	// A jump to the end of the main instructions has no instruction to reach
+	jumpTo := func(offset, height, tries int) bool {
+		if i, ok := index[offset]; ok {
+			return reach(i, height, tries)
+		}
+		return offset == end
+	}
+
+	if len(decoded) == 0 {
+		return 0, nil
+	}
+	seen[0] = true
+
+	for len(work) > 0 {
+		s := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		d := decoded[s.i]
+		pops, pushes := stackEffect(d)
+		if s.height < pops {
+			return d.offset, fmt.Errorf("%s pops %d values with %d on the stack", opName(d.op), pops, s.height)
+		}
+		height, tries := s.height-pops+pushes, s.tries
+
+		ok := true
+		switch d.op {
+		case code.OpJump:
+			ok = jumpTo(d.operands[0], height, tries)
+		case code.OpJumpNotTruthy:
+			ok = jumpTo(d.operands[0], height, tries) && reach(s.i+1, height, tries)
+		case code.OpTry:
+			// The handler starts with the stack unwound to here, the
+			// exception pushed and the try block left
+			ok = jumpTo(d.operands[0], height+1, tries) && reach(s.i+1, height, tries+1)
+		case code.OpEndTry:
+			if tries == 0 {
+				return d.offset, fmt.Errorf("OpEndTry outside of a try block")
+			}
+			ok = reach(s.i+1, height, tries-1)
+		case code.OpJumpTable:
+			for entry := s.i + 1; ok && entry <= s.i+1+d.operands[1]; entry++ {
+				ok = reach(entry, height, tries)
+			}
+		case code.OpReturnValue, code.OpReturn, code.OpThrow:
+		default:
+			ok = reach(s.i+1, height, tries)
+		}
+		if !ok {
+			return failedAt, failure
+		}
+	}
+
+	return 0, nil
+}
+
+// stackEffect returns how many values d pops off the stack and how many it
+// pushes back
+func stackEffect(d decodedInstruction) (int, int) {
+	switch d.op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull, code.OpLoadImmediate,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetFree, code.OpGetBuiltin,
+		code.OpCurrentClosure, code.OpImport:
+		return 0, 1
+
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpEqual, code.OpNotEqual,
+		code.OpGreaterThan, code.OpGreaterThanOrEqual, code.OpIndex:
+		return 2, 1
+
+	case code.OpMinus, code.OpBang, code.OpBool, code.OpToString, code.OpSpawn:
+		return 1, 1
+
+	case code.OpPop, code.OpSetGlobal, code.OpSetLocal, code.OpJumpNotTruthy,
+		code.OpJumpTable, code.OpThrow, code.OpReturnValue:
+		return 1, 0
+
+	case code.OpArray, code.OpHash:
+		return d.operands[0], 1
+
+	case code.OpDestructure:
+		return 1, d.operands[0]
+
+	case code.OpCall, code.OpTailCall:
+		return d.operands[0] + 1, 1
+
+	case code.OpClosure:
+		return d.operands[1], 1
+	}
+
+	// OpJump, OpReturn, OpTry and OpEndTry leave the stack alone
+	return 0, 0
+}
+
+type decodedInstruction struct {
+	offset   int
+	op       code.Opcode
+	operands []int
+}
+
+// decode splits ins into instructions, failing on undefined opcodes and
+// truncated operands
+func decode(function int, ins code.Instructions) ([]decodedInstruction, error) {
+	decoded := []decodedInstruction{}
+
+	for offset := 0; offset < len(ins); {
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			return nil, &VerifyError{Function: function, Offset: offset, Err: err}
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if offset+1+width > len(ins) {
+			err := fmt.Errorf("%s operands are truncated", def.Name)
+			return nil, &VerifyError{Function: function, Offset: offset, Err: err}
+		}
+
+		operands, read := code.ReadOperands(def, ins[offset+1:])
+		decoded = append(decoded, decodedInstruction{offset: offset, op: code.Opcode(ins[offset]), operands: operands})
+		offset += 1 + read
+	}
+
+	return decoded, nil
+}
+
+func opName(op code.Opcode) string {
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		return fmt.Sprintf("opcode %d", op)
+	}
+	return def.Name
+}
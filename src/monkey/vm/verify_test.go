@@ -0,0 +1,358 @@
+package vm
+
+import (
+	"errors"
+	"go-compiler/src/monkey/code"
+	"go-compiler/src/monkey/compiler"
+	"go-compiler/src/monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestVerifyRejectsMalformedBytecode(t *testing.T) {
+	function := func(numLocals, numParameters int, ins ...code.Instructions) *object.CompiledFunction {
+		return &object.CompiledFunction{
+			Instructions:  concat(ins...),
+			NumLocals:     numLocals,
+			NumParameters: numParameters,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		bytecode *compiler.Bytecode
+		expected string
+		function int
+		offset   int
+	}{
+		{
+			name:     "undefined opcode",
+			bytecode: &compiler.Bytecode{Instructions: code.Instructions{byte(code.OpNull), 255}},
+			expected: "invalid bytecode at 0001: opcode 255 undefined",
+			function: -1,
+			offset:   1,
+		},
+		{
+			name:     "truncated operands",
+			bytecode: &compiler.Bytecode{Instructions: code.Make(code.OpConstant, 0)[:2]},
+			expected: "invalid bytecode at 0000: OpConstant operands are truncated",
+			function: -1,
+		},
+		{
+			name: "constant index",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpConstant, 0), code.Make(code.OpConstant, 1)),
+				Constants:    []object.Object{object.NewInteger(1)},
+			},
+			expected: "invalid bytecode at 0003: constant index 1 out of range, have 1 constants",
+			function: -1,
+			offset:   3,
+		},
+		{
+			name:     "jump into an operand",
+			bytecode: &compiler.Bytecode{Instructions: concat(code.Make(code.OpJump, 4), code.Make(code.OpLoadImmediate, 1))},
+			expected: "invalid bytecode at 0000: jump target 4 is not an instruction",
+			function: -1,
+		},
+		{
+			name:     "jump past the end",
+			bytecode: &compiler.Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 5))},
+			expected: "invalid bytecode at 0001: jump target 5 is not an instruction",
+			function: -1,
+			offset:   1,
+		},
+		{
+			name:     "handler past the end",
+			bytecode: &compiler.Bytecode{Instructions: concat(code.Make(code.OpTry, 4), code.Make(code.OpEndTry))},
+			expected: "invalid bytecode at 0000: handler 4 is not an instruction",
+			function: -1,
+		},
+		{
+			name:     "jump table without entries",
+			bytecode: &compiler.Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpJumpTable, 0, 2), code.Make(code.OpJump, 0), code.Make(code.OpNull))},
+			expected: "invalid bytecode at 0001: jump table entry at 0009 is OpNull, not OpJump",
+			function: -1,
+			offset:   1,
+		},
+		{
+			name: "global index",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpSetGlobal, 0)),
+				SymbolTable:  compiler.NewSymbolTable(),
+			},
+			expected: "invalid bytecode at 0001: global index 0 out of range, have 0 globals",
+			function: -1,
+			offset:   1,
+		},
+		{
+			name:     "builtin index",
+			bytecode: &compiler.Bytecode{Instructions: code.Make(code.OpGetBuiltin, len(object.Builtins))},
+			expected: "builtin index",
+			function: -1,
+		},
+		{
+			name:     "local outside of a function",
+			bytecode: &compiler.Bytecode{Instructions: code.Make(code.OpGetLocal, 0)},
+			expected: "invalid bytecode at 0000: OpGetLocal outside of a function",
+			function: -1,
+		},
+		{
+			name: "import of a non-module",
+			bytecode: &compiler.Bytecode{
+				Instructions: code.Make(code.OpImport, 0),
+				Constants:    []object.Object{object.NewInteger(1)},
+			},
+			expected: "import of constant 0 of type INTEGER",
+			function: -1,
+		},
+		{
+			name: "module slot",
+			bytecode: &compiler.Bytecode{
+				Instructions: code.Make(code.OpImport, 0),
+				Constants: []object.Object{&object.CompiledModule{
+					Path: "m.monkey",
+					Fn:   function(0, 0, code.Make(code.OpNull), code.Make(code.OpReturnValue)),
+					Slot: GlobalsSize,
+				}},
+			},
+			expected: "global slot 65536 out of range",
+			function: 0,
+		},
+		{
+			name:     "tail call outside of a function",
+			bytecode: &compiler.Bytecode{Instructions: code.Make(code.OpTailCall, 0)},
+			expected: "invalid bytecode at 0000: OpTailCall outside of a function",
+			function: -1,
+		},
+		{
+			name: "closure over a non-function",
+			bytecode: &compiler.Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{object.NewInteger(1)},
+			},
+			expected: "invalid bytecode at 0000: closure over constant 0 of type INTEGER",
+			function: -1,
+		},
+		{
+			name: "local index",
+			bytecode: &compiler.Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants: []object.Object{
+					function(1, 1, code.Make(code.OpGetLocal, 1), code.Make(code.OpReturnValue)),
+				},
+			},
+			expected: "invalid bytecode in function 0 at 0000: local index 1 out of range, have 1 locals",
+			function: 0,
+		},
+		{
+			name: "free index",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpNull), code.Make(code.OpClosure, 0, 1)),
+				Constants: []object.Object{
+					function(0, 0, code.Make(code.OpGetFree, 1), code.Make(code.OpReturnValue)),
+				},
+			},
+			expected: "invalid bytecode in function 0 at 0000: free index 1 out of range, have 1 free variables",
+			function: 0,
+		},
+		{
+			name: "parameters without locals",
+			bytecode: &compiler.Bytecode{
+				Constants: []object.Object{function(0, 1, code.Make(code.OpReturn))},
+			},
+			expected: "invalid bytecode in function 0 at 0000: 1 parameters but only 0 locals",
+			function: 0,
+		},
+		{
+			name: "function without a return",
+			bytecode: &compiler.Bytecode{
+				Constants: []object.Object{function(0, 0, code.Make(code.OpNull))},
+			},
+			expected: "invalid bytecode in function 0 at 0001: function does not end with a return",
+			function: 0,
+			offset:   1,
+		},
+		{
+			name:     "array of values never pushed",
+			bytecode: &compiler.Bytecode{Instructions: concat(code.Make(code.OpNull), code.Make(code.OpArray, 3), code.Make(code.OpPop))},
+			expected: "invalid bytecode at 0001: OpArray pops 3 values with 1 on the stack",
+			function: -1,
+			offset:   1,
+		},
+		{
+			name:     "hash of an odd number of values",
+			bytecode: &compiler.Bytecode{Instructions: concat(code.Make(code.OpNull), code.Make(code.OpHash, 1), code.Make(code.OpPop))},
+			expected: "invalid bytecode at 0001: hash of 1 values is not made of key and value pairs",
+			function: -1,
+			offset:   1,
+		},
+		{
+			name: "call without a callee",
+			bytecode: &compiler.Bytecode{
+				Constants: []object.Object{function(0, 0, code.Make(code.OpCall, 0), code.Make(code.OpReturnValue))},
+			},
+			expected: "invalid bytecode in function 0 at 0000: OpCall pops 1 values with 0 on the stack",
+			function: 0,
+		},
+		{
+			// A function's own locals are not values it can pop
+			name: "pop below the locals",
+			bytecode: &compiler.Bytecode{
+				Constants: []object.Object{function(1, 1, code.Make(code.OpPop), code.Make(code.OpReturn))},
+			},
+			expected: "invalid bytecode in function 0 at 0000: OpPop pops 1 values with 0 on the stack",
+			function: 0,
+		},
+		{
+			name: "closure over free values never pushed",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpClosure, 0, 2), code.Make(code.OpPop)),
+				Constants:    []object.Object{function(0, 0, code.Make(code.OpReturn))},
+			},
+			expected: "invalid bytecode at 0000: OpClosure pops 2 values with 0 on the stack",
+			function: -1,
+		},
+		{
+			name: "paths meeting with different stacks",
+			bytecode: &compiler.Bytecode{Instructions: concat(
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 5), // 0001
+				code.Make(code.OpNull),             // 0004
+				code.Make(code.OpPop),              // 0005
+			)},
+			expected: "invalid bytecode at 0005: paths meet with 0 and 1 values on the stack",
+			function: -1,
+			offset:   5,
+		},
+		{
+			name: "handler without the exception",
+			bytecode: &compiler.Bytecode{Instructions: concat(
+				code.Make(code.OpTry, 5), // 0000
+				code.Make(code.OpEndTry), // 0003
+				code.Make(code.OpNull),   // 0004
+				code.Make(code.OpPop),    // 0005
+				code.Make(code.OpPop),    // 0006
+			)},
+			expected: "invalid bytecode at 0006: OpPop pops 1 values with 0 on the stack",
+			function: -1,
+			offset:   6,
+		},
+		{
+			name:     "return from the main instructions",
+			bytecode: &compiler.Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpReturnValue))},
+			expected: "invalid bytecode at 0001: OpReturnValue outside of a function",
+			function: -1,
+			offset:   1,
+		},
+		{
+			name:     "end of a try block never entered",
+			bytecode: &compiler.Bytecode{Instructions: code.Make(code.OpEndTry)},
+			expected: "invalid bytecode at 0000: OpEndTry outside of a try block",
+			function: -1,
+		},
+		{
+			name: "paths meeting inside different try blocks",
+			bytecode: &compiler.Bytecode{Instructions: concat(
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 7), // 0001
+				code.Make(code.OpTry, 8),           // 0004
+				code.Make(code.OpNull),             // 0007
+				code.Make(code.OpPop),              // 0008
+			)},
+			expected: "invalid bytecode at 0007: paths meet inside 0 and 1 try blocks",
+			function: -1,
+			offset:   7,
+		},
+	}
+
+	for _, tt := range tests {
+		err := Verify(tt.bytecode)
+
+		var verifyErr *VerifyError
+		if !errors.As(err, &verifyErr) {
+			t.Errorf("%s: expected VerifyError, got=%v", tt.name, err)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err)
+		}
+		if verifyErr.Function != tt.function || verifyErr.Offset != tt.offset {
+			t.Errorf("%s: wrong location. want=%d at %d, got=%d at %d",
+				tt.name, tt.function, tt.offset, verifyErr.Function, verifyErr.Offset)
+		}
+	}
+}
+
+func TestVerifyAcceptsCompiledPrograms(t *testing.T) {
+	inputs := []string{
+		"let a = 1; if (a > 0) { a } else { 2 }",
+		"let f = fn(x) { let y = x; fn(z) { x + y + z } }; f(1)(2)",
+		"let i = 0; while (i < 3) { i = i + 1 }",
+		`len(puts("a"))`,
+		"let f = fn(x) { try { x[0] } catch (e) { throw e } }; try { f(1) } catch (e) { e }",
+		"let f = fn(x) { switch (x) { case 1, 2, 3, 4 { 1 } case 5 { 2 } default { 3 } } }; f(2)",
+		"let f = fn(x) { if (x) { return 1 } else { return 2 }; 3 }; f(true)",
+		"let f = fn() { while (true) { return 1; 2 } }; f()",
+		"let f = fn() { let i = 0; while (i < 3) { try { if (i == 1) { return i } } catch (e) { e }; i = i + 1 } }; f()",
+	}
+
+	for _, input := range inputs {
+		for _, options := range []compiler.Options{{}, {Optimize: true, ImmediateIntegers: true}} {
+			comp := compiler.NewWithOptions(options)
+			err := comp.Compile(parse(input))
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			err = Verify(comp.Bytecode())
+			if err != nil {
+				t.Errorf("%s (%+v): unexpected verify error: %s", input, options, err)
+			}
+		}
+	}
+}
+
+func TestVerifyRejectsStackUnderflow(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("let f = fn(a) { a }; f(1)"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+	err = Verify(bytecode)
+	if err != nil {
+		t.Fatalf("unexpected verify error: %s", err)
+	}
+
+	// A saved program with the argument count of its call corrupted used to
+	// pass Verify and panic in Run, reading the callee below the stack
+	call := -1
+	for offset := 0; offset < len(bytecode.Instructions); {
+		op := code.Opcode(bytecode.Instructions[offset])
+		if op == code.OpCall {
+			call = offset
+		}
+		_, read := code.ReadOperandsOf(op, bytecode.Instructions[offset+1:])
+		offset += 1 + read
+	}
+	if call < 0 {
+		t.Fatalf("no OpCall in %s", bytecode.Instructions)
+	}
+	bytecode.Instructions[call+1] = 2
+
+	err = Verify(bytecode)
+	want := "OpCall pops 3 values with 2 on the stack"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("wrong verify error. want=%q, got=%v", want, err)
+	}
+}
+
+func concat(ins ...code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, i := range ins {
+		out = append(out, i...)
+	}
+	return out
+}
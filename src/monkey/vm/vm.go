@@ -1,38 +1,104 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"go-compiler/src/monkey/code"
 	"go-compiler/src/monkey/compiler"
 	"go-compiler/src/monkey/object"
+	"math"
+	"sync"
+	"time"
 )
 
+// StackSize and MaxFrames are the default limits of the operand and frame
+// stacks, which start small and grow as calls need them
 const (
 	StackSize   = 2048
 	GlobalsSize = 65536
+	MaxFrames   = 1024
 )
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+const (
+	initialStackSize = 64
+	initialFrames    = 16
+)
+
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
+
+// RuntimeError is an error raised by an instruction whose source position is
+// known from the line table of the function being executed
+type RuntimeError struct {
+	Position code.Position
+	Err      error
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("runtime error at %s: %s", e.Position, e.Err)
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
 
 type VM struct {
-	constants    []object.Object
-	instructions code.Instructions
+	constants []object.Object
 
 	stack []object.Object
 	sp    int // Always points to the next value. Top of stack is stack[sp-1]
 
-	globals []object.Object
+	globals     []object.Object
+	globalsMu   *sync.RWMutex // set once spawned tasks share the globals
+	symbolTable *compiler.SymbolTable
+
+	builtins []*object.Builtin
+
+	coverage []bool    // coverage[i] is true once the main instruction at offset i executed
+	debugger *Debugger // set while a Debugger is running the VM
+	profile  *profiler // set by EnableProfiling
+
+	frames      []*Frame
+	framesIndex int
+
+	// Limits set by Options; maxStack and maxFrames default to StackSize and MaxFrames
+	maxStack        int
+	maxFrames       int
+	maxInstructions int
+	ctx             context.Context
+	executed        int    // instructions executed, counted only when limited
+	spent           *int64 // instructions executed by the VM and its tasks, against maxInstructions
 }
 
 func New(byteCode *compiler.Bytecode) *VM {
+	builtins := byteCode.Builtins
+	if builtins == nil {
+		builtins = []*object.Builtin{}
+		for _, v := range object.Builtins {
+			builtins = append(builtins, v.Builtin)
+		}
+	}
+
+	mainFn := &object.CompiledFunction{Instructions: byteCode.Instructions, Lines: byteCode.Lines}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, initialFrames)
+	frames[0] = mainFrame
+
 	return &VM{
-		constants:    byteCode.Constants,
-		instructions: byteCode.Instructions,
-		stack:        make([]object.Object, StackSize),
-		sp:           0,
-		globals:      make([]object.Object, GlobalsSize),
+		constants:   byteCode.Constants,
+		stack:       make([]object.Object, initialStackSize),
+		sp:          0,
+		globals:     make([]object.Object, GlobalsSize),
+		symbolTable: byteCode.SymbolTable,
+		builtins:    builtins,
+		frames:      frames,
+		framesIndex: 1,
+		maxStack:    StackSize,
+		maxFrames:   MaxFrames,
 	}
 }
 
@@ -42,6 +108,185 @@ func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	return vm
 }
 
+// getGlobal and setGlobal access the global at index, taking the lock once
+// spawned tasks share the globals
+func (vm *VM) getGlobal(index int) object.Object {
+	if vm.globalsMu == nil {
+		return vm.globals[index]
+	}
+
+	vm.globalsMu.RLock()
+	value := vm.globals[index]
+	vm.globalsMu.RUnlock()
+	return value
+}
+
+func (vm *VM) setGlobal(index int, value object.Object) {
+	if vm.globalsMu == nil {
+		vm.globals[index] = value
+		return
+	}
+
+	vm.globalsMu.Lock()
+	vm.globals[index] = value
+	vm.globalsMu.Unlock()
+}
+
+// SetGlobal seeds the value of a global defined with compiler.DefineGlobal
+func (vm *VM) SetGlobal(name string, value object.Object) error {
+	if vm.symbolTable == nil {
+		return fmt.Errorf("undefined variable %s", name)
+	}
+
+	symbol, ok := vm.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return fmt.Errorf("undefined variable %s", name)
+	}
+
+	vm.setGlobal(symbol.Index, value)
+	return nil
+}
+
+// RegisterBuiltin makes a host-provided Go function available to the bytecode.
+// The name must have been registered with the compiler, whose symbol table
+// gives the index the OpGetBuiltin operands refer to; any other name could
+// never be called, so it is rejected
+func (vm *VM) RegisterBuiltin(name string, fn object.BuiltinFunction) error {
+	if vm.symbolTable == nil {
+		return fmt.Errorf("cannot register builtin %q: bytecode has no symbol table", name)
+	}
+
+	symbol, ok := vm.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.BuiltinScope {
+		return fmt.Errorf("cannot register builtin %q: not a builtin of the compiled program", name)
+	}
+
+	index := symbol.Index
+	if index >= compiler.MaxBuiltins {
+		return fmt.Errorf("cannot register builtin %q: more than %d builtins", name, compiler.MaxBuiltins)
+	}
+
+	builtins := make([]*object.Builtin, len(vm.builtins))
+	copy(builtins, vm.builtins)
+	for len(builtins) <= index {
+		builtins = append(builtins, nil)
+	}
+	builtins[index] = &object.Builtin{Fn: fn}
+
+	vm.builtins = builtins
+	return nil
+}
+
+// Globals returns the globals store, holding every global defined by Run
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
+
+// Function returns the function bound to name after Run has defined it,
+// so it can be invoked repeatedly with CallFunction
+func (vm *VM) Function(name string) (object.Object, error) {
+	if vm.symbolTable == nil {
+		return nil, fmt.Errorf("undefined variable %s", name)
+	}
+
+	symbol, ok := vm.symbolTable.Resolve(name)
+	if !ok {
+		return nil, fmt.Errorf("undefined variable %s", name)
+	}
+
+	var callee object.Object
+	switch symbol.Scope {
+	case compiler.GlobalScope:
+		callee = vm.getGlobal(symbol.Index)
+	case compiler.BuiltinScope:
+		if symbol.Index < len(vm.builtins) {
+			callee = vm.builtins[symbol.Index]
+		}
+	}
+
+	switch callee.(type) {
+	case *object.Closure, *object.Builtin:
+		return callee, nil
+	default:
+		return nil, fmt.Errorf("%s is not a function", name)
+	}
+}
+
+// Call invokes the function bound to name with args after Run has defined it,
+// returning the function's result
+func (vm *VM) Call(name string, args ...object.Object) (object.Object, error) {
+	fn, err := vm.Function(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return vm.CallFunction(fn, args...)
+}
+
+// CallFunction invokes fn, as returned by Function, with args and returns its result
+func (vm *VM) CallFunction(fn object.Object, args ...object.Object) (object.Object, error) {
+	sp, depth := vm.sp, vm.framesIndex
+
+	err := vm.invoke(fn, args)
+	if err != nil {
+		// Unwind what the failed call left behind so the VM stays usable
+		vm.sp, vm.framesIndex = sp, depth
+		return nil, err
+	}
+
+	return vm.pop(), nil
+}
+
+// invoke calls fn with args like OpCall, running a compiled function until it returns
+func (vm *VM) invoke(fn object.Object, args []object.Object) error {
+	depth := vm.framesIndex
+
+	err := vm.push(fn)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		err = vm.push(arg)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = vm.executeCall(len(args))
+	if err != nil {
+		return err
+	}
+
+	return vm.run(depth)
+}
+
+// EnableCoverage records which instruction offsets execute during Run
+func (vm *VM) EnableCoverage() {
+	vm.coverage = make([]bool, len(vm.frames[0].Instructions()))
+}
+
+// Coverage returns the executed instruction offsets, or nil if coverage is disabled
+func (vm *VM) Coverage() []bool {
+	return vm.coverage
+}
+
+// functionIndexes maps every function of the bytecode to its constant index,
+// and the main program to -1
+func (vm *VM) functionIndexes() map[*object.CompiledFunction]int {
+	functions := map[*object.CompiledFunction]int{vm.frames[0].cl.Fn: -1}
+
+	for i, c := range vm.constants {
+		switch c := c.(type) {
+		case *object.CompiledFunction:
+			functions[c] = i
+		case *object.CompiledModule:
+			functions[c.Fn] = i
+		}
+	}
+
+	return functions
+}
+
 func (vm *VM) StackTop() object.Object {
 	if vm.sp == 0 {
 		return nil
@@ -50,28 +295,132 @@ func (vm *VM) StackTop() object.Object {
 }
 
 func (vm *VM) LastPoppedStackElem() object.Object {
+	if vm.sp >= len(vm.stack) {
+		return nil
+	}
 	return vm.stack[vm.sp]
 }
 
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+// pushFrame pushes f, which callers have checked fits within maxFrames
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex == len(vm.frames) {
+		vm.growFrames()
+	}
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
 // Run fetches, decodes and executes instructions
 func (vm *VM) Run() error {
-	// Iterate through the instructions using an instruction pointer
-	for ip := 0; ip < len(vm.instructions); ip++ {
-		op := code.Opcode(vm.instructions[ip])
+	return vm.run(0)
+}
+
+// run executes instructions until the main instructions are exhausted or
+// the frames above depth have returned
+func (vm *VM) run(depth int) error {
+	err := vm.execute(depth)
+	if vm.profile != nil {
+		vm.profile.stop(time.Now())
+	}
+	if err != nil {
+		return vm.locate(err)
+	}
+	return nil
+}
+
+// locate wraps err in a RuntimeError at the source of the current instruction,
+// unless it is already located, no frame is left to run an instruction or the
+// instruction has no line information
+func (vm *VM) locate(err error) error {
+	var located *RuntimeError
+	if errors.As(err, &located) || vm.framesIndex == 0 {
+		return err
+	}
+
+	frame := vm.currentFrame()
+	pos, ok := frame.cl.Fn.Lines.Lookup(frame.ip)
+	if !ok {
+		return err
+	}
+	return &RuntimeError{Position: pos, Err: err}
+}
+
+// execute runs instructions until the frame at depth returns, resuming at
+// the innermost handler above depth whenever an instruction fails with an
+// error that can be caught
+func (vm *VM) execute(depth int) error {
+	for {
+		err := vm.dispatch(depth)
+		if err == nil || !vm.catch(err, depth) {
+			return err
+		}
+	}
+}
+
+// dispatch runs instructions until the frame at depth returns or one fails
+func (vm *VM) dispatch(depth int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.framesIndex > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if vm.debugger != nil && vm.debugger.pause(vm.currentFrame()) {
+			return errPaused
+		}
+
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		if vm.coverage != nil && vm.framesIndex == 1 {
+			vm.coverage[ip] = true
+		}
+		if vm.profile != nil {
+			vm.profile.record(op, vm.currentFrame().cl.Fn)
+		}
+
+		if vm.maxInstructions > 0 || vm.ctx != nil {
+			if err := vm.checkLimits(); err != nil {
+				return err
+			}
+		}
 
 		switch op {
 		case code.OpPop:
+			if vm.sp == 0 {
+				return fmt.Errorf("stack underflow")
+			}
 			vm.pop()
 		case code.OpConstant:
 			// read constant index in the constant pool
-			constIndex := code.ReadUint16(vm.instructions[ip+1:])
-			ip += 2
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
 
 			err := vm.push(vm.constants[constIndex])
 			if err != nil {
 				return err
 			}
 
+		case code.OpLoadImmediate:
+			value := code.ReadInt16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.push(object.NewInteger(int64(value)))
+			if err != nil {
+				return err
+			}
+
 		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
@@ -90,7 +439,7 @@ func (vm *VM) Run() error {
 				return err
 			}
 
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual:
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -102,6 +451,26 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpBool:
+			operand := vm.pop()
+
+			err := vm.push(nativeBoolToBooleanObject(vm.isTruthy(operand)))
+			if err != nil {
+				return err
+			}
+
+		case code.OpToString:
+			operand := vm.pop()
+
+			if _, ok := operand.(*object.String); !ok {
+				operand = &object.String{Value: operand.Inspect()}
+			}
+
+			err := vm.push(operand)
+			if err != nil {
+				return err
+			}
+
 		case code.OpMinus:
 			err := vm.executeMinusOperator()
 			if err != nil {
@@ -109,23 +478,31 @@ func (vm *VM) Run() error {
 			}
 
 		case code.OpJump:
-			pos := int(code.ReadUint16(vm.instructions[ip+1:]))
+			pos := int(code.ReadUint16(ins[ip+1:]))
 			// decrement to adjust with for loop increment
-			ip = pos - 1
+			vm.currentFrame().ip = pos - 1
 
 		case code.OpJumpNotTruthy:
-			pos := int(code.ReadUint16(vm.instructions[ip+1:]))
+			pos := int(code.ReadUint16(ins[ip+1:]))
 			// skip over the jump offset bytes
 			// and set ip at the consequence block
-			ip += 2
+			vm.currentFrame().ip += 2
 
 			conditional := vm.pop()
 			if !vm.isTruthy(conditional) {
 				// since !truthy, set ip at jump offset
 				// to skip the consequence block
-				ip = pos - 1
+				vm.currentFrame().ip = pos - 1
 			}
 
+		case code.OpJumpTable:
+			min := int(code.ReadUint16(ins[ip+1:]))
+			size := int(code.ReadUint16(ins[ip+3:]))
+
+			// Land on the entry for the value, or just past the table
+			table := ip + 5
+			vm.currentFrame().ip = table + jumpTableIndex(vm.pop(), min, size)*jumpWidth - 1
+
 		case code.OpNull:
 			err := vm.push(Null)
 			if err != nil {
@@ -133,23 +510,23 @@ func (vm *VM) Run() error {
 			}
 
 		case code.OpSetGlobal:
-			globalIndex := code.ReadUint16(vm.instructions[ip+1:])
-			ip += 2
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
 
-			vm.globals[globalIndex] = vm.pop()
+			vm.setGlobal(int(globalIndex), vm.pop())
 
 		case code.OpGetGlobal:
-			globalIndex := code.ReadUint16(vm.instructions[ip+1:])
-			ip += 2
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
 
-			err := vm.push(vm.globals[globalIndex])
+			err := vm.push(vm.getGlobal(int(globalIndex)))
 			if err != nil {
 				return err
 			}
 
 		case code.OpArray:
-			numElements := int(code.ReadUint16(vm.instructions[ip+1:]))
-			ip += 2
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
 
 			// Build array using the top numElements from stack
 			array := vm.buildArray(vm.sp-numElements, vm.sp)
@@ -160,9 +537,18 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpDestructure:
+			numNames := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			err := vm.executeDestructure(numNames)
+			if err != nil {
+				return err
+			}
+
 		case code.OpHash:
-			numElements := int(code.ReadUint16(vm.instructions[ip+1:]))
-			ip += 2
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
 
 			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
 			if err != nil {
@@ -183,16 +569,156 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			definition := vm.builtins[builtinIndex]
+
+			err := vm.push(definition)
+			if err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.importModule(int(constIndex))
+			if err != nil {
+				return err
+			}
+
+		case code.OpTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			frame := vm.currentFrame()
+			frame.handlers = append(frame.handlers, handler{ip: pos, sp: vm.sp})
+
+		case code.OpEndTry:
+			frame := vm.currentFrame()
+			frame.handlers = frame.handlers[:len(frame.handlers)-1]
+
+		case code.OpThrow:
+			return &ThrownError{Value: vm.pop()}
+
+		case code.OpSpawn:
+			result, err := vm.spawn(vm.pop())
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(result)
+			if err != nil {
+				return err
+			}
+
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeTailCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			frame := vm.popFrame()
+			// Drop the locals, arguments and the function itself
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpCurrentClosure:
+			err := vm.push(vm.currentFrame().cl)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// SafeRun is Run for untrusted bytecode, returning any panic during execution as an error
+func (vm *VM) SafeRun() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = vm.locate(fmt.Errorf("vm panic: %v", r))
+		}
+	}()
+
+	return vm.Run()
+}
+
 // push objects onto call stack
 func (vm *VM) push(obj object.Object) error {
-	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+	if vm.sp >= len(vm.stack) {
+		if err := vm.growStack(vm.sp + 1); err != nil {
+			return err
+		}
 	}
 
 	vm.stack[vm.sp] = obj
@@ -208,31 +734,89 @@ func (vm *VM) pop() object.Object {
 	return o
 }
 
-// executeBinaryOperation performs binary operation on left and right objects
+// jumpWidth is the size of an OpJump, the stride of jump table entries
+var jumpWidth = len(code.Make(code.OpJump, 0))
+
+// jumpTableIndex returns the entry of a jump table starting at min for value,
+// or size when value is not a number in the table
+func jumpTableIndex(value object.Object, min, size int) int {
+	var n float64
+	switch value := value.(type) {
+	case *object.Integer:
+		n = float64(value.Value)
+	case *object.Float:
+		n = value.Value
+	default:
+		return size
+	}
+
+	// Floats equal to an integer case select it, as == would
+	if n < float64(min) || n >= float64(min+size) || n != math.Trunc(n) {
+		return size
+	}
+	return int(n) - min
+}
+
+// executeBinaryOperation performs binary operation on left and right objects,
+// taking the executeIntegerArithmetic fast path when both are integers
 func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	left, leftOk := vm.stack[vm.sp-2].(*object.Integer)
+	right, rightOk := vm.stack[vm.sp-1].(*object.Integer)
+	if leftOk && rightOk {
+		return vm.executeIntegerArithmetic(op, left.Value, right.Value)
+	}
 
-	right := vm.pop()
-	left := vm.pop()
+	rightObj := vm.pop()
+	leftObj := vm.pop()
 
-	leftType := left.Type()
-	rightType := right.Type()
+	leftType := leftObj.Type()
+	rightType := rightObj.Type()
 
-	if leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ {
-		return vm.executeBinaryIntegerOperation(op, left, right)
-	} else if leftType == object.STRING_OBJ && rightType == object.STRING_OBJ {
-		return vm.executeBinaryStringOperation(op, left, right)
+	if leftType == object.STRING_OBJ && rightType == object.STRING_OBJ {
+		return vm.executeBinaryStringOperation(op, leftObj, rightObj)
+	} else if isNumber(leftObj) && isNumber(rightObj) {
+		return vm.executeBinaryFloatOperation(op, leftObj, rightObj)
 	}
 
 	return fmt.Errorf("unsupported types for binary operation: %s %s", leftType, rightType)
 }
 
-// executeBinaryIntegerOperation performs binary operation on left and right objects
-func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
+// executeIntegerArithmetic is the fast path for arithmetic on the two integers
+// on top of the stack. The result overwrites the left operand in place, so no
+// type dispatch or stack bounds check is needed, and results in the
+// object.NewInteger range allocate nothing
+func (vm *VM) executeIntegerArithmetic(op code.Opcode, left, right int64) error {
+	var result int64
 
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+	switch op {
+	case code.OpAdd:
+		result = left + right
+	case code.OpSub:
+		result = left - right
+	case code.OpMul:
+		result = left * right
+	case code.OpDiv:
+		if right == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		result = left / right
+	default:
+		return fmt.Errorf("unknown integer operation: %s", opName(op))
+	}
 
-	var result int64
+	vm.sp--
+	vm.stack[vm.sp-1] = object.NewInteger(result)
+	return nil
+}
+
+// executeBinaryFloatOperation performs arithmetic on two numbers where at
+// least one is a Float, promoting an Integer operand to Float
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+
+	leftValue, _ := object.FloatValue(left)
+	rightValue, _ := object.FloatValue(right)
+
+	var result float64
 
 	switch op {
 	case code.OpAdd:
@@ -242,19 +826,27 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	case code.OpMul:
 		result = leftValue * rightValue
 	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
 		result = leftValue / rightValue
 	default:
-		return fmt.Errorf("unknown integer operation: %d", op)
+		return fmt.Errorf("unknown float operation: %s", opName(op))
 	}
 
-	return vm.push(&object.Integer{Value: result})
+	return vm.push(&object.Float{Value: result})
+}
+
+func isNumber(obj object.Object) bool {
+	_, ok := object.FloatValue(obj)
+	return ok
 }
 
 // executeBinaryStringOperation performs binary operation on left and right objects
 func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
 
 	if op != code.OpAdd {
-		return fmt.Errorf("unknown integer operation: %d", op)
+		return fmt.Errorf("unknown string operation: %s", opName(op))
 	}
 
 	leftValue := left.(*object.String).Value
@@ -272,14 +864,22 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
+	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left, right)
+	}
+
+	if isNumber(left) && isNumber(right) {
+		return vm.executeFloatComparison(op, left, right)
+	}
+
 	switch op {
 	case code.OpEqual:
 		return vm.push(nativeBoolToBooleanObject(right == left))
 	case code.OpNotEqual:
 		return vm.push(nativeBoolToBooleanObject(right != left))
 	default:
-		return fmt.Errorf("unkown operator: %d (%s %s)",
-			op, left.Type(), right.Type())
+		return fmt.Errorf("unknown operator: %s (%s %s)",
+			opName(op), left.Type(), right.Type())
 	}
 }
 
@@ -295,8 +895,48 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
 		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
 	case code.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
 	default:
-		return fmt.Errorf("unkown operator: %d", op)
+		return fmt.Errorf("unknown operator: %s", opName(op))
+	}
+}
+
+// executeFloatComparison compares numbers where at least one is a Float
+func (vm *VM) executeFloatComparison(op code.Opcode, left, right object.Object) error {
+
+	leftValue, _ := object.FloatValue(left)
+	rightValue, _ := object.FloatValue(right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %s", opName(op))
+	}
+}
+
+// executeStringComparison compares strings, short-circuiting on interned pointers
+func (vm *VM) executeStringComparison(op code.Opcode, left, right object.Object) error {
+	equal := left == right
+	if !equal {
+		equal = left.(*object.String).Value == right.(*object.String).Value
+	}
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(equal))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(!equal))
+	default:
+		return fmt.Errorf("unknown operator: %s (%s %s)",
+			opName(op), left.Type(), right.Type())
 	}
 }
 
@@ -325,12 +965,14 @@ func (vm *VM) executeBangOperator() error {
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 
-	if operand.Type() != object.INTEGER_OBJ {
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return vm.push(object.NewInteger(-operand.Value))
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
 		return fmt.Errorf("unsupported types for negation: %s", operand.Type())
 	}
-
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
 }
 
 func (vm *VM) isTruthy(obj object.Object) bool {
@@ -354,6 +996,31 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 	return &object.Array{Elements: elements}
 }
 
+// executeDestructure unpacks the array on top of the stack, pushing its
+// elements in reverse so the first element ends up on top
+func (vm *VM) executeDestructure(numNames int) error {
+	value := vm.pop()
+
+	array, ok := value.(*object.Array)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s", value.Type())
+	}
+
+	if len(array.Elements) != numNames {
+		return fmt.Errorf("cannot destructure %d values into %d names",
+			len(array.Elements), numNames)
+	}
+
+	for i := len(array.Elements) - 1; i >= 0; i-- {
+		err := vm.push(array.Elements[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 	hashedPairs := make(map[object.HashKey]object.HashPair)
 
@@ -413,3 +1080,153 @@ func (vm *VM) executeHashIndex(hash, index object.Object) error {
 
 	return vm.push(pair.Value)
 }
+
+// executeCall calls the callee sitting below numArgs arguments on the stack
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("calling non-function and non-built-in")
+	}
+}
+
+// executeTailCall calls the callee below numArgs arguments from a call in tail
+// position. Closures take over the current frame, so recursion in tail position
+// runs in constant frame space; builtins run as usual and leave their result for
+// the OpReturnValue that follows
+func (vm *VM) executeTailCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.tailCallClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("calling non-function and non-built-in")
+	}
+}
+
+// tailCallClosure moves cl and its arguments down over the current frame's
+// function and locals, then restarts the frame with cl
+func (vm *VM) tailCallClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	frame := vm.currentFrame()
+	if err := vm.growStack(frame.basePointer + cl.Fn.NumLocals); err != nil {
+		return err
+	}
+
+	if vm.profile != nil {
+		vm.profile.call(cl.Fn)
+	}
+
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.frames[vm.framesIndex-1] = NewFrame(cl, frame.basePointer)
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+// callClosure pushes a frame for cl, reserving stack slots for its locals above the arguments
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	if vm.framesIndex >= vm.maxFrames {
+		return vm.overflow(FrameLimit, vm.maxFrames)
+	}
+	if err := vm.growStack(vm.sp - numArgs + cl.Fn.NumLocals); err != nil {
+		return err
+	}
+
+	if vm.profile != nil {
+		vm.profile.call(cl.Fn)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	vm.pushFrame(frame)
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+// importModule pushes the exports of the module constant at constIndex,
+// calling the module first if this is its first import. The module stores its
+// exports in its slot before returning them, so later imports find them there
+func (vm *VM) importModule(constIndex int) error {
+	module, ok := vm.constants[constIndex].(*object.CompiledModule)
+	if !ok {
+		return fmt.Errorf("not a module: %+v", vm.constants[constIndex])
+	}
+
+	if exports := vm.getGlobal(module.Slot); exports != nil {
+		return vm.push(exports)
+	}
+
+	cl := &object.Closure{Fn: module.Fn}
+	err := vm.push(cl)
+	if err != nil {
+		return err
+	}
+	return vm.callClosure(cl, 0)
+}
+
+// pushClosure wraps the function constant at constIndex in a Closure
+// capturing the numFree values on top of the stack
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+// callBuiltin runs the builtin with the arguments on the stack and pushes its
+// result, or raises the error object it returns. Blocking builtins give up
+// when the VM's context is done
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	var result object.Object
+	if builtin.ContextFn != nil && vm.ctx != nil {
+		result = builtin.ContextFn(vm.ctx, args...)
+		if err := vm.ctx.Err(); err != nil {
+			return &LimitError{Limit: Cancelled, Err: err}
+		}
+	} else {
+		result = builtin.Fn(args...)
+	}
+	vm.sp = vm.sp - numArgs - 1
+
+	// A failed call is raised like any runtime error, so try can catch it
+	if errObj, ok := result.(*object.Error); ok {
+		return errors.New(errObj.Message)
+	}
+
+	if result != nil {
+		return vm.push(result)
+	}
+	return vm.push(Null)
+}
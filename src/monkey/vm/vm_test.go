@@ -1,13 +1,18 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"go-compiler/src/monkey/ast"
+	"go-compiler/src/monkey/code"
 	"go-compiler/src/monkey/compiler"
 	"go-compiler/src/monkey/lexer"
 	"go-compiler/src/monkey/object"
 	"go-compiler/src/monkey/parser"
+	"strings"
 	"testing"
+	"time"
 )
 
 type vmTestCase struct {
@@ -38,6 +43,32 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestImmediateIntegers(t *testing.T) {
+	tests := []vmTestCase{
+		{"1 + 2", 3},
+		{"-32768 + 32767", -1},
+		{"32767 + 1", 32768},
+		{"70000 - 1", 69999},
+		{"[0, 1][1]", 1},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewWithOptions(compiler.Options{ImmediateIntegers: true})
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"true", true},
@@ -68,95 +99,1402 @@ func TestBooleanExpressions(t *testing.T) {
 		{"!(if (false) { 5; })", true},
 	}
 
-	runVmTests(t, tests)
+	runVmTests(t, tests)
+}
+
+func TestBoolCoercion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected object.Object
+	}{
+		{"!!5", True},
+		{"!!0", True},
+		{`!!"monkey"`, True},
+		{"!!(if (false) { 5 })", False},
+		{"!!true", True},
+		{"!!false", False},
+		{"!!!5", False},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		if vm.LastPoppedStackElem() != tt.expected {
+			t.Errorf("%s: wrong singleton. want=%s, got=%+v",
+				tt.input, tt.expected.Inspect(), vm.LastPoppedStackElem())
+		}
+	}
+}
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"2 <= 1.5", false},
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 2", true},
+		{"let n = if (false) { 1 }; n || 0", true},
+		{"let n = if (false) { 1 }; n && true", false},
+		{"1 < 2 && 2 < 3 || false", true},
+		{"let called = false; let f = fn() { called = true; true }; false && f(); called", false},
+		{"let called = false; let f = fn() { called = true; true }; true || f(); called", false},
+		{"let called = false; let f = fn() { called = true; true }; true && f(); called", true},
+		{"let i = 0; while (i < 10 && i != 3) { i = i + 1 }; i", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 }", 20},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (i < 10) { i = i + 1; }; i", 10},
+		{"let i = 5; while (false) { i = 0; }; i", 5},
+		{"let sum = 0; let i = 0; while (i < 5) { sum = sum + i; i = i + 1 }; sum", 10},
+		// A let in the body rebinds the variable instead of shadowing it
+		{"let x = 1; while (x < 5) { let x = x + 1; }; x", 5},
+		{"let f = fn() { let x = 1; while (x < 5) { let x = x + 1; }; x }; f()", 5},
+		// Values of expression statements in the body must not pile up on the stack
+		{"let i = 0; while (i < 5000) { i = i + 1; i * 2; }; i", 5000},
+		{`
+		let collect = fn(n) {
+			let out = [];
+			while (n > 0) {
+				out = push(out, n);
+				n = n - 1;
+			}
+			out
+		};
+		collect(3)`, []int{3, 2, 1}},
+		{`
+		let find = fn(arr, x) {
+			let i = 0;
+			while (i < len(arr)) {
+				if (arr[i] == x) { return i; }
+				i = i + 1;
+			}
+			-1
+		};
+		[find([4, 5, 6], 6), find([4, 5, 6], 7)]`, []int{2, -1}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { throw 5; 1 } catch (e) { e * 2 }", 10},
+		{"try { } catch (e) { 2 }", Null},
+		{"let x = try { 1 + true } catch (e) { e }; x", "unsupported types for binary operation: INTEGER BOOLEAN"},
+		{`try { [1][5] + 1 } catch (e) { "index" }`, "index"},
+		{"try { 1(2) } catch (e) { e }", "calling non-function and non-built-in"},
+		// Values the try block pushed are dropped before the handler runs
+		{"let f = fn() { throw 5 }; [1, 2, try { [3, 4, f()] } catch (e) { e }]", []int{1, 2, 5}},
+		// Exceptions unwind the frames called from the try block
+		{`
+		let check = fn(n) { if (n > 2) { throw n } n };
+		let run = fn(n) { check(n) + run(n + 1) };
+		try { run(0) } catch (e) { e }
+		`, 3},
+		// The innermost handler catches first, and may throw to the next
+		{`
+		try {
+			try { throw 1 } catch (e) { throw e + 1 }
+		} catch (e) { e * 10 }
+		`, 20},
+		// A handler is removed once its try block finishes
+		{`
+		let f = fn() { try { 1 } catch (e) { 2 } };
+		try { f(); throw 3 } catch (e) { e }
+		`, 3},
+		{`
+		let sum = 0;
+		let i = 0;
+		while (i < 5) {
+			sum = sum + try { if (i > 2) { throw i } 0 } catch (e) { e };
+			i = i + 1;
+		}
+		sum
+		`, 7},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSwitchExpressions(t *testing.T) {
+	// Dense integer cases run from a jump table, others compare in turn
+	name := `let name = fn(n) {
+		switch (n) {
+			case 0 { "zero" }
+			case 1, 2 { "small" }
+			case 3 { "three" }
+			case 5 { "five" }
+			default { "other" }
+		}
+	};`
+	chain := `let kind = fn(x) {
+		switch (x) { case "a", "b" { 1 } case true { 2 } case 1 { 3 } default { 4 } }
+	};`
+
+	tests := []vmTestCase{
+		{name + "[name(0), name(2), name(3), name(4), name(5), name(6), name(-1)]",
+			[]string{"zero", "small", "three", "other", "five", "other", "other"}},
+		{name + `[name(2.0), name(2.5), name("a"), name(true)]`, []string{"small", "other", "other", "other"}},
+		{chain + `[kind("b"), kind(true), kind(1.0), kind(false), kind([1])]`, []int{1, 2, 3, 4, 4}},
+		{"switch (7) { case 1 { 1 } }", Null},
+		{"switch (7) { }", Null},
+		{"let x = switch (1 + 1) { case 2 { let y = 10; y * 2 } }; x", 20},
+		// The first case with the value runs
+		{"switch (1) { case 1 { 10 } case 1, 2, 3, 4 { 20 } }", 10},
+		// Case values are only evaluated until one matches
+		{"let n = 0; let f = fn() { n = n + 1; 1 }; switch (1) { case f(), f() { n } }", 1},
+	}
+
+	runVmTests(t, tests)
+
+	for _, tt := range tests[:3] {
+		comp := compiler.NewWithOptions(compiler.Options{Optimize: true, ImmediateIntegers: true})
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestUncaughtExceptions(t *testing.T) {
+	err := runWithOptions(t, `let f = fn() { throw "no" }; f()`, Options{})
+
+	var thrown *ThrownError
+	if !errors.As(err, &thrown) {
+		t.Fatalf("expected ThrownError, got=%v", err)
+	}
+	if thrown.Value.Inspect() != "no" {
+		t.Errorf("wrong thrown value. got=%s", thrown.Value.Inspect())
+	}
+
+	want := "runtime error at line 1, col 16: uncaught exception: no"
+	if err.Error() != want {
+		t.Errorf("wrong error. want=%q, got=%q", want, err)
+	}
+
+	// Exceeded limits stop the program even inside a try block
+	err = runWithOptions(t, "try { while (true) { } } catch (e) { 1 }", Options{MaxInstructions: 100})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Errorf("limit error was caught. got=%v", err)
+	}
+
+	err = runWithOptions(t, "let f = fn() { f() + 1 }; try { f() } catch (e) { 1 }", Options{MaxFrames: 10})
+	if !errors.As(err, &limitErr) {
+		t.Errorf("frame limit error was caught. got=%v", err)
+	}
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+	}
+	runVmTests(t, tests)
+}
+
+func TestBlockExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = { let y = 2; y * 3 }; x", 6},
+		{"let y = 1; let x = { let y = 10; y }; x + y", 11},
+		{"{ let a = 1 }", Null},
+		{"if (true) { }", Null},
+		{"if (true) { let b = 1 }", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTuples(t *testing.T) {
+	tests := []vmTestCase{
+		{"(1, 2)", []int{1, 2}},
+		{"let (x, y) = (2, 1); x - y", 1},
+		{"let a = 1; let b = 2; let (a, b) = (b, a); [a, b]", []int{2, 1}},
+		{"let t = (1, 2, 3); let (a, b, c) = t; a + b + c", 6},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructuringArityMismatch(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("let t = (1, 2, 3); let (a, b) = t;"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	if err.Error() != "runtime error at line 1, col 20: cannot destructure 3 values into 2 names" {
+		t.Fatalf("wrong VM error: %q", err)
+	}
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key"`, "monkey"},
+		{`"mon" + "key" + " lang"`, "monkey lang"},
+	}
+	runVmTests(t, tests)
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{"let name = \"monkey\"; let age = 3; `hello ${name}, you are ${age + 1}`", "hello monkey, you are 4"},
+		{"`${[1, 2]} ${true}`", "[1, 2] true"},
+		{"`plain`", "plain"},
+		{"``", ""},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []vmTestCase{
+		{`"hi" == "hi"`, true},
+		{`"hi" != "hi"`, false},
+		{`"hi" == "there"`, false},
+		{`"hi" != "there"`, true},
+		{`"h" + "i" == "hi"`, true},
+		{`"hi" == "h" + "i"`, true},
+		{`"h" + "i" != "hi"`, false},
+	}
+	runVmTests(t, tests)
+}
+
+func TestUnsupportedStringOperation(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`"a" - "b"`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	expected := "runtime error at line 1, col 5: unknown string operation: OpSub"
+	if err.Error() != expected {
+		t.Fatalf("wrong VM error: want=%q, got=%q", expected, err)
+	}
+
+	err = runWithOptions(t, `"a" < "b"`, Options{})
+	expected = "runtime error at line 1, col 5: unknown operator: OpGreaterThan (STRING STRING)"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong VM error: want=%q, got=%v", expected, err)
+	}
+}
+
+func TestInternedStringIdentity(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let a = "hi"; let b = "hi"; [a, b]`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	array, ok := vm.LastPoppedStackElem().(*object.Array)
+	if !ok {
+		t.Fatalf("object not Array: %T", vm.LastPoppedStackElem())
+	}
+
+	if array.Elements[0] != array.Elements[1] {
+		t.Errorf("identical string literals are not pointer-equal")
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 - 4, 5 * 6]", []int{3, -1, 30}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			"{}", map[object.HashKey]int64{},
+		},
+		{
+			"{1 : 2, 3 : 4}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 2,
+				(&object.Integer{Value: 3}).HashKey(): 4,
+			},
+		},
+		{
+			"{1 + 1 : 2 * 2, 3 + 3 : 4 * 4}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 2}).HashKey(): 4,
+				(&object.Integer{Value: 6}).HashKey(): 16,
+			},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithoutArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let one = fn() { 1; }; let two = fn() { 2; }; one() + two()", 3},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; let c = fn() { b() + 1 }; c();", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctionsWithReturnStatement(t *testing.T) {
+	tests := []vmTestCase{
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let earlyExit = fn() { return 99; return 100; }; earlyExit();", 99},
+		{"let f = fn() { if (true) { return 1; } 2 }; f();", 1},
+		{"let f = fn(x) { if (x) { return 1 } else { return 2 }; 3 }; [f(true), f(false)]", []int{1, 2}},
+	}
+
+	runVmTests(t, tests)
+
+	// Optimizing drops the code after each return, which must not change the results
+	for _, tt := range tests {
+		comp := compiler.NewWithOptions(compiler.Options{Optimize: true})
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestFunctionsWithoutReturnValue(t *testing.T) {
+	tests := []vmTestCase{
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let noReturn = fn() { }; let noReturnTwo = fn() { noReturn(); }; noReturn(); noReturnTwo();", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFirstClassFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = fn() { let one = 1; one }; one();", 1},
+		{"let oneAndTwo = fn() { let one = 1; let two = 2; one + two; }; oneAndTwo();", 3},
+		{`
+		let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+		let threeAndFour = fn() { let three = 3; let four = 4; three + four; };
+		oneAndTwo() + threeAndFour();
+		`, 10},
+		{`
+		let firstFoobar = fn() { let foobar = 50; foobar; };
+		let secondFoobar = fn() { let foobar = 100; foobar; };
+		firstFoobar() + secondFoobar();
+		`, 150},
+		{`
+		let globalSeed = 50;
+		let minusOne = fn() { let num = 1; globalSeed - num; }
+		let minusTwo = fn() { let num = 2; globalSeed - num; }
+		minusOne() + minusTwo();
+		`, 97},
+		{"let f = fn() { let a = 1; { let b = 2; a + b } }; f();", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { a + b; }; sum(1, 2);", 3},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2);", 3},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let sum = fn(a, b) { let c = a + b; c; }; let outer = fn() { sum(1, 2) + sum(3, 4); }; outer();", 10},
+		{`
+		let globalNum = 10;
+		let sum = fn(a, b) { let c = a + b; c + globalNum; };
+		let outer = fn() { sum(1, 2) + sum(3, 4) + globalNum; };
+		outer() + globalNum;
+		`, 50},
+		{"let f = fn(a) { len(a) }; f([1, 2, 3]);", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMultipleReturnValues(t *testing.T) {
+	tests := []vmTestCase{
+		{"let swap = fn(a, b) { return (b, a) }; swap(1, 2)", []int{2, 1}},
+		{"let swap = fn(a, b) { return (b, a) }; let (x, y) = swap(1, 2); x * 10 + y", 21},
+		{"let swap = fn(a, b) { let (x, y) = (b, a); [x, y] }; swap(3, 4)", []int{4, 3}},
+		{"let swap = fn(a, b) { return (b, a) }; let (x, y, z) = swap(1, 2);",
+			&object.Error{Message: "runtime error at line 1, col 40: cannot destructure 2 values into 3 names"}},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+
+		if expected, ok := tt.expected.(*object.Error); ok {
+			if err == nil || err.Error() != expected.Message {
+				t.Errorf("wrong VM error. want=%q, got=%v", expected.Message, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{`fn() { 1; }(1);`, `runtime error at line 1, col 12: wrong number of arguments: want=0, got=1`},
+		{`fn(a) { a; }();`, `runtime error at line 1, col 13: wrong number of arguments: want=1, got=0`},
+		{`fn(a, b) { a + b; }(1);`, `runtime error at line 1, col 20: wrong number of arguments: want=2, got=1`},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+		let newClosure = fn(a) { fn() { a; }; };
+		let closure = newClosure(99);
+		closure();
+		`, 99},
+		{`
+		let newAdder = fn(a, b) { fn(c) { a + b + c }; };
+		let adder = newAdder(1, 2);
+		adder(8);
+		`, 11},
+		{`
+		let newAdder = fn(a, b) { let c = a + b; fn(d) { c + d }; };
+		let adder = newAdder(1, 2);
+		adder(8);
+		`, 11},
+		{`
+		let newAdderOuter = fn(a, b) {
+			let c = a + b;
+			fn(d) {
+				let e = d + c;
+				fn(f) { e + f; };
+			};
+		};
+		let newAdderInner = newAdderOuter(1, 2)
+		let adder = newAdderInner(3);
+		adder(8);
+		`, 14},
+		{`
+		let a = 1;
+		let newAdderOuter = fn(b) { fn(c) { fn(d) { a + b + c + d }; }; };
+		let newAdderInner = newAdderOuter(2)
+		let adder = newAdderInner(3);
+		adder(8);
+		`, 14},
+		{`
+		let newClosure = fn(a, b) {
+			let one = fn() { a; };
+			let two = fn() { b; };
+			fn() { one() + two(); };
+		};
+		let closure = newClosure(9, 90);
+		closure();
+		`, 99},
+		{`
+		let f = fn(a) { { let b = a * 2; fn() { a + b } } };
+		f(5)();
+		`, 15},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+		let countDown = fn(x) {
+			if (x == 0) {
+				return 0;
+			} else {
+				countDown(x - 1);
+			}
+		};
+		countDown(1);
+		`, 0},
+		{`
+		let fibonacci = fn(x) {
+			if (x < 2) {
+				return x;
+			}
+			fibonacci(x - 1) + fibonacci(x - 2);
+		};
+		fibonacci(15);
+		`, 610},
+		{`
+		let wrapper = fn() {
+			let countDown = fn(x) {
+				if (x == 0) {
+					return 0;
+				} else {
+					countDown(x - 1);
+				}
+			};
+			countDown(1);
+		};
+		wrapper();
+		`, 0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+		let count = fn(n, acc) {
+			if (n == 0) {
+				return acc;
+			}
+			count(n - 1, acc + 1);
+		};
+		count(100000, 0);
+		`, 100000},
+		{`
+		let isEven = 0;
+		let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+		isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+		isEven(5001);
+		`, false},
+		{`
+		let sum = fn(arr, acc) {
+			if (len(arr) == 0) { return acc; }
+			return sum(rest(arr), acc + first(arr));
+		};
+		sum([1, 2, 3, 4], 0);
+		`, 10},
+		{`let f = fn(arr) { len(arr) }; f([1, 2, 3]) + 1`, 4},
+		{`let g = fn(a, b) { a - b }; let f = fn() { let x = 10; g(x, 3) }; f() * 2`, 14},
+	}
+
+	runVmTests(t, tests)
+
+	// Tail calls reuse the caller's frame, so they fit in any frame limit
+	err := runWithOptions(t, "let f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } }; f(1000)", Options{MaxFrames: 2})
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	err = runWithOptions(t, "let f = fn(a) { a }; let g = fn() { f() }; g()", Options{})
+	want := "runtime error at line 1, col 38: wrong number of arguments: want=1, got=0"
+	if err == nil || err.Error() != want {
+		t.Fatalf("wrong VM error: want=%q, got=%v", want, err)
+	}
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][0 + 2]", 3},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1][-1]", Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1[0]`, "runtime error at line 1, col 2: index operator not supported: INTEGER"},
+		{`[1]["a"]`, "runtime error at line 1, col 4: index operator not supported: ARRAY"},
+		{`{1: 1}[[1]]`, "runtime error at line 1, col 7: unusable as hashkey: ARRAY"},
+		{`{[1]: 1}`, "runtime error at line 1, col 1: unusable as hashkey: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("%s: expected VM error but resulted in none.", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong VM error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`puts("hello", "world!")`, Null},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, Null},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, Null},
+		{`push([], 1)`, []int{1}},
+		{`let count = fn(arr) { len(arr) }; count([1, 2])`, 2},
+		{`let tail = fn(arr) { rest(push(arr, 3)) }; tail([1, 2])`, []int{2, 3}},
+		{`format("{} + {} = {}", 1, 2, 3)`, "1 + 2 = 3"},
+		{`format("hello {}!", "monkey")`, "hello monkey!"},
+		{`format("no placeholders")`, "no placeholders"},
+		{`keys({3: 30, 1: 10, 2: 20})`, []int{1, 2, 3}},
+		{`values({3: 30, 1: 10, 2: 20})`, []int{10, 20, 30}},
+		{`keys({})`, []int{}},
+		{`keys({"b": 1, "a": 2, "c": 3})[0] + keys({"b": 1, "a": 2, "c": 3})[2]`, "ac"},
+		{`values({"b": 1, "a": 2, "c": 3})`, []int{2, 1, 3}},
+		{`keys({true: 1, 2: 2, "s": 3, false: 4})[0]`, false},
+		{`keys({true: 1, 2: 2, "s": 3, false: 4})[3]`, "s"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`format("{} and {}", 1)`, "wrong number of arguments to `format`. placeholders=2, got=1"},
+		{`format("{}", 1, 2)`, "wrong number of arguments to `format`. placeholders=1, got=2"},
+		{`format(1)`, "argument to `format` must be STRING, got INTEGER"},
+		{`keys([1])`, "argument to `keys` must be HASH, got ARRAY"},
+		{`values(1)`, "argument to `values` must be HASH, got INTEGER"},
+		{`keys({}, {})`, "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		err := runWithOptions(t, tt.input, Options{})
+		if err == nil || !strings.HasSuffix(err.Error(), ": "+tt.expected) {
+			t.Errorf("wrong error for %s. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	// The errors can be caught like any other
+	runVmTests(t, []vmTestCase{
+		{`try { len(1) } catch (e) { e }`, "argument to `len` not supported, got INTEGER"},
+		{`let f = fn() { push(1, 1) }; try { f() } catch (e) { "caught" }`, "caught"},
+	})
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	double := func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}
+
+	comp := compiler.New()
+	_, err := comp.RegisterBuiltin("double", double)
+	if err != nil {
+		t.Fatalf("RegisterBuiltin error: %s", err)
+	}
+	err = comp.Compile(parse("double(21) + len([1])"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 43, vm.LastPoppedStackElem())
+
+	// Bytecode without its builtins, e.g. loaded from disk, is wired up on the VM
+	bytecode := comp.Bytecode()
+	bytecode.Builtins = nil
+
+	vm = New(bytecode)
+	err = vm.RegisterBuiltin("double", double)
+	if err != nil {
+		t.Fatalf("RegisterBuiltin error: %s", err)
+	}
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 43, vm.LastPoppedStackElem())
+
+	// Names the compiler does not know could never be called
+	err = vm.RegisterBuiltin("triple", double)
+	want := `cannot register builtin "triple": not a builtin of the compiled program`
+	if err == nil || err.Error() != want {
+		t.Errorf("wrong error. want=%q, got=%v", want, err)
+	}
+
+	err = New(&compiler.Bytecode{}).RegisterBuiltin("double", double)
+	want = `cannot register builtin "double": bytecode has no symbol table`
+	if err == nil || err.Error() != want {
+		t.Errorf("wrong error. want=%q, got=%v", want, err)
+	}
+
+	// Builtins past the operand of OpGetBuiltin are rejected
+	symbolTable := compiler.NewSymbolTable()
+	symbolTable.DefineBuiltin(compiler.MaxBuiltins, "overflow")
+
+	err = New(&compiler.Bytecode{SymbolTable: symbolTable}).RegisterBuiltin("overflow", double)
+	want = `cannot register builtin "overflow": more than 256 builtins`
+	if err == nil || err.Error() != want {
+		t.Errorf("wrong error. want=%q, got=%v", want, err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("let size = len; let x = 1; let add = fn(a, b) { a + b };"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	result, err := vm.Call("add", &object.Integer{Value: 2}, &object.Integer{Value: 3})
+	if err != nil {
+		t.Fatalf("Call error: %s", err)
+	}
+	testExpectedObject(t, 5, result)
+
+	_, err = vm.Call("add", &object.Integer{Value: 2})
+	if err == nil || err.Error() != "wrong number of arguments: want=2, got=1" {
+		t.Fatalf("wrong Call error: %v", err)
+	}
+
+	// A failed call leaves the VM usable
+	result, err = vm.Call("add", &object.String{Value: "a"}, &object.String{Value: "b"})
+	if err != nil {
+		t.Fatalf("Call error: %s", err)
+	}
+	testExpectedObject(t, "ab", result)
+
+	_, err = vm.Call("add", &object.String{Value: "a"}, &object.Integer{Value: 1})
+	if err == nil {
+		t.Fatalf("expected Call error but resulted in none.")
+	}
+	if vm.sp != 0 || vm.framesIndex != 1 {
+		t.Fatalf("failed call was not unwound. sp=%d, framesIndex=%d", vm.sp, vm.framesIndex)
+	}
+
+	result, err = vm.Call("len", &object.String{Value: "four"})
+	if err != nil {
+		t.Fatalf("Call error: %s", err)
+	}
+	testExpectedObject(t, 4, result)
+
+	result, err = vm.Call("size", &object.Array{Elements: []object.Object{True, False}})
+	if err != nil {
+		t.Fatalf("Call error: %s", err)
+	}
+	testExpectedObject(t, 2, result)
+
+	_, err = vm.Call("x")
+	if err == nil || err.Error() != "x is not a function" {
+		t.Fatalf("wrong Call error: %v", err)
+	}
+
+	_, err = vm.Call("missing")
+	if err == nil || err.Error() != "undefined variable missing" {
+		t.Fatalf("wrong Call error: %v", err)
+	}
+}
+
+func TestFunction(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("let size = len; let head = first;"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	size, err := vm.Function("size")
+	if err != nil {
+		t.Fatalf("Function error: %s", err)
+	}
+
+	tests := []struct {
+		arg      object.Object
+		expected int
+	}{
+		{&object.String{Value: ""}, 0},
+		{&object.String{Value: "monkey"}, 6},
+		{&object.Array{Elements: []object.Object{True, False, Null}}, 3},
+	}
+
+	for _, tt := range tests {
+		result, err := vm.CallFunction(size, tt.arg)
+		if err != nil {
+			t.Fatalf("CallFunction error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, result)
+	}
+
+	if vm.sp != 0 {
+		t.Errorf("calls left values on the stack. sp=%d", vm.sp)
+	}
+
+	symbol, ok := comp.SymbolTable().Resolve("head")
+	if !ok {
+		t.Fatalf("head not in the compiler's symbol table")
+	}
+	if vm.Globals()[symbol.Index] != object.GetBuiltinByName("first") {
+		t.Errorf("head not bound to first in globals. got=%+v", vm.Globals()[symbol.Index])
+	}
+}
+
+func TestFunctionReuse(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`
+	let newAdder = fn(a) { fn(b) { a + b } };
+	let addTen = newAdder(10);
+	let square = fn(x) { x * x };
+	`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	addTen, err := vm.Function("addTen")
+	if err != nil {
+		t.Fatalf("Function error: %s", err)
+	}
+	if _, ok := addTen.(*object.Closure); !ok {
+		t.Fatalf("addTen is not a Closure. got=%T", addTen)
+	}
+
+	square, err := vm.Function("square")
+	if err != nil {
+		t.Fatalf("Function error: %s", err)
+	}
+
+	for i := int64(0); i < 5; i++ {
+		result, err := vm.CallFunction(addTen, &object.Integer{Value: i})
+		if err != nil {
+			t.Fatalf("CallFunction error: %s", err)
+		}
+		testExpectedObject(t, int(10+i), result)
+
+		result, err = vm.CallFunction(square, &object.Integer{Value: i})
+		if err != nil {
+			t.Fatalf("CallFunction error: %s", err)
+		}
+		testExpectedObject(t, int(i*i), result)
+	}
+}
+
+func TestCallingNonFunction(t *testing.T) {
+	program := parse("let a = 1; a()")
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	if err.Error() != "runtime error at line 1, col 13: calling non-function and non-built-in" {
+		t.Fatalf("wrong VM error: %q", err)
+	}
 }
 
-func TestConditionals(t *testing.T) {
-	tests := []vmTestCase{
-		{"if (true) { 10 }", 10},
-		{"if (true) { 10 } else { 20 }", 10},
-		{"if (false) { 10 } else { 20 }", 20},
-		{"if (1) { 10 }", 10},
-		{"if (1 < 2) { 10 }", 10},
-		{"if (1 < 2) { 10 } else { 20 }", 10},
-		{"if (1 > 2) { 10 } else { 20 }", 20},
-		{"if (1 > 2) { 10 }", Null},
-		{"if (false) { 10 }", Null},
-		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+func TestRuntimeErrorPositions(t *testing.T) {
+	input := `let get = fn(arr) {
+  arr[0]
+};
+get([1]);
+get(5);`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
 	}
 
-	runVmTests(t, tests)
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("error is not a RuntimeError. got=%T (%s)", err, err)
+	}
+
+	// Reported inside the function, not at the call site
+	if runtimeErr.Position != (code.Position{Line: 2, Column: 6}) {
+		t.Errorf("wrong position. got=%s", runtimeErr.Position)
+	}
+
+	if runtimeErr.Unwrap().Error() != "index operator not supported: INTEGER" {
+		t.Errorf("wrong wrapped error. got=%q", runtimeErr.Unwrap())
+	}
+
+	if err.Error() != "runtime error at line 2, col 6: index operator not supported: INTEGER" {
+		t.Errorf("wrong VM error. got=%q", err)
+	}
 }
 
-func TestGlobalLetStatements(t *testing.T) {
-	tests := []vmTestCase{
-		{"let one = 1; one", 1},
-		{"let one = 1; let two = 2; one + two", 3},
-		{"let one = 1; let two = one + one; one + two", 3},
+func TestPopOnEmptyStack(t *testing.T) {
+	bytecode := &compiler.Bytecode{
+		Instructions: append(code.Make(code.OpPop), code.Make(code.OpTrue)...),
+	}
+
+	vm := New(bytecode)
+	err := vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	if err.Error() != "stack underflow" {
+		t.Fatalf("wrong VM error: %q", err)
+	}
+
+	if vm.sp != 0 {
+		t.Errorf("stack pointer corrupted. got=%d", vm.sp)
 	}
-	runVmTests(t, tests)
 }
 
-func TestStringExpressions(t *testing.T) {
-	tests := []vmTestCase{
-		{`"monkey"`, "monkey"},
-		{`"mon" + "key"`, "monkey"},
-		{`"mon" + "key" + " lang"`, "monkey lang"},
+func TestSafeRun(t *testing.T) {
+	// OpConstant refers to a constant that isn't in the pool
+	bytecode := &compiler.Bytecode{
+		Instructions: code.Make(code.OpConstant, 5),
+		Constants:    []object.Object{},
 	}
-	runVmTests(t, tests)
+
+	vm := New(bytecode)
+	err := vm.SafeRun()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	if !strings.HasPrefix(err.Error(), "vm panic: ") {
+		t.Fatalf("wrong VM error: %q", err)
+	}
+
+	// Returning from the main program leaves no frame to locate the panic in
+	returnFromMain := append(code.Make(code.OpTrue), code.Make(code.OpReturnValue)...)
+	vm = New(&compiler.Bytecode{Instructions: returnFromMain})
+	err = vm.SafeRun()
+	if err == nil || !strings.HasPrefix(err.Error(), "vm panic: ") {
+		t.Fatalf("wrong VM error: %v", err)
+	}
+
+	vm = New(&compiler.Bytecode{Instructions: code.Make(code.OpTrue)})
+	err = vm.SafeRun()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, true, vm.StackTop())
 }
 
-func TestArrayLiterals(t *testing.T) {
-	tests := []vmTestCase{
-		{"[]", []int{}},
-		{"[1, 2, 3]", []int{1, 2, 3}},
-		{"[1 + 2, 3 - 4, 5 * 6]", []int{3, -1, 30}},
+func TestCoverage(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("if (false) { 10 } else { 20 }"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
 	}
 
-	runVmTests(t, tests)
+	vm := New(comp.Bytecode())
+	if vm.Coverage() != nil {
+		t.Fatalf("coverage recorded without being enabled")
+	}
+
+	vm.EnableCoverage()
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// 0000 OpFalse
+	// 0001 OpJumpNotTruthy 10
+	// 0004 OpConstant 0
+	// 0007 OpJump 13
+	// 0010 OpConstant 1
+	// 0013 OpPop
+	expected := map[int]bool{0: true, 1: true, 4: false, 7: false, 10: true, 13: true}
+
+	coverage := vm.Coverage()
+	for offset, want := range expected {
+		if coverage[offset] != want {
+			t.Errorf("wrong coverage at %04d. want=%t, got=%t", offset, want, coverage[offset])
+		}
+	}
 }
 
-func TestHashLiterals(t *testing.T) {
+func TestSmallIntegerResultsAreCached(t *testing.T) {
+	tests := []struct {
+		input  string
+		cached bool
+	}{
+		{"1 + 2", true},
+		{"-(2 * 3)", true},
+		{fmt.Sprintf("%d + 1", object.MaxCachedInteger), false},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		result, ok := vm.LastPoppedStackElem().(*object.Integer)
+		if !ok {
+			t.Fatalf("%s: result is not Integer. got=%T", tt.input, vm.LastPoppedStackElem())
+		}
+
+		if cached := result == object.NewInteger(result.Value); cached != tt.cached {
+			t.Errorf("%s: wrong caching of %d. want=%t, got=%t", tt.input, result.Value, tt.cached, cached)
+		}
+	}
+}
+
+func TestIntegerArithmeticDoesNotAllocate(t *testing.T) {
+	allocs := func(iterations int) float64 {
+		input := fmt.Sprintf(
+			"let i = 0; let n = 0; while (i < %d) { n = (n * 3 + 7) / 2 - n; i = i + 1 }", iterations)
+
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		return testing.AllocsPerRun(10, func() {
+			vm := New(bytecode)
+			if err := vm.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+		})
+	}
+
+	// Every value stays within the small integer cache, so only creating the
+	// VM allocates however long the loop runs
+	short, long := allocs(10), allocs(1000)
+	if long != short {
+		t.Errorf("integer loop allocates. %v allocations for 10 iterations, %v for 1000", short, long)
+	}
+}
+
+func TestExecutionLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input   string
+		options Options
+		limit   Limit
+		max     int
+	}{
+		{"while (true) { }", Options{MaxInstructions: 1000}, InstructionLimit, 1000},
+		{"let f = 0; f = fn(n) { 1 + f(n + 1) }; f(0)", Options{MaxFrames: 10}, FrameLimit, 10},
+		{"let f = 0; f = fn() { 1 + f() }; f()", Options{}, FrameLimit, MaxFrames},
+		{"[1, 2, 3, 4, 5]", Options{MaxStack: 4}, StackLimit, 4},
+		{"let f = fn() { let a = 1; let b = 2; a + b }; 1 + f()", Options{MaxStack: 3}, StackLimit, 3},
+		{"while (true) { }", Options{Context: cancelled}, Cancelled, 0},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = NewWithOptions(comp.Bytecode(), tt.options).Run()
+
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("%s: expected LimitError, got=%v", tt.input, err)
+			continue
+		}
+		if limitErr.Limit != tt.limit || limitErr.Max != tt.max {
+			t.Errorf("%s: wrong limit. want=%d (max %d), got=%d (max %d)",
+				tt.input, tt.limit, tt.max, limitErr.Limit, limitErr.Max)
+		}
+	}
+
+	if err := runWithOptions(t, "while (true) { }", Options{Context: cancelled}); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancellation does not unwrap to context.Canceled. got=%v", err)
+	}
+
+	ctx, stop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer stop()
+	if err := runWithOptions(t, "while (true) { }", Options{Context: ctx}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("deadline did not stop execution. got=%v", err)
+	}
+}
+
+func TestExecutionWithinLimits(t *testing.T) {
+	options := Options{MaxInstructions: 1000, MaxStack: 16, MaxFrames: 8, Context: context.Background()}
+
+	err := runWithOptions(t, "let f = 0; f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } }; f(5)", options)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// Errors raised by the program are not limit errors
+	err = runWithOptions(t, "1 + true", options)
+	var limitErr *LimitError
+	if err == nil || errors.As(err, &limitErr) {
+		t.Errorf("expected a non-limit error. got=%v", err)
+	}
+}
+
+func TestModules(t *testing.T) {
+	modules := map[string]string{
+		"counter.monkey": `
+		let count = 0;
+		let next = fn() { count = count + 1; count };
+		`,
+		"math.monkey": `
+		let square = fn(x) { x * x };
+		let sumOfSquares = fn(a, b) { square(a) + square(b) };
+		`,
+		"shapes.monkey": `
+		let math = import("math.monkey");
+		let area = fn(side) { math["square"](side) };
+		`,
+	}
+	importer := func(path string) (string, error) {
+		src, ok := modules[path]
+		if !ok {
+			return "", fmt.Errorf("no such module")
+		}
+		return src, nil
+	}
+
 	tests := []vmTestCase{
-		{
-			"{}", map[object.HashKey]int64{},
-		},
-		{
-			"{1 : 2, 3 : 4}",
-			map[object.HashKey]int64{
-				(&object.Integer{Value: 1}).HashKey(): 2,
-				(&object.Integer{Value: 3}).HashKey(): 4,
-			},
-		},
-		{
-			"{1 + 1 : 2 * 2, 3 + 3 : 4 * 4}",
-			map[object.HashKey]int64{
-				(&object.Integer{Value: 2}).HashKey(): 4,
-				(&object.Integer{Value: 6}).HashKey(): 16,
-			},
-		},
+		{`let math = import("math.monkey"); math["sumOfSquares"](3, 4)`, 25},
+		{`let square = 1; let math = import("math.monkey"); math["square"](3) + square`, 10},
+		// The module runs once, so both imports share its globals
+		{`let a = import("counter.monkey"); a["next"](); let b = import("counter.monkey"); b["next"]()`, 2},
+		{`let f = fn() { import("counter.monkey")["next"]() }; f(); f(); f()`, 3},
+		{`import("shapes.monkey")["area"](5) + import("math.monkey")["square"](2)`, 29},
+		{`len(keys(import("math.monkey")))`, 2},
 	}
 
-	runVmTests(t, tests)
+	for _, tt := range tests {
+		comp := compiler.NewWithOptions(compiler.Options{Importer: importer})
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = Verify(comp.Bytecode())
+		if err != nil {
+			t.Fatalf("%s: verify error: %s", tt.input, err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
 }
 
-func TestIndexExpressions(t *testing.T) {
+func runWithOptions(t *testing.T, input string, options Options) error {
+	t.Helper()
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return NewWithOptions(comp.Bytecode(), options).Run()
+}
+
+func TestFloatArithmetic(t *testing.T) {
 	tests := []vmTestCase{
-		{"[1, 2, 3][1]", 2},
-		{"[1, 2, 3][0 + 2]", 3},
-		{"[[1, 1, 1]][0][0]", 1},
-		{"[][0]", Null},
-		{"[1, 2, 3][99]", Null},
-		{"[1][-1]", Null},
-		{"{1: 1, 2: 2}[1]", 1},
-		{"{1: 1, 2: 2}[2]", 2},
-		{"{1: 1}[0]", Null},
-		{"{}[0]", Null},
+		{"1.5", 1.5},
+		{"1.5 + 2.25", 3.75},
+		{"3 / 2", 1},
+		{"3 / 2.0", 1.5},
+		{"3.0 / 2", 1.5},
+		{"2 * 0.5 - 1", 0.0},
+		{"-2.5", -2.5},
+		{"-(1 - 1.5)", 0.5},
+		{"1 == 1.0", true},
+		{"1.5 != 1.5", false},
+		{"1 < 1.5", true},
+		{"2.5 > 3", false},
+		{"let a = 0.1; let b = 0.2; a + b > 0.3", true},
+		{"[1.5, 2][0] * 2", 3.0},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestDivisionByZero(t *testing.T) {
+	for _, input := range []string{"1 / 0", "1.5 / 0", "1 / 0.0", "let f = fn(a) { 10 / a }; f(0)"} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || !strings.HasSuffix(err.Error(), ": division by zero") {
+			t.Errorf("%s: expected division by zero error. got=%v", input, err)
+		}
+	}
+}
+
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
@@ -169,6 +1507,11 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 			t.Fatalf("compiler error: %s", err)
 		}
 
+		err = Verify(comp.Bytecode())
+		if err != nil {
+			t.Fatalf("%s: verify error: %s", tt.input, err)
+		}
+
 		vm := New(comp.Bytecode())
 		err = vm.Run()
 		if err != nil {
@@ -196,6 +1539,16 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 		if err != nil {
 			t.Errorf("testIntegerObject failed: %s", err)
 		}
+	case bool:
+		err := testBooleanObject(bool(expected), actual)
+		if err != nil {
+			t.Errorf("testBooleanObject failed: %s", err)
+		}
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed: %s", err)
+		}
 	case string:
 		err := testStringObject(expected, actual)
 		if err != nil {
@@ -219,11 +1572,42 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 				t.Errorf("testIntegerObject failed: %s", err)
 			}
 		}
+	case []string:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d",
+				len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			err := testStringObject(expectedElem, array.Elements[i])
+			if err != nil {
+				t.Errorf("testStringObject failed: %s", err)
+			}
+		}
 	case *object.Null:
 		if actual != Null {
 			t.Errorf("object is not Null: %T (%+v)", actual, expected)
 		}
 
+	case *object.Error:
+		errObj, ok := actual.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error: %T (%+v)", actual, actual)
+			return
+		}
+
+		if errObj.Message != expected.Message {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				expected.Message, errObj.Message)
+		}
+
 	case map[object.HashKey]int64:
 		hash, ok := actual.(*object.Hash)
 		if !ok {
@@ -265,6 +1649,34 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value.  got=%g, want=%g", result.Value, expected)
+	}
+
+	return nil
+}
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value.  got=%t, want=%t", result.Value, expected)
+	}
+
+	return nil
+}
+
 func testStringObject(expected string, actual object.Object) error {
 	result, ok := actual.(*object.String)
 	if !ok {
@@ -278,3 +1690,37 @@ func testStringObject(expected string, actual object.Object) error {
 
 	return nil
 }
+
+func TestSetGlobal(t *testing.T) {
+	program := parse("x * 2")
+
+	comp := compiler.New()
+	comp.DefineGlobal("x")
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	value, err := object.FromGoValue(42)
+	if err != nil {
+		t.Fatalf("FromGoValue error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.SetGlobal("x", value)
+	if err != nil {
+		t.Fatalf("SetGlobal error: %s", err)
+	}
+
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 84, vm.LastPoppedStackElem())
+
+	err = vm.SetGlobal("y", value)
+	if err == nil {
+		t.Errorf("expected error for undefined global")
+	}
+}